@@ -0,0 +1,129 @@
+package batch
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/nomad-software/meme/cache"
+	"github.com/nomad-software/meme/cli"
+	"github.com/nomad-software/meme/image"
+	"github.com/nomad-software/meme/output"
+	"github.com/nomad-software/meme/upload"
+)
+
+const (
+	embeddedSize = 64 << 20 // The size of the templates kept between jobs in bytes.
+)
+
+// result is the outcome of a single job.
+type result struct {
+	Job        string `json:"job"`
+	File       string `json:"file,omitempty"`
+	URL        string `json:"url,omitempty"`
+	DeleteHash string `json:"deletehash,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// Run generates the memes in the manifest files using a pool of workers.
+// A job that fails is reported and the rest carry on. Templates and fonts are
+// loaded once and shared between jobs.
+func Run(opt cli.Options) {
+	opt.Embedded = cache.NewMemory(embeddedSize, 0)
+
+	var jobs []Job
+	for _, file := range opt.Args {
+		jobs = append(jobs, readManifest(file)...)
+	}
+
+	workers := opt.Jobs
+	if workers < 1 {
+		workers = 1
+	}
+
+	results := make([]result, len(jobs))
+	queue := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Each job is run inside output.Catch, so a failure only stops
+			// that job rather than crashing the program.
+			for x := range queue {
+				results[x] = run(opt, jobs[x])
+				if !opt.JSON {
+					report(results[x])
+				}
+			}
+		}()
+	}
+
+	for x := range jobs {
+		queue <- x
+	}
+	close(queue)
+	wg.Wait()
+
+	failed := 0
+	for _, res := range results {
+		if res.Error != "" {
+			failed++
+		}
+	}
+
+	if opt.JSON {
+		output.JSON(results)
+	} else {
+		output.Info("Generated %d of %d memes", len(jobs)-failed, len(jobs))
+	}
+
+	if failed > 0 {
+		output.Error(fmt.Sprintf("%d of %d jobs failed", failed, len(jobs)))
+	}
+}
+
+// Run a single job, catching any errors.
+func run(base cli.Options, job Job) result {
+	res := result{Job: job.Name}
+
+	err := output.Catch(func() {
+		opt := cli.ParseJob(base.BaseArgs, job.Values)
+		opt.Embedded = base.Embedded
+		opt.Valid()
+
+		st := image.Generate(opt)
+
+		if opt.Upload == "" || opt.Keep || opt.OutName != "" {
+			res.File = image.Save(opt, st)
+		}
+
+		if opt.Upload != "" {
+			up := upload.New(opt).Upload(st)
+			upload.Record(opt, up)
+			res.URL = up.URL
+			res.DeleteHash = up.DeleteHash
+		}
+	})
+
+	if err != nil {
+		res.Error = err.Error()
+	}
+
+	return res
+}
+
+// Print the result of a job.
+func report(res result) {
+	if res.Error != "" {
+		output.Warn("%s: %s", res.Job, res.Error)
+		return
+	}
+
+	if res.File != "" {
+		output.Info("%s: %s", res.Job, res.File)
+	}
+	if res.URL != "" {
+		output.Info("%s: %s", res.Job, res.URL)
+	}
+}
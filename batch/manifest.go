@@ -0,0 +1,165 @@
+package batch
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/nomad-software/meme/cli"
+	"github.com/nomad-software/meme/output"
+	"gopkg.in/yaml.v3"
+)
+
+// Job is a single meme to generate. Its values are keyed by flag name.
+type Job struct {
+	Name   string
+	Values map[string][]string
+}
+
+// Read the jobs in a manifest file. The format is chosen using the file
+// extension, either yaml, csv or jsonl.
+func readManifest(path string) []Job {
+	path, err := homedir.Expand(path)
+	output.OnError(err, "Could not expand path")
+
+	b, err := os.ReadFile(path)
+	output.OnError(err, "Could not read manifest")
+
+	var jobs []Job
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		jobs = readYAML(b)
+	case ".csv":
+		jobs = readCSV(b)
+	case ".jsonl", ".ndjson":
+		jobs = readJSONL(b)
+	default:
+		output.Error(fmt.Sprintf("Manifest format not recognised, use yaml, csv or jsonl: %s", path))
+	}
+
+	for x := range jobs {
+		jobs[x].Name = fmt.Sprintf("%s #%d", filepath.Base(path), x+1)
+	}
+
+	return jobs
+}
+
+// Read a yaml manifest. It's either a list of jobs, or a map containing the
+// list of jobs and defaults applied to every job.
+//
+//	defaults:
+//	  outdir: memes
+//	jobs:
+//	  - image: kirk-khan
+//	    text: "|khaaaan"
+func readYAML(b []byte) []Job {
+	var doc interface{}
+	err := yaml.Unmarshal(b, &doc)
+	output.OnError(err, "Could not decode yaml manifest")
+
+	var list []interface{}
+	var defaults map[string]interface{}
+
+	switch v := doc.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		list = v
+	case map[string]interface{}:
+		jobs, ok := v["jobs"].([]interface{})
+		if !ok {
+			output.Error("The yaml manifest must contain a list of jobs")
+		}
+		list = jobs
+		if d, ok := v["defaults"]; ok {
+			defaults, ok = d.(map[string]interface{})
+			if !ok {
+				output.Error("The yaml manifest defaults must be a map")
+			}
+		}
+	default:
+		output.Error("The yaml manifest must be a list of jobs")
+	}
+
+	var jobs []Job
+	for _, item := range list {
+		fields, ok := item.(map[string]interface{})
+		if !ok {
+			output.Error("Each job in the yaml manifest must be a map")
+		}
+
+		values := cli.FlagValues(defaults)
+		for key, value := range cli.FlagValues(fields) {
+			values[key] = value
+		}
+		jobs = append(jobs, Job{Values: values})
+	}
+
+	return jobs
+}
+
+// Read a csv manifest. The first row contains the field names and each
+// following row is a job. Empty cells are ignored.
+func readCSV(b []byte) []Job {
+	r := csv.NewReader(bytes.NewReader(b))
+	r.Comment = '#'
+	r.TrimLeadingSpace = true
+
+	header, err := r.Read()
+	if err == io.EOF {
+		return nil
+	}
+	output.OnError(err, "Could not decode csv manifest")
+
+	var jobs []Job
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		output.OnError(err, "Could not decode csv manifest")
+
+		values := make(map[string][]string)
+		for x, cell := range row {
+			if cell != "" {
+				values[header[x]] = []string{cell}
+			}
+		}
+		jobs = append(jobs, Job{Values: values})
+	}
+
+	return jobs
+}
+
+// Read a jsonl manifest, containing a json object on each line for each job.
+// Blank lines are ignored.
+func readJSONL(b []byte) []Job {
+	var jobs []Job
+
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	scanner.Buffer(nil, 1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+
+		var fields map[string]interface{}
+		err := json.Unmarshal(text, &fields)
+		output.OnError(err, fmt.Sprintf("Could not decode jsonl manifest on line %d", line))
+
+		jobs = append(jobs, Job{Values: cli.FlagValues(fields)})
+	}
+	output.OnError(scanner.Err(), "Could not read jsonl manifest")
+
+	return jobs
+}
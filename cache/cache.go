@@ -0,0 +1,194 @@
+package cache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/nomad-software/meme/output"
+)
+
+const (
+	defaultSize = 256 << 20 // bytes
+	defaultTTL  = 24 * time.Hour
+)
+
+var (
+	// Downloaded images and rendered memes are cached in memory, and on disk
+	// when a directory is configured. Decoded images are only kept in memory.
+	memory = NewMemory(defaultSize, defaultTTL)
+	disk   *Disk
+	mutex  sync.RWMutex
+)
+
+// Configure the cache used by the package functions. A size of zero disables
+// the memory cache and an empty directory disables the disk cache. A TTL of
+// zero keeps entries until they're evicted.
+func Configure(size int64, dir string, diskSize int64, ttl time.Duration) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	memory = NewMemory(size, ttl)
+	disk = nil
+	if dir != "" {
+		dir, err := homedir.Expand(dir)
+		output.OnError(err, "Could not expand path")
+		disk = NewDisk(dir, diskSize, ttl)
+	}
+}
+
+// Key returns the hash of the passed parts, which is used to address entries.
+func Key(parts ...[]byte) string {
+	h := sha256.New()
+	for _, part := range parts {
+		// Each part is prefixed with its length so parts can't run together.
+		var size [8]byte
+		binary.LittleEndian.PutUint64(size[:], uint64(len(part)))
+		h.Write(size[:])
+		h.Write(part)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Bytes returns the cached bytes of the named kind, such as 'source' or
+// 'output'. Entries found on disk are moved into memory. The returned bytes
+// must not be modified.
+func Bytes(kind string, key string) ([]byte, bool) {
+	mutex.RLock()
+	m, d := memory, disk
+	mutex.RUnlock()
+
+	if v, ok := m.Get(kind + "/" + key); ok {
+		return v.([]byte), true
+	}
+
+	if d != nil {
+		if b, ok := d.Get(kind, key); ok {
+			m.Put(kind+"/"+key, b, int64(len(b)))
+			return b, true
+		}
+	}
+
+	return nil, false
+}
+
+// PutBytes caches bytes of the named kind in memory and on disk. The bytes
+// must not be modified afterwards.
+func PutBytes(kind string, key string, b []byte) {
+	mutex.RLock()
+	m, d := memory, disk
+	mutex.RUnlock()
+
+	m.Put(kind+"/"+key, b, int64(len(b)))
+	if d != nil {
+		d.Put(kind, key, b)
+	}
+}
+
+// Value returns a value of the named kind cached in memory, such as a decoded
+// image. The value is shared, so it must not be modified.
+func Value(kind string, key string) (interface{}, bool) {
+	mutex.RLock()
+	m := memory
+	mutex.RUnlock()
+
+	return m.Get(kind + "/" + key)
+}
+
+// PutValue caches a value of the named kind in memory. The size is the
+// approximate number of bytes used by the value.
+func PutValue(kind string, key string, value interface{}, size int64) {
+	mutex.RLock()
+	m := memory
+	mutex.RUnlock()
+
+	m.Put(kind+"/"+key, value, size)
+}
+
+// Memory is a least recently used cache limited by the total size of its
+// entries. Entries older than the TTL are never returned.
+type Memory struct {
+	mutex   sync.Mutex
+	maxSize int64
+	size    int64
+	ttl     time.Duration
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+// entry is a value cached in memory.
+type entry struct {
+	key     string
+	value   interface{}
+	size    int64
+	expires time.Time
+}
+
+// NewMemory creates a memory cache holding at most the passed number of
+// bytes.
+func NewMemory(size int64, ttl time.Duration) *Memory {
+	return &Memory{
+		maxSize: size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// Get returns a cached value, marking it as recently used.
+func (c *Memory) Get(key string) (interface{}, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	e := el.Value.(*entry)
+	if !e.expires.IsZero() && time.Now().After(e.expires) {
+		c.remove(el)
+		return nil, false
+	}
+
+	c.order.MoveToFront(el)
+	return e.value, true
+}
+
+// Put caches a value, evicting the least recently used values to make room.
+// Values larger than the cache aren't stored.
+func (c *Memory) Put(key string, value interface{}, size int64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+
+	if c.maxSize <= 0 || size > c.maxSize {
+		return
+	}
+
+	e := &entry{key: key, value: value, size: size}
+	if c.ttl > 0 {
+		e.expires = time.Now().Add(c.ttl)
+	}
+
+	c.entries[key] = c.order.PushFront(e)
+	c.size += size
+
+	for c.size > c.maxSize {
+		c.remove(c.order.Back())
+	}
+}
+
+// Remove an entry.
+func (c *Memory) remove(el *list.Element) {
+	e := c.order.Remove(el).(*entry)
+	delete(c.entries, e.key)
+	c.size -= e.size
+}
@@ -0,0 +1,202 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	tempPrefix = ".tmp-"
+	staleTemp  = time.Hour // Temporary files older than this were abandoned.
+)
+
+var (
+	// The names of cached files, which are the hex encoded sha256 keys.
+	keyPattern = regexp.MustCompile(`^[0-9a-f]{64}$`)
+)
+
+// Disk caches bytes in a directory so they can be shared between runs. Files
+// older than the TTL are never returned and the oldest files are removed once
+// the directory is larger than its maximum size. Failing to read or write the
+// cache isn't an error, the entry is just treated as missing. Only the files
+// the cache creates are ever removed, so the directory can be shared with
+// other files.
+type Disk struct {
+	mutex   sync.Mutex
+	dir     string
+	maxSize int64
+	size    int64 // bytes, negative until the directory has been measured
+	ttl     time.Duration
+	kinds   map[string]bool
+}
+
+// diskFile is a file in the cache directory.
+type diskFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// NewDisk creates a disk cache in the passed directory holding at most the
+// passed number of bytes.
+func NewDisk(dir string, size int64, ttl time.Duration) *Disk {
+	return &Disk{
+		dir:     dir,
+		maxSize: size,
+		size:    -1,
+		ttl:     ttl,
+		kinds:   make(map[string]bool),
+	}
+}
+
+// Get returns the cached bytes of the named kind.
+func (d *Disk) Get(kind string, key string) ([]byte, bool) {
+	d.use(kind)
+	path := d.path(kind, key)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, false
+	}
+
+	if d.expired(info.ModTime()) {
+		os.Remove(path)
+		return nil, false
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false
+	}
+	return b, true
+}
+
+// Put caches bytes of the named kind, removing the oldest files if the cache
+// becomes too large. Files are written to a temporary file first so other
+// processes never read part of one.
+func (d *Disk) Put(kind string, key string, b []byte) {
+	if int64(len(b)) > d.maxSize {
+		return
+	}
+	d.use(kind)
+
+	path := d.path(kind, key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), tempPrefix+"*")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(b)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.size >= 0 {
+		d.size += int64(len(b))
+	}
+	if d.size < 0 || d.size > d.maxSize {
+		d.prune()
+	}
+}
+
+// Remember that entries of the named kind are cached, so they're pruned.
+func (d *Disk) use(kind string) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.kinds[kind] = true
+}
+
+// Remove expired files, then the oldest files until the cache fits in its
+// maximum size. The directory is measured each time as it can be shared with
+// other processes. Only the directories of the kinds in use are looked in, and
+// only cached files and abandoned temporary files are removed.
+func (d *Disk) prune() {
+	var files []diskFile
+	var size int64
+
+	for kind := range d.kinds {
+		root := filepath.Join(d.dir, kind)
+		dirs, _ := os.ReadDir(root)
+
+		for _, dir := range dirs {
+			if !dir.IsDir() || len(dir.Name()) != 2 {
+				continue
+			}
+			entries, _ := os.ReadDir(filepath.Join(root, dir.Name()))
+
+			for _, entry := range entries {
+				name := entry.Name()
+				path := filepath.Join(root, dir.Name(), name)
+				if !entry.Type().IsRegular() {
+					continue
+				}
+				info, err := entry.Info()
+				if err != nil {
+					continue
+				}
+
+				if strings.HasPrefix(name, tempPrefix) {
+					if time.Since(info.ModTime()) > staleTemp {
+						os.Remove(path)
+					}
+					continue
+				}
+
+				if !keyPattern.MatchString(name) || name[:2] != dir.Name() {
+					continue
+				}
+
+				if d.expired(info.ModTime()) {
+					os.Remove(path)
+					continue
+				}
+				files = append(files, diskFile{path, info.Size(), info.ModTime()})
+				size += info.Size()
+			}
+		}
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.Before(files[j].modTime)
+	})
+
+	for _, f := range files {
+		if size <= d.maxSize {
+			break
+		}
+		if os.Remove(f.path) == nil {
+			size -= f.size
+		}
+	}
+
+	d.size = size
+}
+
+// Return the path of a cached file. Files are spread over sub directories
+// named after the start of their key.
+func (d *Disk) path(kind string, key string) string {
+	return filepath.Join(d.dir, kind, key[:2], key)
+}
+
+// Return true if a file modified at the passed time has expired.
+func (d *Disk) expired(modTime time.Time) bool {
+	return d.ttl > 0 && time.Since(modTime) > d.ttl
+}
@@ -0,0 +1,86 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDiskPruneKeepsOtherFiles(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().Add(-72 * time.Hour)
+
+	// Files the cache didn't create, including ones that look like entries of
+	// a kind that isn't used.
+	others := []string{
+		filepath.Join(dir, "docs", "thesis.txt"),
+		filepath.Join(dir, "output", "notes.txt"),
+		filepath.Join(dir, "output", "ab", "notes.txt"),
+		filepath.Join(dir, "photos", "ab", "ab"+hexKey('0')[2:]),
+	}
+	for _, path := range others {
+		write(t, path, old)
+	}
+
+	// An expired entry and an abandoned temporary file.
+	expired := filepath.Join(dir, "output", "cc", hexKey('c'))
+	write(t, expired, old)
+	temp := filepath.Join(dir, "output", "cc", tempPrefix+"123")
+	write(t, temp, old)
+
+	d := NewDisk(dir, 1<<20, 24*time.Hour)
+	d.Put("output", hexKey('e'), []byte("meme"))
+
+	for _, path := range others {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("%s was removed", path)
+		}
+	}
+	for _, path := range []string{expired, temp} {
+		if _, err := os.Stat(path); err == nil {
+			t.Errorf("%s wasn't removed", path)
+		}
+	}
+	if b, ok := d.Get("output", hexKey('e')); !ok || string(b) != "meme" {
+		t.Errorf("the new entry wasn't cached")
+	}
+}
+
+func TestDiskPruneRemovesOldest(t *testing.T) {
+	dir := t.TempDir()
+	d := NewDisk(dir, 10, 0)
+
+	d.Put("output", hexKey('a'), []byte("123456"))
+	os.Chtimes(d.path("output", hexKey('a')), time.Now().Add(-time.Minute), time.Now().Add(-time.Minute))
+	d.Put("output", hexKey('b'), []byte("123456"))
+
+	if _, ok := d.Get("output", hexKey('a')); ok {
+		t.Errorf("the oldest entry wasn't removed")
+	}
+	if _, ok := d.Get("output", hexKey('b')); !ok {
+		t.Errorf("the newest entry was removed")
+	}
+}
+
+// Return a key made of the passed hex character.
+func hexKey(c byte) string {
+	b := make([]byte, 64)
+	for i := range b {
+		b[i] = c
+	}
+	return string(b)
+}
+
+// Write a file with the passed modification time.
+func write(t *testing.T, path string, modTime time.Time) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,92 @@
+package cli
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Box is a text box placed anywhere on the meme. The position and size are
+// percentages of the image size, so boxes stay in place when it's resized.
+type Box struct {
+	X      float64
+	Y      float64
+	Width  float64
+	Height float64
+	Text   string
+}
+
+// ParseBox parses a text box such as '10,40,80,20:text', which is the left,
+// top, width and height in percent followed by the text.
+func ParseBox(spec string) (Box, error) {
+	rect, text, ok := strings.Cut(spec, ":")
+	if !ok {
+		return Box{}, fmt.Errorf("invalid box '%s', expected 'x,y,w,h:text'", spec)
+	}
+
+	parts := strings.Split(rect, ",")
+	if len(parts) != 4 {
+		return Box{}, fmt.Errorf("invalid box '%s', expected 'x,y,w,h:text'", spec)
+	}
+
+	var v [4]float64
+	for x, part := range parts {
+		n, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || n < 0 || n > 100 {
+			return Box{}, fmt.Errorf("invalid box '%s', the position and size must be percentages", spec)
+		}
+		v[x] = n
+	}
+
+	if v[2] == 0 || v[3] == 0 {
+		return Box{}, fmt.Errorf("invalid box '%s', the width and height must not be zero", spec)
+	}
+
+	if v[0]+v[2] > 100 || v[1]+v[3] > 100 {
+		return Box{}, fmt.Errorf("invalid box '%s', the box must fit inside the image", spec)
+	}
+
+	box := Box{
+		X:      v[0],
+		Y:      v[1],
+		Width:  v[2],
+		Height: v[3],
+		Text:   Unescape(text),
+	}
+
+	return box, nil
+}
+
+// String returns the box in the form it's parsed from.
+func (b Box) String() string {
+	f := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprintf("%s,%s,%s,%s:%s", f(b.X), f(b.Y), f(b.Width), f(b.Height), b.Text)
+}
+
+// boxList collects every text box passed using the -box flag.
+type boxList []Box
+
+// String implements the flag.Value interface.
+func (l *boxList) String() string {
+	if l == nil {
+		return ""
+	}
+
+	var boxes []string
+	for _, b := range *l {
+		boxes = append(boxes, b.String())
+	}
+	return strings.Join(boxes, ", ")
+}
+
+// Set implements the flag.Value interface.
+func (l *boxList) Set(spec string) error {
+	box, err := ParseBox(spec)
+	if err != nil {
+		return err
+	}
+	*l = append(*l, box)
+	return nil
+}
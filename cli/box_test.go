@@ -0,0 +1,34 @@
+package cli
+
+import "testing"
+
+func TestParseBox(t *testing.T) {
+	tests := []struct {
+		spec string
+		box  Box
+		ok   bool
+	}{
+		{"10,40,80,20:text", Box{10, 40, 80, 20, "text"}, true},
+		{"0,0,100,100:", Box{0, 0, 100, 100, ""}, true},
+		{"33.3,66.7,66.7,33.3:a:b", Box{33.3, 66.7, 66.7, 33.3, "a:b"}, true},
+		{"50,70,45,25:line\\none", Box{50, 70, 45, 25, "line\none"}, true},
+		{"10,40,80,20", Box{}, false},
+		{"10,40,80:text", Box{}, false},
+		{"10,40,0,20:text", Box{}, false},
+		{"-10,40,80,20:text", Box{}, false},
+		{"10,40,80,x:text", Box{}, false},
+		{"30,0,80,20:text", Box{}, false},
+		{"0,90,50,20:text", Box{}, false},
+	}
+
+	for _, test := range tests {
+		box, err := ParseBox(test.spec)
+		if (err == nil) != test.ok {
+			t.Errorf("ParseBox(%q): got error %v", test.spec, err)
+			continue
+		}
+		if test.ok && box != test.box {
+			t.Errorf("ParseBox(%q) = %+v, want %+v", test.spec, box, test.box)
+		}
+	}
+}
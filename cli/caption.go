@@ -0,0 +1,163 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/mitchellh/go-homedir"
+)
+
+const (
+	openCueSeconds = 1  // The time an open ended cue is shown when it extends the animation.
+	openCueFrames  = 10 // The frames an open ended cue is shown when it extends the animation.
+
+	maxCaptionSeconds = 60   // The longest animation timed captions can make.
+	maxCaptionFrames  = 1000 // The most frames timed captions can make.
+)
+
+var (
+	// Matches a timed caption such as '0-1.5s:text' or '2s- type:text'.
+	cuePattern = regexp.MustCompile(`(?s)^\s*((?:\d+(?:\.\d+)?s?)?-(?:\d+(?:\.\d+)?s?)?)(\s+type)?\s*:(.*)$`)
+)
+
+// Cue is a caption shown during a range of an animation.
+type Cue struct {
+	Range Range
+	Text  string
+	Type  bool
+}
+
+// Parse a timed caption. If the text doesn't start with a range, false is
+// returned. An error is returned if it does but the range is invalid.
+func parseCue(text string) (Cue, bool, error) {
+	m := cuePattern.FindStringSubmatch(text)
+	if m == nil {
+		return Cue{}, false, nil
+	}
+
+	r, err := ParseRange(m[1])
+	if err != nil {
+		return Cue{}, true, err
+	}
+
+	cue := Cue{
+		Range: r,
+		Text:  Unescape(strings.TrimSpace(m[3])),
+		Type:  m[2] != "",
+	}
+
+	return cue, true, nil
+}
+
+// ParseCaptionFile parses a file of timed captions into cues for the top and
+// bottom banners. Each line contains the banner, the range, an optional
+// 'type' keyword and the text, e.g. 'bottom 1.5s- type: BOOM'. Blank lines and
+// lines starting with '#' are ignored.
+func ParseCaptionFile(path string) (top []Cue, bottom []Cue, err error) {
+	path, err = homedir.Expand(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		banner, rest, _ := strings.Cut(text, " ")
+		cue, ok, err := parseCue(rest)
+		if !ok {
+			err = fmt.Errorf("expected 'range: text'")
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		switch banner {
+		case "top":
+			top = append(top, cue)
+		case "bottom":
+			bottom = append(bottom, cue)
+		default:
+			return nil, nil, fmt.Errorf("line %d: unknown banner '%s', expected 'top' or 'bottom'", line, banner)
+		}
+	}
+
+	return top, bottom, scanner.Err()
+}
+
+// CaptionAt returns the text of the cues visible on a frame. The frame is
+// described by its index and the time in seconds at which it's first shown.
+// The length of the animation is used to type out open ended cues.
+func CaptionAt(cues []Cue, index int, elapsed float64, frames int, duration float64) string {
+	var lines []string
+
+	for _, cue := range cues {
+		if !cue.Range.Contains(index, elapsed) {
+			continue
+		}
+
+		text := cue.Text
+		if cue.Type {
+			pos, length := float64(index), float64(frames)
+			if cue.Range.Seconds {
+				pos, length = elapsed, duration
+			}
+
+			// Reveal the text in proportion to the progress through the cue.
+			end := math.Min(cue.Range.End, length)
+			progress := (pos - cue.Range.Start) / (end - cue.Range.Start)
+
+			runes := []rune(text)
+			n := int(math.Floor(progress*float64(len(runes)))) + 1
+			if n > len(runes) || end <= cue.Range.Start {
+				n = len(runes)
+			}
+			text = string(runes[:n])
+		}
+
+		if text != "" {
+			lines = append(lines, text)
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Timed returns true if any timed captions have been specified.
+func (opt *Options) Timed() bool {
+	return len(opt.TopCues) > 0 || len(opt.BottomCues) > 0
+}
+
+// CaptionLength returns the number of frames and seconds needed to show all
+// of the timed captions. Open ended cues are shown for a short while after
+// they start.
+func (opt *Options) CaptionLength() (frames int, seconds float64) {
+	for _, cue := range append(append([]Cue{}, opt.TopCues...), opt.BottomCues...) {
+		end := cue.Range.End
+		if math.IsInf(end, 1) {
+			end = cue.Range.Start + openCueSeconds
+			if !cue.Range.Seconds {
+				end = cue.Range.Start + openCueFrames
+			}
+		}
+		if cue.Range.Seconds {
+			seconds = math.Max(seconds, end)
+		} else if int(end) > frames {
+			frames = int(end)
+		}
+	}
+	return
+}
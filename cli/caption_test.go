@@ -0,0 +1,147 @@
+package cli
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseCue(t *testing.T) {
+	inf := math.Inf(1)
+
+	tests := []struct {
+		text  string
+		cue   Cue
+		timed bool
+		ok    bool
+	}{
+		{"0-10:hello", Cue{Range{0, 10, false, true}, "hello", false}, true, true},
+		{"-1.5s: wait for it", Cue{Range{0, 1.5, true, true}, "wait for it", false}, true, true},
+		{"1.5s- type: BOOM", Cue{Range{1.5, inf, true, true}, "BOOM", true}, true, true},
+		{"0s-2s type:a\\|b", Cue{Range{0, 2, true, true}, "a|b", true}, true, true},
+		{"-:always", Cue{Range{0, inf, false, true}, "always", false}, true, true},
+		{"10-20: 2-1: no", Cue{Range{10, 20, false, true}, "2-1: no", false}, true, true},
+		{"hello", Cue{}, false, true},
+		{"score 2-1", Cue{}, false, true},
+		{"10-5:backwards", Cue{}, true, false},
+		{"0-1.5s:mixed", Cue{Range{0, 1.5, true, true}, "mixed", false}, true, true},
+		{"10\\-20: escaped", Cue{}, false, true},
+	}
+
+	for _, test := range tests {
+		cue, timed, err := parseCue(test.text)
+		if timed != test.timed || (err == nil) != test.ok {
+			t.Errorf("parseCue(%q): got timed %v and error %v", test.text, timed, err)
+			continue
+		}
+		if test.ok && cue != test.cue {
+			t.Errorf("parseCue(%q) = %+v, want %+v", test.text, cue, test.cue)
+		}
+	}
+}
+
+func TestParseTimedText(t *testing.T) {
+	tests := []struct {
+		text string
+		rest string
+		cues int
+	}{
+		{"0-1.5s:wait for it", "", 1},
+		{" 1s- type: BOOM", "", 1},
+		{"0-10:timed", "", 1},
+		{"2-1: we won", "2-1: we won", 0},
+		{"1.5-3: not frames", "1.5-3: not frames", 0},
+		{`10\-20: escaped`, `10\-20: escaped`, 0},
+		{"no range: here", "no range: here", 0},
+	}
+
+	for _, test := range tests {
+		text := test.text
+		cues := parseTimedText(&text)
+		if len(cues) != test.cues || text != test.rest {
+			t.Errorf("parseTimedText(%q) = %d cues and %q, want %d cues and %q", test.text, len(cues), text, test.cues, test.rest)
+		}
+	}
+}
+
+func TestTimedText(t *testing.T) {
+	opt := ParseJob(nil, map[string][]string{"i": {"doge"}, "t": {"0-1.5s:wait for it|1.5s-:BOOM"}})
+
+	top := []Cue{{Range{0, 1.5, true, true}, "wait for it", false}}
+	bottom := []Cue{{Range{1.5, math.Inf(1), true, true}, "BOOM", false}}
+
+	if opt.Top != "" || opt.Bottom != "" {
+		t.Errorf("the timed text was drawn as text: %q, %q", opt.Top, opt.Bottom)
+	}
+	if len(opt.TopCues) != 1 || opt.TopCues[0] != top[0] {
+		t.Errorf("top cues = %+v, want %+v", opt.TopCues, top)
+	}
+	if len(opt.BottomCues) != 1 || opt.BottomCues[0] != bottom[0] {
+		t.Errorf("bottom cues = %+v, want %+v", opt.BottomCues, bottom)
+	}
+
+	opt = ParseJob(nil, map[string][]string{"i": {"doge"}, "t": {`2-1: we won|10\-20: escaped`}})
+	if opt.Top != "2-1: we won" || opt.Bottom != "10-20: escaped" || opt.Timed() {
+		t.Errorf("plain text was timed: %q, %q", opt.Top, opt.Bottom)
+	}
+}
+
+func TestCaptionAt(t *testing.T) {
+	cues := []Cue{
+		{Range{0, 10, false, true}, "frames", false},
+		{Range{1, 2, true, true}, "seconds", false},
+		{Range{0, 4, false, true}, "type", true},
+		{Range{2, math.Inf(1), true, true}, "open", true},
+	}
+
+	tests := []struct {
+		index    int
+		elapsed  float64
+		expected string
+	}{
+		{0, 0, "frames\nt"},
+		{1, 0.1, "frames\nty"},
+		{3, 1.5, "frames\nseconds\ntype"},
+		{4, 2, "frames\no"},
+		{9, 3, "frames\nope"},
+		{10, 3.9, "open"},
+		{20, 10, "open"},
+	}
+
+	for _, test := range tests {
+		text := CaptionAt(cues, test.index, test.elapsed, 20, 4)
+		if text != test.expected {
+			t.Errorf("CaptionAt(%d, %v) = %q, want %q", test.index, test.elapsed, text, test.expected)
+		}
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	inf := math.Inf(1)
+
+	tests := []struct {
+		spec string
+		r    Range
+		ok   bool
+	}{
+		{"10-50", Range{10, 50, false, true}, true},
+		{"1.5s-3s", Range{1.5, 3, true, true}, true},
+		{"-20", Range{0, 20, false, true}, true},
+		{"2s-", Range{2, inf, true, true}, true},
+		{"0-1.5s", Range{0, 1.5, true, true}, true},
+		{"1s-20", Range{1, 20, true, true}, true},
+		{"1.5-3", Range{}, false},
+		{"5-5", Range{}, false},
+		{"10", Range{}, false},
+	}
+
+	for _, test := range tests {
+		r, err := ParseRange(test.spec)
+		if (err == nil) != test.ok {
+			t.Errorf("ParseRange(%q): got error %v", test.spec, err)
+			continue
+		}
+		if test.ok && r != test.r {
+			t.Errorf("ParseRange(%q) = %+v, want %+v", test.spec, r, test.r)
+		}
+	}
+}
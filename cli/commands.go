@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+)
+
+// command is a subcommand of the program.
+type command struct {
+	name    string
+	args    string // The positional arguments.
+	summary string
+	render  bool // Accepts the render options.
+}
+
+// Commands are listed in the order they're shown in the help.
+var commands = []command{
+	{"render", "", "Render a meme from an image. This is the default command.", true},
+	{"animate", "[frame...]", "Render an animated meme from a sequence of images.", true},
+	{"edit", "", "Edit a meme in the terminal with a live preview, then save or upload it.", true},
+	{"batch", "manifest...", "Render the memes listed in yaml, csv or jsonl manifest files.", true},
+	{"delete", "ref...", "Delete uploaded memes using their delete hash or URL.", true},
+	{"serve", "", "Serve an http and gRPC API for rendering memes.", true},
+	{"web", "", "Serve a meme editor for web browsers.", true},
+	{"bot", "", "Serve a Slack, Mattermost and Discord slash command for posting memes in chat.", true},
+	{"templates", "", "List the built-in templates.", false},
+	{"fonts", "", "List the fonts installed on the system.", false},
+	{"completion", "bash|zsh|fish", "Print a shell completion script.", false},
+	{"man", "", "Print the man page.", false},
+	{"help", "[command]", "Show help for a command.", false},
+}
+
+// Shells that completion scripts can be generated for.
+var shells = []string{"bash", "zsh", "fish"}
+
+// Return the named command.
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+// Return the names of all commands.
+func commandNames() []string {
+	var names []string
+	for _, cmd := range commands {
+		names = append(names, cmd.name)
+	}
+	return names
+}
+
+// Return the usage line of a command.
+func (cmd command) usage() string {
+	line := "meme " + cmd.name
+	if cmd.render {
+		line += " [options]"
+	}
+	if cmd.args != "" {
+		line += " " + cmd.args
+	}
+	return line
+}
+
+// Describe the valid values when an argument isn't one of them.
+func oneOf(values []string) string {
+	return fmt.Sprintf("'%s'", strings.Join(values, "', '"))
+}
@@ -0,0 +1,202 @@
+package cli
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"strings"
+	"text/template"
+
+	"github.com/nomad-software/meme/output"
+)
+
+// Flags completed with files or directories instead of values.
+var fileFlags = []string{"o", "outdir", "captions", "text-file", "upload-dir", "cache-dir"}
+
+// The shell completion scripts. Template ids and font names are completed by
+// running the templates and fonts commands.
+var completionScripts = map[string]string{
+	"bash": `# bash completion for meme
+# Add this to ~/.bashrc: source <(meme completion bash)
+
+_meme() {
+    local cur="${COMP_WORDS[COMP_CWORD]}"
+    local prev="${COMP_WORDS[COMP_CWORD-1]}"
+    local IFS=$'\n'
+
+    case "$prev" in
+        -i)
+            COMPREPLY=($(compgen -W "$(meme templates 2>/dev/null)" -- "$cur") $(compgen -f -- "$cur"))
+            return ;;
+        -f)
+            COMPREPLY=($(compgen -W "$(meme fonts 2>/dev/null)" -- "$cur"))
+            return ;;
+        -upload|-webhook-host)
+            COMPREPLY=($(compgen -W "{{lines .Providers}}" -- "$cur"))
+            return ;;
+        -flip)
+            COMPREPLY=($(compgen -W "{{lines .Flips}}" -- "$cur"))
+            return ;;
+        {{join .FileFlags "|"}})
+            COMPREPLY=($(compgen -f -- "$cur"))
+            return ;;
+    esac
+
+    if [[ "${COMP_WORDS[1]}" == "completion" ]]; then
+        COMPREPLY=($(compgen -W "{{lines .Shells}}" -- "$cur"))
+    elif [[ "${COMP_WORDS[1]}" == "help" ]]; then
+        COMPREPLY=($(compgen -W "{{lines .Commands}}" -- "$cur"))
+    elif [[ "$cur" == -* ]]; then
+        COMPREPLY=($(compgen -W "{{lines .Flags}}" -- "$cur"))
+    elif [[ $COMP_CWORD -eq 1 ]]; then
+        COMPREPLY=($(compgen -W "{{lines .Commands}}" -- "$cur"))
+    else
+        COMPREPLY=($(compgen -f -- "$cur"))
+    fi
+}
+
+complete -o filenames -F _meme meme
+`,
+
+	"zsh": `#compdef meme
+# zsh completion for meme
+# Add this to a directory in $fpath as _meme: meme completion zsh > _meme
+
+_meme() {
+    local -a commands flags templates fonts
+    commands=({{range .Described}}
+        '{{.}}'{{end}}
+    )
+    flags=({{join .Flags " "}})
+
+    case "${words[CURRENT-1]}" in
+        -i)
+            templates=(${(f)"$(meme templates 2>/dev/null)"})
+            compadd -a templates
+            _files
+            return ;;
+        -f)
+            fonts=(${(f)"$(meme fonts 2>/dev/null)"})
+            compadd -a fonts
+            return ;;
+        -upload|-webhook-host)
+            compadd {{join .Providers " "}}
+            return ;;
+        -flip)
+            compadd {{join .Flips " "}}
+            return ;;
+        {{join .FileFlags "|"}})
+            _files
+            return ;;
+    esac
+
+    if [[ "${words[2]}" == "completion" ]]; then
+        compadd {{join .Shells " "}}
+    elif [[ "${words[2]}" == "help" ]]; then
+        _describe 'command' commands
+    elif [[ "$PREFIX" == -* ]]; then
+        compadd -a flags
+    elif (( CURRENT == 2 )); then
+        _describe 'command' commands
+    else
+        _files
+    fi
+}
+
+_meme "$@"
+`,
+
+	"fish": `# fish completion for meme
+# Add this to ~/.config/fish/completions: meme completion fish > ~/.config/fish/completions/meme.fish
+
+complete -c meme -f
+{{range .Described}}{{$parts := split . ":"}}complete -c meme -n "__fish_use_subcommand" -a "{{index $parts 0}}" -d "{{index $parts 1}}"
+{{end}}complete -c meme -n "__fish_seen_subcommand_from completion" -a "{{join .Shells " "}}"
+complete -c meme -n "__fish_seen_subcommand_from help" -a "{{join .Commands " "}}"
+complete -c meme -o i -r -F -a "(meme templates 2>/dev/null)" -d "Template, URL or file"
+complete -c meme -o f -x -a "(meme fonts 2>/dev/null)" -d "Font"
+complete -c meme -o upload -x -a "{{join .Providers " "}}" -d "Upload provider"
+complete -c meme -o webhook-host -x -a "{{join .Providers " "}}" -d "Upload provider"
+complete -c meme -o flip -x -a "{{join .Flips " "}}" -d "Flip direction"
+{{range .FileFlags}}complete -c meme -o {{.}} -r -F
+{{end}}{{range .Values}}complete -c meme -o {{.}} -x
+{{end}}{{range .Bools}}complete -c meme -o {{.}}
+{{end}}`,
+}
+
+// completion holds the values used by the completion script templates.
+type completion struct {
+	Commands  []string
+	Described []string
+	Flags     []string
+	Values    []string
+	Bools     []string
+	FileFlags []string
+	Providers []string
+	Flips     []string
+	Shells    []string
+}
+
+// WriteCompletion writes the completion script for the passed shell. The
+// upload providers are passed in as the upload package depends on this one.
+func WriteCompletion(w io.Writer, shell string, providers []string) {
+	c := completion{
+		Commands:  commandNames(),
+		FileFlags: fileFlags,
+		Providers: providers,
+		Flips:     []string{"h", "v", "hv"},
+		Shells:    shells,
+	}
+
+	for _, cmd := range commands {
+		c.Described = append(c.Described, cmd.name+":"+strings.TrimSuffix(cmd.summary, "."))
+	}
+
+	allFlags().VisitAll(func(f *flag.Flag) {
+		c.Flags = append(c.Flags, "-"+f.Name)
+		if isBoolFlag(f) {
+			c.Bools = append(c.Bools, f.Name)
+		} else if !contains(fileFlags, f.Name) && !contains([]string{"i", "f", "upload", "webhook-host", "flip"}, f.Name) {
+			c.Values = append(c.Values, f.Name)
+		}
+	})
+
+	funcs := template.FuncMap{
+		"join":  strings.Join,
+		"split": strings.Split,
+		"lines": func(s []string) string { return strings.Join(s, "\n") },
+	}
+
+	tmpl, err := template.New(shell).Funcs(funcs).Parse(completionScripts[shell])
+	output.OnError(err, "Could not parse completion script")
+
+	var buf bytes.Buffer
+	err = tmpl.Execute(&buf, c)
+	output.OnError(err, "Could not generate completion script")
+
+	_, err = w.Write(buf.Bytes())
+	output.OnError(err, "Could not write completion script")
+}
+
+// Return a flag set containing the flags of every command.
+func allFlags() *flag.FlagSet {
+	var opt Options
+	fs := flag.NewFlagSet("meme", flag.ContinueOnError)
+	newParser(fs, &opt)
+	fs.Int("jobs", 0, "The number of memes to generate at the same time.\nUsed by the batch command.\n")
+	fs.String("addr", "localhost:8080", "The address to listen on.\nUsed by the serve, web and bot commands.\n")
+	fs.String("signing-secret", "", "The signing secret of the Slack app, used to verify requests.\nUsed by the bot command.\n")
+	fs.String("mattermost-token", "", "The token of the Mattermost slash command, used to verify requests.\nUsed by the bot command.\n")
+	fs.String("public-url", "", "The public URL of the bot, used to link the images it hosts.\nUsed by the bot command.\n")
+	fs.String("discord-public-key", "", "The public key of the Discord application, used to verify interactions.\nUsed by the bot command.\n")
+	fs.String("discord-app-id", "", "The id of the Discord application, used to register its commands.\nUsed by the bot command.\n")
+	fs.String("discord-token", "", "The token of the Discord bot, used to register its commands.\nUsed by the bot command.\n")
+	fs.String("discord-guild", "", "Register the Discord commands in this server only.\nUsed by the bot command.\n")
+	return fs
+}
+
+// Return true if the flag doesn't take a value.
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
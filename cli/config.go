@@ -0,0 +1,222 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/nomad-software/meme/output"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	configFile = "config.yaml"
+	configEnv  = "MEME_CONFIG"
+	envPrefix  = "MEME_"
+)
+
+var (
+	config     Config
+	configOnce sync.Once
+)
+
+// Config holds the defaults and presets read from the config file. Values are
+// keyed by flag name.
+type Config struct {
+	Defaults map[string][]string
+	Presets  map[string]map[string][]string
+}
+
+// Return the location of the config file. This can be changed by setting
+// $MEME_CONFIG.
+func configPath() string {
+	if path := os.Getenv(configEnv); path != "" {
+		path, err := homedir.Expand(path)
+		output.OnError(err, "Could not expand path")
+		return path
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "meme", configFile)
+}
+
+// LoadConfig reads the config file. Every key is a default for the flag of
+// the same name, except 'presets' which is a map of named presets. A missing
+// config file is the same as an empty one. The file is only read once.
+//
+//	f: Impact
+//	outdir: ~/Pictures/memes
+//	presets:
+//	  caption-dark:
+//	    color: "#000"
+//	    stroke: "#FFF"
+func LoadConfig() Config {
+	configOnce.Do(func() {
+		config = readConfig(configPath())
+	})
+	return config
+}
+
+// Read and decode the config file.
+func readConfig(path string) Config {
+	cfg := Config{
+		Defaults: make(map[string][]string),
+		Presets:  make(map[string]map[string][]string),
+	}
+
+	if path == "" {
+		return cfg
+	}
+
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return cfg
+	}
+	output.OnError(err, "Could not read config file")
+
+	var fields map[string]interface{}
+	err = yaml.Unmarshal(b, &fields)
+	output.OnError(err, fmt.Sprintf("Could not decode config file %s", path))
+
+	for key, value := range fields {
+		if key != "presets" {
+			cfg.Defaults[flagName(key)] = FlagValues(map[string]interface{}{key: value})[key]
+			continue
+		}
+
+		presets, ok := value.(map[string]interface{})
+		if !ok {
+			output.Error("The config file presets must be a map")
+		}
+
+		for name, preset := range presets {
+			fields, ok := preset.(map[string]interface{})
+			if !ok {
+				output.Error(fmt.Sprintf("The config file preset must be a map: %s", name))
+			}
+
+			values := make(map[string][]string)
+			for key, value := range FlagValues(fields) {
+				values[flagName(key)] = value
+			}
+			cfg.Presets[name] = values
+		}
+	}
+
+	return cfg
+}
+
+// Apply the defaults to every flag not passed on the command line. Defaults
+// are read from the environment, then the config file and then the preset,
+// each overriding the last.
+func (p *parser) applyDefaults() {
+	set := make(map[string]bool)
+	p.fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	values := envValues(p.fs)
+
+	cfg := LoadConfig()
+	for name, value := range cfg.Defaults {
+		values[name] = value
+	}
+
+	preset := p.opt.Preset
+	if !set["preset"] && len(values["preset"]) > 0 {
+		preset = values["preset"][len(values["preset"])-1]
+	}
+
+	if preset != "" {
+		presetValues, ok := cfg.Presets[preset]
+		if !ok {
+			output.Error(fmt.Sprintf("Unknown preset: %s", preset))
+		}
+		for name, value := range presetValues {
+			values[name] = value
+		}
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if p.fs.Lookup(name) == nil {
+			output.Error(fmt.Sprintf("Unknown config field: %s", name))
+		}
+		if set[name] {
+			continue
+		}
+		for _, value := range values[name] {
+			err := p.fs.Set(name, value)
+			output.OnError(err, fmt.Sprintf("Invalid default for -%s", name))
+		}
+	}
+}
+
+// Return the defaults set in the environment. The variable for each flag is
+// its upper case name prefixed with 'MEME_', e.g. $MEME_OUTDIR or $MEME_CID.
+func envValues(fs *flag.FlagSet) map[string][]string {
+	values := make(map[string][]string)
+
+	fs.VisitAll(func(f *flag.Flag) {
+		name := envPrefix + strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
+		if value, ok := os.LookupEnv(name); ok && name != configEnv {
+			values[f.Name] = []string{value}
+		}
+	})
+
+	return values
+}
+
+// Return the flag name for a config or job field, resolving aliases.
+func flagName(key string) string {
+	name := strings.ToLower(strings.TrimSpace(key))
+	if alias, ok := jobAliases[name]; ok {
+		return alias
+	}
+	return name
+}
+
+// FlagValues converts decoded yaml or json fields into flag values. Lists
+// become repeated values.
+func FlagValues(fields map[string]interface{}) map[string][]string {
+	values := make(map[string][]string)
+
+	for key, value := range fields {
+		switch v := value.(type) {
+		case nil:
+		case []interface{}:
+			for _, item := range v {
+				values[key] = append(values[key], flagValue(item))
+			}
+		default:
+			values[key] = []string{flagValue(v)}
+		}
+	}
+
+	return values
+}
+
+// Format a decoded scalar as a flag value.
+func flagValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return fmt.Sprintf("%g", v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
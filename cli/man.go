@@ -0,0 +1,102 @@
+package cli
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// WriteManPage writes the man page in roff format. The upload providers are
+// passed in as the upload package depends on this one.
+func WriteManPage(w io.Writer, providers []string) {
+	b := bufio.NewWriter(w)
+	defer b.Flush()
+
+	fmt.Fprintf(b, ".TH MEME 1 %q \"meme\" \"User Commands\"\n", time.Now().Format("2006-01-02"))
+
+	fmt.Fprintln(b, ".SH NAME")
+	fmt.Fprintln(b, "meme \\- a command line utility for creating memes")
+
+	fmt.Fprintln(b, ".SH SYNOPSIS")
+	fmt.Fprintln(b, ".B meme")
+	fmt.Fprintln(b, "[\\fIcommand\\fR] [\\fIoptions\\fR] [\\fIarguments\\fR]")
+
+	fmt.Fprintln(b, ".SH DESCRIPTION")
+	fmt.Fprintln(b, "Creates memes from built-in templates, image URLs, local files and video clips.")
+	fmt.Fprintln(b, "Memes are saved to disk or uploaded using one of the upload providers:")
+	fmt.Fprintf(b, "%s.\n", roff(strings.Join(providers, ", ")))
+
+	fmt.Fprintln(b, ".SH COMMANDS")
+	for _, cmd := range commands {
+		fmt.Fprintln(b, ".TP")
+		fmt.Fprintf(b, ".B %s\n", roff(cmd.usage()))
+		fmt.Fprintln(b, roff(cmd.summary))
+	}
+
+	fmt.Fprintln(b, ".SH OPTIONS")
+	allFlags().VisitAll(func(f *flag.Flag) {
+		fmt.Fprintln(b, ".TP")
+		if isBoolFlag(f) {
+			fmt.Fprintf(b, "\\fB\\-%s\\fR\n", roff(f.Name))
+		} else {
+			name, _ := flag.UnquoteUsage(f)
+			if name == "" {
+				name = "value"
+			}
+			fmt.Fprintf(b, "\\fB\\-%s\\fR \\fI%s\\fR\n", roff(f.Name), name)
+		}
+
+		usage := strings.Join(strings.Fields(f.Usage), " ")
+		if f.DefValue != "" && f.DefValue != "false" && f.DefValue != "0" {
+			usage += fmt.Sprintf(" Defaults to '%s'.", f.DefValue)
+		}
+		fmt.Fprintln(b, roff(usage))
+	})
+
+	fmt.Fprintln(b, ".SH ENVIRONMENT")
+	fmt.Fprintln(b, ".TP")
+	fmt.Fprintln(b, ".B MEME_CONFIG")
+	fmt.Fprintln(b, "The location of the config file.")
+	fmt.Fprintln(b, ".TP")
+	fmt.Fprintln(b, ".B MEME_*")
+	fmt.Fprintln(b, roff("The default for the option of the same name in upper case, e.g. MEME_OUTDIR or MEME_S3_BUCKET."))
+	fmt.Fprintln(b, ".TP")
+	fmt.Fprintln(b, ".B AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY")
+	fmt.Fprintln(b, "The credentials used by the s3 upload provider.")
+	fmt.Fprintln(b, ".TP")
+	fmt.Fprintln(b, ".B SLACK_SIGNING_SECRET, MATTERMOST_TOKEN, DISCORD_PUBLIC_KEY, DISCORD_TOKEN")
+	fmt.Fprintln(b, "The secrets used by the bot command to verify requests and register commands.")
+	fmt.Fprintln(b, ".TP")
+	fmt.Fprintln(b, ".B HTTPS_PROXY, HTTP_PROXY, NO_PROXY")
+	fmt.Fprintln(b, roff("The proxy used to download images when -proxy is omitted."))
+
+	fmt.Fprintln(b, ".SH FILES")
+	fmt.Fprintln(b, ".TP")
+	fmt.Fprintln(b, ".I ~/.config/meme/config.yaml")
+	fmt.Fprintln(b, roff("Defaults for any option and named presets, overridden by the command line."))
+	fmt.Fprintln(b, ".TP")
+	fmt.Fprintln(b, ".I ~/.config/meme/history.jsonl")
+	fmt.Fprintln(b, "The history of uploaded memes, used to delete them.")
+
+	fmt.Fprintln(b, ".SH EXAMPLES")
+	for _, example := range examples {
+		fmt.Fprintln(b, ".PP")
+		fmt.Fprintln(b, roff(example))
+	}
+
+	fmt.Fprintln(b, ".SH SEE ALSO")
+	fmt.Fprintln(b, "https://github.com/nomad-software/meme")
+}
+
+// Escape text for roff.
+func roff(text string) string {
+	text = strings.ReplaceAll(text, "\\", "\\e")
+	text = strings.ReplaceAll(text, "-", "\\-")
+	if strings.HasPrefix(text, ".") || strings.HasPrefix(text, "'") {
+		text = "\\&" + text
+	}
+	return text
+}
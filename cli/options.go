@@ -1,19 +1,61 @@
 package cli
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"os"
 	"path/filepath"
+	"regexp"
+	"runtime"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/fatih/color"
+	"github.com/nomad-software/meme/cache"
 	"github.com/nomad-software/meme/data"
 	"github.com/nomad-software/meme/output"
 )
 
 var (
 	ImageIds []string
+
+	previewProtocols = []string{"auto", "kitty", "iterm", "sixel", "blocks"}
+	fetchSchemes     = []string{"http", "https"}
+	proxySchemes     = []string{"http", "https", "socks5", "socks5h"}
+
+	examples = []string{
+		"meme -i kirk-khan -t \"|khaaaan\"",
+		"meme -i brace-yourselves -t \"Brace yourselves|The memes are coming!\"",
+		"meme -i http://i.imgur.com/FsWetC0.jpg -t \"|China\"",
+		"meme -i ~/Pictures/face.png -t \"Hello\"",
+		"meme -i ~/Pictures/magic-carpet.png -t \"A whole new world...\" -f Arial",
+		"meme -i ~/Pictures/cat.jpg -crop 1:1 -round 40 -t \"|Nope\"",
+		"meme -i roll-safe -box \"50,5,45,25:can't be late\" -box \"50,70,45,25:if you never leave\"",
+		"meme -shake -i kirk-khan -t \"0-1s:wait for it|1s- type:khaaaan\"",
+		"meme animate -delay 50 -t \"|slideshow\" ~/Pictures/holiday/*.jpg",
+		"meme -i ~/Videos/clip.mp4 -start 3.2 -duration 2 -t \"|nailed it\"",
+		"meme edit -i doge -upload imgur -cid 1234567890",
+		"meme web -addr localhost:8080 -upload imgur -cid 1234567890",
+		"meme bot -addr :8080 -signing-secret abc123 -public-url https://memes.example.com",
+		"meme bot -addr :8080 -discord-public-key 0123abcd -discord-app-id 1234567890 -discord-token xyz",
+		"meme batch -jobs 4 -outdir ~/Pictures/memes jobs.yaml",
+		"meme help batch",
+		"meme templates",
+		"source <(meme completion bash)",
+		"meme delete -cid 1234567890 aBcDeFgHiJkLmNo",
+		"curl -s https://i.imgur.com/FsWetC0.jpg | meme -i - -t \"|China\" -o - | xclip -t image/png -selection clipboard",
+	}
+
+	colorPattern = regexp.MustCompile(`^#?([[:xdigit:]]{3}|[[:xdigit:]]{6}|[[:xdigit:]]{8})$`)
+	cropPattern  = regexp.MustCompile(`^(\d+,\d+,\d+,\d+|\d+(\.\d+)?:\d+(\.\d+)?)$`)
+
+	videoExtensions = []string{".avi", ".m4v", ".mkv", ".mov", ".mp4", ".webm"}
 )
 
 // Initialise the package.
@@ -31,6 +73,9 @@ func init() {
 
 // Options holds the options passed on the command line.
 type Options struct {
+	Animate       bool
+	Delay         int
+	Images        []string
 	Gif           bool
 	Bottom        string
 	ClientID      string
@@ -40,65 +85,711 @@ type Options struct {
 	OutName       string
 	Shake         bool
 	Top           string
+	Boxes         []Box
 	Trigger       bool
 	ListTemplates bool
 	Font          string
+	Crop          string
+	Rotate        float64
+	Flip          string
+	Pad           int
+	PadColor      string
+	Round         int
+	Trim          Range
+	Speed         float64
+	Drop          int
+	Reverse       bool
+	PingPong      bool
+	Loop          int
+	TopCues       []Cue
+	BottomCues    []Cue
+	Start         float64
+	Duration      float64
+	Frame         float64
+	Still         bool
+	Color         string
+	Stroke        string
+	MaxSize       int
+	Preset        string
+	Preview       bool
+	PreviewMode   string
+
+	OutDir            string
+	NameTemplate      string
+	Force             bool
+	Keep              bool
+	Copy              bool
+	JSON              bool
+	Upload            string
+	ImgurToken        string
+	Album             string
+	Title             string
+	Description       string
+	S3Endpoint        string
+	S3Bucket          string
+	S3Region          string
+	S3AccessKey       string
+	S3SecretKey       string
+	S3Prefix          string
+	S3PublicURL       string
+	HTTPURL           string
+	HTTPMethod        string
+	HTTPField         string
+	HTTPHeaders       []string
+	HTTPResponseField string
+	WebhookURL        string
+	WebhookHost       string
+	UploadDir         string
+	UploadDirURL      string
+
+	CacheDir      string
+	CacheSize     int
+	CacheDiskSize int
+	CacheTTL      time.Duration
+
+	FetchTimeout time.Duration
+	MaxDownload  int
+	MaxPixels    int
+	AllowSchemes string
+	AllowHosts   string
+	AllowPrivate bool
+	UserAgent    string
+	Proxy        string
+
+	Workers     int
+	FrameMemory int
+
+	Command  string
+	Args     []string
+	BaseArgs []string
+	Jobs     int
+	Addr     string
+
+	// Set by servers rather than flags. The context stops rendering, such as
+	// when a request's deadline passes, and progress is reported as frames
+	// are rendered.
+	Context  context.Context
+	Progress func(stage string, done int, total int)
+
+	// Set by the batch command. Templates and decals are kept here between
+	// jobs, even when the memory cache is disabled.
+	Embedded *cache.Memory
+
+	SigningSecret    string
+	MattermostToken  string
+	PublicURL        string
+	DiscordPublicKey string
+	DiscordAppID     string
+	DiscordToken     string
+	DiscordGuild     string
+
+	flags *flag.FlagSet
 }
 
-// ParseOptions parses the command line options.
+// ParseOptions parses the command line options. The first argument is the
+// command, which defaults to render when it's omitted.
 func ParseOptions() Options {
-	var opt Options
-	var text string
-
-	flag.BoolVar(&opt.Help, "h", false, "Show help.\n")
-	flag.BoolVar(&opt.Help, "help", false, "Show help.\n")
-	flag.StringVar(&opt.ClientID, "cid", "", "The client id of an application registered with imgur.com.\nIf specified, the new meme will be uploaded to imgur.com.\n(See README for full details.)\n")
-	flag.StringVar(&opt.Image, "i", "", "A built-in template, a URL or the path to a local file.\nYou can also use '-' to read an image from stdin.\n")
-	flag.StringVar(&opt.OutName, "o", "", "The optional name of the output file.\nIf omitted, a temporary file will be created.\n")
-	flag.StringVar(&text, "t", "", "The meme text. Separate the top and bottom banners using a pipe '|'.\n")
-	flag.BoolVar(&opt.Gif, "gif", false, "Gif animations will be preserved and the output will be a gif.\nDoes nothing for other image types.\n")
-	flag.BoolVar(&opt.Shake, "shake", false, "Shake the image to intensify it. Always outputs a gif.\n")
-	flag.BoolVar(&opt.Trigger, "trigger", false, "Shake the image and add a triggered banner. Always outputs a gif.\n")
-	flag.BoolVar(&opt.ListTemplates, "list-templates", false, "List all of the built in templates.\n")
-	flag.StringVar(&opt.Font, "f", "", "The font to use for text rendering. Either a path to a ttf file or name of a font installed on your system.\n")
-	flag.Parse()
-
-	parsed := strings.Split(text, "|")
-	if len(parsed) == 1 {
-		opt.Top = parsed[0]
+	opt := Options{Command: "render"}
+
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		opt.Command = args[0]
+		args = args[1:]
+	}
+
+	help := opt.Command == "help"
+	if help {
+		opt.Command = "render"
+		if len(args) > 0 {
+			opt.Command = args[0]
+			args = args[1:]
+		}
+	}
+
+	cmd, ok := findCommand(opt.Command)
+	if !ok {
+		output.Error(fmt.Sprintf("Unknown command: %s, run 'meme help' for a list of commands", opt.Command))
+	}
+
+	opt.flags = flag.CommandLine
+	opt.flags.Usage = opt.PrintUsage
+
+	if cmd.render {
+		p := newParser(opt.flags, &opt)
+		switch cmd.name {
+		case "batch":
+			opt.flags.IntVar(&opt.Jobs, "jobs", runtime.NumCPU(), "The number of memes to generate at the same time.\n")
+		case "serve", "web":
+			opt.flags.StringVar(&opt.Addr, "addr", "localhost:8080", "The address to listen on.\n")
+		case "bot":
+			opt.flags.StringVar(&opt.Addr, "addr", "localhost:8080", "The address to listen on.\n")
+			opt.flags.StringVar(&opt.SigningSecret, "signing-secret", "", "The signing secret of the Slack app, used to verify requests.\nIf omitted, $SLACK_SIGNING_SECRET is used.\n")
+			opt.flags.StringVar(&opt.MattermostToken, "mattermost-token", "", "The token of the Mattermost slash command, used to verify requests.\nIf omitted, $MATTERMOST_TOKEN is used.\n")
+			opt.flags.StringVar(&opt.PublicURL, "public-url", "", "The public URL of the bot. Required to host images without -upload\nand to add buttons to Mattermost messages.\n")
+			opt.flags.StringVar(&opt.DiscordPublicKey, "discord-public-key", "", "The public key of the Discord application, used to verify interactions.\nIf omitted, $DISCORD_PUBLIC_KEY is used.\n")
+			opt.flags.StringVar(&opt.DiscordAppID, "discord-app-id", "", "The id of the Discord application, used to register its commands.\n")
+			opt.flags.StringVar(&opt.DiscordToken, "discord-token", "", "The token of the Discord bot. If specified, the commands are registered\nwhen the bot starts. If omitted, $DISCORD_TOKEN is used.\n")
+			opt.flags.StringVar(&opt.DiscordGuild, "discord-guild", "", "Register the Discord commands in this server only, which is instant.\n")
+		}
+
+		opt.flags.Parse(args)
+		p.applyDefaults()
+		opt.Args = opt.flags.Args()
+		opt.BaseArgs = args[:len(args)-len(opt.Args)]
+
+		if opt.OutName == "-" {
+			output.InfoToStderr()
+		}
+
+		if cmd.name == "animate" {
+			opt.Animate = true
+		}
+
+		if cmd.name == "render" || cmd.name == "animate" || cmd.name == "edit" {
+			p.finish()
+		}
+
+		if cmd.name == "bot" {
+			if opt.SigningSecret == "" {
+				opt.SigningSecret = os.Getenv("SLACK_SIGNING_SECRET")
+			}
+			if opt.MattermostToken == "" {
+				opt.MattermostToken = os.Getenv("MATTERMOST_TOKEN")
+			}
+			if opt.DiscordPublicKey == "" {
+				opt.DiscordPublicKey = os.Getenv("DISCORD_PUBLIC_KEY")
+			}
+			if opt.DiscordToken == "" {
+				opt.DiscordToken = os.Getenv("DISCORD_TOKEN")
+			}
+		}
 	} else {
-		opt.Top = parsed[0]
-		opt.Bottom = parsed[1]
+		opt.flags.BoolVar(&opt.Help, "h", false, "Show help.\n")
+		opt.flags.BoolVar(&opt.Help, "help", false, "Show help.\n")
+		opt.flags.Parse(args)
+		opt.Args = opt.flags.Args()
+	}
+
+	if help {
+		opt.Help = true
+	}
+
+	if opt.ListTemplates {
+		opt.Command = "templates"
 	}
 
 	return opt
 }
 
+// ParseJob parses the options of a single batch job. The job's values are
+// applied on top of the arguments passed to the batch command. Keys are flag
+// names or one of the longer aliases, such as 'image', 'text' or 'output'.
+func ParseJob(args []string, job map[string][]string) Options {
+	opt := Options{Command: "render"}
+
+	fs := flag.NewFlagSet("job", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	// The options of the batch, serve and bot commands can be used as base
+	// arguments.
+	p := newParser(fs, &opt)
+	fs.Int("jobs", 0, "")
+	fs.String("addr", "", "")
+	fs.String("signing-secret", "", "")
+	fs.String("mattermost-token", "", "")
+	fs.String("public-url", "", "")
+	fs.String("discord-public-key", "", "")
+	fs.String("discord-app-id", "", "")
+	fs.String("discord-token", "", "")
+	fs.String("discord-guild", "", "")
+
+	err := fs.Parse(args)
+	output.OnError(err, "Invalid base arguments")
+
+	keys := make([]string, 0, len(job))
+	for key := range job {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		name := flagName(key)
+
+		switch name {
+		case "frames":
+			opt.Animate = true
+			opt.Images = append(opt.Images, job[key]...)
+			continue
+		case "animate":
+			for _, value := range job[key] {
+				animate, err := strconv.ParseBool(value)
+				output.OnError(err, fmt.Sprintf("Invalid job field %s", key))
+				opt.Animate = animate
+			}
+			continue
+		}
+
+		if fs.Lookup(name) == nil {
+			output.Error(fmt.Sprintf("Unknown job field: %s", key))
+		}
+		for _, value := range job[key] {
+			err := fs.Set(name, value)
+			output.OnError(err, fmt.Sprintf("Invalid job field %s", key))
+		}
+	}
+
+	p.applyDefaults()
+	p.finish()
+	return opt
+}
+
+// Longer names for flags accepted by batch jobs and the config file.
+var jobAliases = map[string]string{
+	"image":  "i",
+	"source": "i",
+	"text":   "t",
+	"output": "o",
+	"font":   "f",
+}
+
+// parser defines the command line flags on a flag set and processes the
+// parsed values into options.
+type parser struct {
+	fs       *flag.FlagSet
+	opt      *Options
+	text     string
+	top      string
+	bottom   string
+	textFile string
+	captions string
+}
+
+// Create a new parser, defining all flags on the passed flag set.
+func newParser(fs *flag.FlagSet, opt *Options) *parser {
+	p := &parser{fs: fs, opt: opt}
+
+	fs.BoolVar(&p.opt.Help, "h", false, "Show help.\n")
+	fs.BoolVar(&p.opt.Help, "help", false, "Show help.\n")
+	fs.StringVar(&p.opt.ClientID, "cid", "", "The client id of an application registered with imgur.com.\nIf specified, the new meme will be uploaded to imgur.com.\n(See README for full details.)\n")
+	fs.Var(imageList{p.opt}, "i", "A built-in template, a URL or the path to a local file. URLs of web pages use\ntheir preview image, data URIs and file URLs are also accepted.\nYou can also use '-' to read an image from stdin, or 'clipboard' to paste one.\nWhen animating, repeat this for each frame or pass a directory or glob pattern.\n")
+	fs.IntVar(&p.opt.Delay, "delay", 50, "The delay between animation frames in 100ths of a second.\nUsed by the animate command.\n")
+	fs.StringVar(&p.opt.OutName, "o", "", "The optional name of the output file. The extension is added if omitted.\nIf omitted, a uniquely named temporary file will be created.\nYou can also use '-' to write the image to stdout.\n")
+	fs.StringVar(&p.opt.OutDir, "outdir", "", "The directory to save memes in, named using the -name template.\n")
+	fs.StringVar(&p.opt.NameTemplate, "name", "", "A template used to name the output file. Supports {template}, {date},\n{time}, {hash} and {ext}. Defaults to '{template}-{date}-{hash}.{ext}'.\n")
+	fs.BoolVar(&p.opt.Force, "force", false, "Overwrite the output file if it already exists.\n")
+	fs.StringVar(&p.text, "t", "", "The meme text. Separate the top and bottom banners using a pipe '|'.\nUse '\\|' for a literal pipe and '\\n' for a line break.\nPrefix a banner with a range to time it, e.g. '0-1.5s:wait for it|1.5s-:BOOM'.\nAdd 'type' after the range to type the text out, e.g. '0-2s type:hello'.\nUse '\\-' to stop text such as '10\\-20: text' being read as a range.\n")
+	fs.StringVar(&p.top, "top", "", "The top banner text, replacing the top banner of -t.\n")
+	fs.StringVar(&p.bottom, "bottom", "", "The bottom banner text, replacing the bottom banner of -t.\n")
+	fs.Var((*boxList)(&p.opt.Boxes), "box", "A text box anywhere on the image, e.g. '10,40,80,20:text'. The left, top, width\nand height are percentages of the image size and the box must fit inside it.\nCan be repeated.\n")
+	fs.StringVar(&p.textFile, "text-file", "", "Read the meme text from a file, or from stdin using '-'.\nLine breaks in the file are kept and '|' separates the banners.\n")
+	fs.StringVar(&p.captions, "captions", "", "A file of timed captions, one per line, e.g. 'bottom 1.5s-: BOOM'.\n")
+	fs.BoolVar(&p.opt.Gif, "gif", false, "Gif animations will be preserved and the output will be a gif.\nDoes nothing for other image types.\n")
+	fs.BoolVar(&p.opt.Shake, "shake", false, "Shake the image to intensify it. Always outputs a gif.\n")
+	fs.BoolVar(&p.opt.Trigger, "trigger", false, "Shake the image and add a triggered banner. Always outputs a gif.\n")
+	fs.BoolVar(&p.opt.ListTemplates, "list-templates", false, "List all of the built in templates.\nDeprecated, use 'meme templates' instead.\n")
+	fs.StringVar(&p.opt.Font, "f", "", "The font to use for text rendering. Either a path to a ttf file or name of a font installed on your system.\n")
+	fs.StringVar(&p.opt.Color, "color", "#FFF", "The hex colour of the text.\n")
+	fs.StringVar(&p.opt.Stroke, "stroke", "#000", "The hex colour of the text border.\n")
+	fs.IntVar(&p.opt.MaxSize, "max-size", 650, "The maximum width or height of the meme in pixels. Larger images are resized.\n")
+	fs.StringVar(&p.opt.Preset, "preset", "", "A named preset of options from the config file, e.g. 'caption-dark'.\n(See README for full details.)\n")
+	fs.StringVar(&p.opt.Crop, "crop", "", "Crop the image before drawing. Either a rectangle 'x,y,w,h' in pixels\nor an aspect ratio 'w:h' cropped from the centre.\n")
+	fs.Float64Var(&p.opt.Rotate, "rotate", 0, "Rotate the image clockwise by this many degrees.\n")
+	fs.StringVar(&p.opt.Flip, "flip", "", "Mirror the image. Either 'h' (horizontal), 'v' (vertical) or 'hv' (both).\n")
+	fs.IntVar(&p.opt.Pad, "pad", 0, "Pad the image on all sides by this many pixels.\n")
+	fs.StringVar(&p.opt.PadColor, "pad-color", "", "The hex colour used for padding and corners exposed by rotation.\nIf omitted, these areas will be transparent.\n")
+	fs.IntVar(&p.opt.Round, "round", 0, "Round the corners of the image using this radius in pixels.\n")
+	fs.Var(&p.opt.Trim, "trim", "Only keep the animation frames within a range, e.g. '10-50' (frames)\nor '1.5-3s' (seconds). Either side can be omitted, and a side without\na unit uses the unit of the other.\n")
+	fs.Float64Var(&p.opt.Speed, "speed", 1, "Change the animation playback speed, e.g. '2' is twice as fast.\n")
+	fs.IntVar(&p.opt.Drop, "drop", 0, "Drop every nth animation frame to reduce the file size.\n")
+	fs.BoolVar(&p.opt.Reverse, "reverse", false, "Reverse the animation.\n")
+	fs.BoolVar(&p.opt.PingPong, "pingpong", false, "Play the animation forwards then backwards.\n")
+	fs.IntVar(&p.opt.Loop, "loop", -1, "The number of times the animation plays, '0' loops forever.\nIf omitted, the loop count of the source is kept.\n")
+	fs.Float64Var(&p.opt.Start, "start", 0, "The time in seconds to start extracting frames from a video clip.\n")
+	fs.Float64Var(&p.opt.Duration, "duration", 0, "The number of seconds of a video clip to extract.\nIf omitted, 3 seconds are extracted.\n")
+	fs.Float64Var(&p.opt.Frame, "frame", 0, "Extract a single still frame at this time in seconds from a video clip.\n")
+	fs.StringVar(&p.opt.Upload, "upload", "", "Upload the new meme using a provider instead of saving it.\nOne of 'imgur', 's3', 'http', 'discord', 'slack', 'mattermost' or 'dir'.\n(See README for full details.)\n")
+	fs.BoolVar(&p.opt.Keep, "keep", false, "Keep a local copy of uploaded memes. Implied when using -o.\n")
+	fs.BoolVar(&p.opt.Preview, "preview", false, "Show the meme in the terminal, playing animations a few times.\n")
+	fs.StringVar(&p.opt.PreviewMode, "preview-protocol", "auto", "How the preview is drawn. One of 'auto', 'kitty', 'iterm', 'sixel' or 'blocks'.\n")
+	fs.BoolVar(&p.opt.Copy, "copy", false, "Copy the result to the clipboard. The URL is copied when uploading,\notherwise the image itself is copied.\n")
+	fs.BoolVar(&p.opt.JSON, "json", false, "Print the result as json, including the file, URL, dimensions,\nframe count, byte size and format.\n")
+	fs.StringVar(&p.opt.ImgurToken, "imgur-token", "", "An imgur OAuth access token. If specified, memes are uploaded to your account.\n")
+	fs.StringVar(&p.opt.Album, "album", "", "The imgur album to add uploaded memes to.\nAnonymous uploads must use the album's delete hash.\n")
+	fs.StringVar(&p.opt.Title, "title", "", "The title of the uploaded meme.\n")
+	fs.StringVar(&p.opt.Description, "desc", "", "The description of the uploaded meme.\n")
+	fs.StringVar(&p.opt.S3Endpoint, "s3-endpoint", "https://s3.amazonaws.com", "The endpoint of the S3 compatible object storage.\n")
+	fs.StringVar(&p.opt.S3Bucket, "s3-bucket", "", "The bucket to upload to using the s3 provider.\n")
+	fs.StringVar(&p.opt.S3Region, "s3-region", "us-east-1", "The region of the S3 bucket.\n")
+	fs.StringVar(&p.opt.S3AccessKey, "s3-access-key", "", "The S3 access key. If omitted, $AWS_ACCESS_KEY_ID is used.\n")
+	fs.StringVar(&p.opt.S3SecretKey, "s3-secret-key", "", "The S3 secret key. If omitted, $AWS_SECRET_ACCESS_KEY is used.\n")
+	fs.StringVar(&p.opt.S3Prefix, "s3-prefix", "", "A path prefix for objects uploaded to the S3 bucket.\n")
+	fs.StringVar(&p.opt.S3PublicURL, "s3-public-url", "", "The public base URL of the S3 bucket used for links.\nIf omitted, the endpoint and bucket are used.\n")
+	fs.StringVar(&p.opt.HTTPURL, "http-url", "", "The URL to upload to using the http provider.\nA URL ending in '/' has the file name appended when using PUT.\n")
+	fs.StringVar(&p.opt.HTTPMethod, "http-method", "PUT", "The http provider method. PUT sends the raw image, POST sends a multipart form.\n")
+	fs.StringVar(&p.opt.HTTPField, "http-field", "file", "The multipart form field containing the image when using POST.\n")
+	fs.Var((*stringList)(&p.opt.HTTPHeaders), "http-header", "A header to send with http provider uploads, e.g. 'Authorization: Bearer xyz'.\nCan be repeated.\n")
+	fs.StringVar(&p.opt.HTTPResponseField, "http-response-field", "", "The json field of the http provider response containing the URL, e.g. 'data.url'.\nIf omitted, the location header or the upload URL is used.\n")
+	fs.StringVar(&p.opt.WebhookURL, "webhook-url", "", "The webhook URL used by the discord, slack and mattermost providers.\n")
+	fs.StringVar(&p.opt.WebhookHost, "webhook-host", "", "The provider used to host images posted to slack and mattermost webhooks.\n")
+	fs.StringVar(&p.opt.UploadDir, "upload-dir", "", "The directory to copy memes into using the dir provider.\n")
+	fs.StringVar(&p.opt.UploadDirURL, "upload-dir-url", "", "The public base URL of the upload directory used for links.\n")
+	fs.StringVar(&p.opt.CacheDir, "cache-dir", "", "A directory to cache downloaded images and rendered memes in, shared between runs.\nIf omitted, they are only cached in memory.\n")
+	fs.IntVar(&p.opt.CacheSize, "cache-size", 256, "The maximum size of the memory cache in megabytes. '0' disables it.\n")
+	fs.IntVar(&p.opt.CacheDiskSize, "cache-disk-size", 1024, "The maximum size of the cache directory in megabytes.\n")
+	fs.DurationVar(&p.opt.FetchTimeout, "fetch-timeout", 30*time.Second, "How long downloading an image or video can take, e.g. '10s'.\n")
+	fs.IntVar(&p.opt.MaxDownload, "max-download", 50, "The maximum size of a downloaded image or video in megabytes.\n")
+	fs.IntVar(&p.opt.MaxPixels, "max-pixels", 100, "The maximum number of pixels in an image in millions, counting every frame\nof a gif and any padding or rotation. Larger images are rejected before they're decoded.\n")
+	fs.StringVar(&p.opt.AllowSchemes, "allow-schemes", "http,https", "The URL schemes images can be downloaded with, separated by commas.\n")
+	fs.StringVar(&p.opt.AllowHosts, "allow-hosts", "", "Only download images from these hosts, separated by commas. A leading '*.'\nmatches sub domains, e.g. '*.imgur.com'. If omitted, any host is allowed.\n")
+	fs.BoolVar(&p.opt.AllowPrivate, "allow-private", false, "Allow downloading from private, loopback and link local addresses.\nThese are blocked so servers can't be used to reach internal services.\n")
+	fs.StringVar(&p.opt.UserAgent, "user-agent", "meme (+https://github.com/nomad-software/meme)", "The User-Agent header sent when downloading images.\n")
+	fs.StringVar(&p.opt.Proxy, "proxy", "", "The proxy used to download images, e.g. 'http://proxy:3128'.\nIf omitted, $HTTPS_PROXY and $HTTP_PROXY are used.\n")
+	fs.IntVar(&p.opt.Workers, "workers", runtime.GOMAXPROCS(0), "The number of gif frames to process at the same time.\n")
+	fs.IntVar(&p.opt.FrameMemory, "frame-memory", 512, "The memory in megabytes that gif frames processed at the same time can use.\nFewer frames of large gifs are processed at once to stay within it.\n")
+	fs.DurationVar(&p.opt.CacheTTL, "cache-ttl", 24*time.Hour, "How long cached images and memes are kept, e.g. '30m' or '48h'.\n'0' keeps them until the cache is full.\n")
+
+	return p
+}
+
+// Process the parsed flags into the options.
+func (p *parser) finish() {
+	opt := p.opt
+
+	if opt.Upload == "" && (opt.ClientID != "" || opt.ImgurToken != "") {
+		opt.Upload = "imgur"
+	}
+
+	p.fs.Visit(func(f *flag.Flag) {
+		if f.Name == "frame" {
+			opt.Still = true
+		}
+	})
+
+	if opt.IsVideo() && !opt.Still {
+		opt.Gif = true
+	}
+
+	if opt.Animate {
+		opt.Images = append(opt.Images, p.fs.Args()...)
+		opt.Gif = true
+	}
+
+	if p.textFile != "" {
+		if p.text != "" {
+			output.Error("Use either -t or -text-file, not both")
+		}
+		if p.textFile == "-" && opt.Image == "-" {
+			output.Error("Only one of the image or the text can be read from stdin")
+		}
+		p.text = readText(p.textFile)
+	}
+
+	parsed := SplitText(p.text)
+	if len(parsed) > banners {
+		output.Error(fmt.Sprintf("The text has %d banners but a meme only has %d, use '\\|' for a literal pipe", len(parsed), banners))
+	}
+
+	opt.Top = parsed[0]
+	if len(parsed) > 1 {
+		opt.Bottom = parsed[1]
+	}
+
+	// Separate top and bottom texts replace the banners of the combined text.
+	if p.top != "" {
+		opt.Top = p.top
+	}
+	if p.bottom != "" {
+		opt.Bottom = p.bottom
+	}
+
+	opt.TopCues = parseTimedText(&opt.Top)
+	opt.BottomCues = parseTimedText(&opt.Bottom)
+	opt.Top = Unescape(opt.Top)
+	opt.Bottom = Unescape(opt.Bottom)
+
+	if p.captions != "" {
+		top, bottom, err := ParseCaptionFile(p.captions)
+		output.OnError(err, "Could not read captions file")
+		opt.TopCues = append(opt.TopCues, top...)
+		opt.BottomCues = append(opt.BottomCues, bottom...)
+	}
+}
+
+// Parse the banner text as a timed caption, which starts with a range, e.g.
+// '0-1.5s:text'. If it's timed, the text is cleared and the cue is returned
+// instead. Text that only looks like a range, such as '2-1: we won', isn't
+// timed, and '\-' stops a range being read, e.g. '10\-20: text'.
+func parseTimedText(text *string) []Cue {
+	cue, ok, err := parseCue(*text)
+	if !ok || err != nil {
+		return nil
+	}
+
+	*text = ""
+	return []Cue{cue}
+}
+
+// IsVideo returns true if the image is a video clip.
+func (opt *Options) IsVideo() bool {
+	name := opt.Image
+	if u, err := url.Parse(name); err == nil && strings.HasPrefix(u.Scheme, "http") {
+		name = u.Path
+	}
+
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, e := range videoExtensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// imageList collects every image passed using the -i flag. The last image is
+// also stored as the single image to use when not animating.
+type imageList struct {
+	opt *Options
+}
+
+// String implements the flag.Value interface.
+func (l imageList) String() string {
+	if l.opt == nil {
+		return ""
+	}
+	return l.opt.Image
+}
+
+// Set implements the flag.Value interface.
+func (l imageList) Set(image string) error {
+	l.opt.Image = image
+	l.opt.Images = append(l.opt.Images, image)
+	return nil
+}
+
+// stringList collects every value of a repeated flag.
+type stringList []string
+
+// String implements the flag.Value interface.
+func (l *stringList) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ", ")
+}
+
+// Set implements the flag.Value interface.
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
 // Valid validates the command line options and returns true if they are valid,
 // false if not.
 func (opt *Options) Valid() bool {
+	if opt.CacheSize < 0 || opt.CacheDiskSize < 0 || opt.CacheTTL < 0 {
+		output.Error("The cache sizes and TTL must not be negative")
+	}
+
+	if opt.FetchTimeout <= 0 || opt.MaxDownload < 1 || opt.MaxPixels < 1 {
+		output.Error("The fetch timeout, maximum download size and maximum pixels must be greater than zero")
+	}
 
-	if opt.Image == "" {
-		output.Error("An image is required")
+	if opt.Workers < 1 || opt.FrameMemory < 1 {
+		output.Error("The number of workers and frame memory must be greater than zero")
 	}
 
-	if !(opt.Gif || opt.Trigger || opt.Shake) && opt.OutName != "" {
-		if !strings.HasSuffix(strings.ToLower(opt.OutName), ".png") {
-			output.Error("The output file name must have the suffix of .png")
+	for _, scheme := range strings.Split(opt.AllowSchemes, ",") {
+		if !contains(fetchSchemes, strings.ToLower(strings.TrimSpace(scheme))) {
+			output.Error(fmt.Sprintf("The allowed schemes must be one or more of %s", oneOf(fetchSchemes)))
 		}
 	}
 
-	if (opt.Gif || opt.Trigger || opt.Shake) && opt.OutName != "" {
-		if !strings.HasSuffix(strings.ToLower(opt.OutName), ".gif") {
-			output.Error("The output file name must have the suffix of .gif")
+	if opt.Proxy != "" {
+		if u, err := url.Parse(opt.Proxy); err != nil || u.Host == "" || !contains(proxySchemes, u.Scheme) {
+			output.Error(fmt.Sprintf("The proxy must be a URL using %s", oneOf(proxySchemes)))
+		}
+	}
+
+	switch opt.Command {
+	case "batch":
+		if len(opt.Args) == 0 {
+			output.Error("At least one manifest file is required")
+		}
+		if opt.Jobs < 1 {
+			output.Error("The number of jobs must be at least 1")
+		}
+		return true
+
+	case "delete":
+		if len(opt.Args) == 0 {
+			output.Error("A delete hash or uploaded URL is required")
 		}
+		return true
+
+	case "completion":
+		if len(opt.Args) != 1 || !contains(shells, opt.Args[0]) {
+			output.Error(fmt.Sprintf("A shell is required, one of %s", oneOf(shells)))
+		}
+		return true
+
+	case "serve", "web":
+		if opt.Addr == "" {
+			output.Error("An address to listen on is required")
+		}
+		opt.noArgs()
+		return true
+
+	case "bot":
+		if opt.Addr == "" {
+			output.Error("An address to listen on is required")
+		}
+		if opt.SigningSecret == "" && opt.MattermostToken == "" && opt.DiscordPublicKey == "" {
+			output.Error("A Slack signing secret (-signing-secret), Mattermost token (-mattermost-token) or Discord public key (-discord-public-key) is required")
+		}
+		if opt.DiscordToken != "" && opt.DiscordAppID == "" {
+			output.Error("Registering the Discord commands requires the application id (-discord-app-id)")
+		}
+		if opt.PublicURL != "" && !strings.HasPrefix(opt.PublicURL, "http://") && !strings.HasPrefix(opt.PublicURL, "https://") {
+			output.Error("The public URL must be an http or https URL")
+		}
+		opt.noArgs()
+		return true
+
+	case "templates", "fonts", "man":
+		opt.noArgs()
+		return true
+
+	case "edit":
+		if opt.Image == "-" || opt.OutName == "-" {
+			output.Error("The edit command uses the terminal, so images can't be read from stdin or written to stdout")
+		}
+		opt.noArgs()
+
+	case "animate":
+		if len(opt.Images) == 0 {
+			output.Error("At least one animation frame is required")
+		}
+		if opt.Delay < 1 {
+			output.Error("The frame delay must be at least 1")
+		}
+
+	default:
+		if opt.Image == "" {
+			output.Error("An image is required, use -i to pass a template, URL or file")
+		}
+		opt.noArgs()
+	}
+
+	if !validColor(opt.Color) || !validColor(opt.Stroke) || !validColor(opt.PadColor) {
+		output.Error("Colours must be hex values such as '#FFF' or '#FF000080'")
+	}
+
+	if opt.Crop != "" && !cropPattern.MatchString(opt.Crop) {
+		output.Error("The crop must be a rectangle 'x,y,w,h' or an aspect ratio 'w:h'")
+	}
+
+	if !contains(previewProtocols, opt.PreviewMode) {
+		output.Error(fmt.Sprintf("The preview protocol must be one of %s", oneOf(previewProtocols)))
+	}
+
+	if opt.Loop < -1 {
+		output.Error("The loop count must not be negative")
+	}
+
+	if opt.Flip != "" && opt.Flip != "h" && opt.Flip != "v" && opt.Flip != "hv" && opt.Flip != "vh" {
+		output.Error("The flip direction must be 'h', 'v' or 'hv'")
+	}
+
+	if opt.Start < 0 || opt.Duration < 0 || opt.Frame < 0 {
+		output.Error("Video times must not be negative")
+	}
+
+	if opt.Speed <= 0 {
+		output.Error("The animation speed must be greater than zero")
+	}
+
+	if opt.Drop < 0 {
+		output.Error("The number of frames to drop must not be negative")
+	}
+
+	if opt.Drop == 1 {
+		output.Error("Dropping every frame would leave nothing to animate")
+	}
+
+	if opt.MaxSize < 1 {
+		output.Error("The maximum size must be at least 1")
+	}
+
+	if opt.Pad < 0 || opt.Round < 0 {
+		output.Error("The padding and corner radius must not be negative")
+	}
+
+	// Padding adds at least this many pixels to any image, so it's rejected
+	// before anything is loaded. The size of the transformed image is checked
+	// again once the size of the source is known.
+	maxPixels := float64(opt.MaxPixels) * 1000000
+	if 4*float64(opt.Pad)*float64(opt.Pad) > maxPixels || 4*float64(opt.Round)*float64(opt.Round) > maxPixels {
+		output.Error(fmt.Sprintf("The padding and corner radius are too large, the maximum is %d million pixels", opt.MaxPixels))
+	}
+
+	if math.IsNaN(opt.Rotate) || math.IsInf(opt.Rotate, 0) {
+		output.Error("The rotation must be a number of degrees")
+	}
+
+	// Timed captions can turn an image into a long animation, so its length is
+	// limited before any frames are made.
+	if frames, seconds := opt.CaptionLength(); frames > maxCaptionFrames || seconds > maxCaptionSeconds {
+		output.Error(fmt.Sprintf("Timed captions can be at most %d frames or %d seconds long", maxCaptionFrames, maxCaptionSeconds))
+	}
+
+	animated := opt.Gif || opt.Trigger || opt.Shake || opt.Timed()
+
+	// Output names without an extension have the correct one added.
+	ext := strings.ToLower(filepath.Ext(opt.OutName))
+
+	if !animated && ext != "" && ext != ".png" {
+		output.Error("The output file name must have the suffix of .png")
+	}
+
+	if animated && ext != "" && ext != ".gif" {
+		output.Error("The output file name must have the suffix of .gif")
 	}
 
 	return true
 }
 
+// Fail if any unexpected positional arguments were passed. These are usually
+// flags passed after an argument, which stops flag parsing.
+func (opt *Options) noArgs() {
+	if len(opt.Args) > 0 {
+		output.Error(fmt.Sprintf("Unexpected argument: %s, options must come before arguments", opt.Args[0]))
+	}
+}
+
+// Return true if the passed string is a valid colour.
+func validColor(c string) bool {
+	return c == "" || c == "transparent" || colorPattern.MatchString(c)
+}
+
+// Return true if the list contains the value.
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
 // PrintUsage prints who to use this command.
 func (opt *Options) PrintUsage() {
+	if cmd, ok := findCommand(opt.Command); ok && cmd.name != "render" {
+		fmt.Printf("  Usage: %s\n\n", cmd.usage())
+		fmt.Printf("  %s\n\n", cmd.summary)
+		opt.flags.PrintDefaults()
+		return
+	}
+
 	var banner = ` _ __ ___   ___ _ __ ___   ___
 | '_ ' _ \ / _ \ '_ ' _ \ / _ \
 | | | | | |  __/ | | | | |  __/
@@ -107,7 +798,19 @@ func (opt *Options) PrintUsage() {
 `
 	color.Green(banner)
 	fmt.Println("")
-	flag.Usage()
+	fmt.Println("  Usage: meme [command] [options] [arguments]")
+	fmt.Println("")
+
+	fmt.Println("  Commands")
+	fmt.Println("")
+	for _, cmd := range commands {
+		fmt.Fprintln(output.Stdout, color.CyanString("    %-30s", cmd.name)+cmd.summary)
+	}
+	fmt.Println("")
+
+	fmt.Println("  Options")
+	fmt.Println("")
+	opt.flags.PrintDefaults()
 	fmt.Println("")
 
 	fmt.Println("  Templates")
@@ -128,10 +831,8 @@ func (opt *Options) PrintUsage() {
 
 	fmt.Println("  Examples")
 	fmt.Println("")
-	color.Cyan("    meme -i kirk-khan -t \"|khaaaan\"")
-	color.Cyan("    meme -i brace-yourselves -t \"Brace yourselves|The memes are coming!\"")
-	color.Cyan("    meme -i http://i.imgur.com/FsWetC0.jpg -t \"|China\"")
-	color.Cyan("    meme -i ~/Pictures/face.png -t \"Hello\"")
-	color.Cyan("    meme -i ~/Pictures/magic-carpet.png -t \"A whole new world...\" -f Arial")
+	for _, example := range examples {
+		color.Cyan("    %s", example)
+	}
 	fmt.Println("")
 }
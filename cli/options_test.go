@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"testing"
+
+	"github.com/nomad-software/meme/output"
+)
+
+func TestValidTransforms(t *testing.T) {
+	tests := []struct {
+		values map[string][]string
+		ok     bool
+	}{
+		{map[string][]string{"pad": {"20"}, "round": {"40"}, "rotate": {"45"}}, true},
+		{map[string][]string{"pad": {"4000"}}, true},
+		{map[string][]string{"pad": {"100000"}}, false},
+		{map[string][]string{"pad": {"-1"}}, false},
+		{map[string][]string{"round": {"100000"}}, false},
+		{map[string][]string{"pad": {"100000"}, "max-pixels": {"100000"}}, true},
+		{map[string][]string{"rotate": {"NaN"}}, false},
+		{map[string][]string{"rotate": {"Inf"}}, false},
+	}
+
+	for _, test := range tests {
+		test.values["i"] = []string{"doge"}
+		err := output.Catch(func() {
+			opt := ParseJob(nil, test.values)
+			opt.Valid()
+		})
+		if (err == nil) != test.ok {
+			t.Errorf("%v: got error %v", test.values, err)
+		}
+	}
+}
+
+func TestValidCaptionLength(t *testing.T) {
+	tests := []struct {
+		text string
+		ok   bool
+	}{
+		{"0-1.5s:wait for it|1.5s-:BOOM", true},
+		{"0-60s:long", true},
+		{"-2000s:x", false},
+		{"59.5s-:x", false},
+		{"0-1000:frames", true},
+		{"0-5000:frames", false},
+	}
+
+	for _, test := range tests {
+		err := output.Catch(func() {
+			opt := ParseJob(nil, map[string][]string{"i": {"doge"}, "t": {test.text}})
+			opt.Valid()
+		})
+		if (err == nil) != test.ok {
+			t.Errorf("%q: got error %v", test.text, err)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package cli
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Range is a span of an animation measured in either frames or seconds.
+// The start is inclusive and the end is exclusive.
+type Range struct {
+	Start   float64
+	End     float64
+	Seconds bool
+	set     bool
+}
+
+// ParseRange parses a range such as '10-20' (frames), '0-1.5s' (seconds) or
+// '2s-' (open ended). Either side of the range can be omitted, and a side
+// without a unit uses the unit of the other.
+func ParseRange(spec string) (Range, error) {
+	r := Range{End: math.Inf(1), set: true}
+
+	start, end, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return r, fmt.Errorf("invalid range '%s', expected 'start-end'", spec)
+	}
+
+	// A unit on either side makes the whole range seconds, e.g. '0-1.5s'.
+	r.Seconds = strings.HasSuffix(start, "s") || strings.HasSuffix(end, "s")
+
+	var err error
+	if start != "" {
+		r.Start, err = parseRangeValue(start, r.Seconds)
+		if err != nil {
+			return r, fmt.Errorf("invalid range '%s': %w", spec, err)
+		}
+	}
+
+	if end != "" {
+		r.End, err = parseRangeValue(end, r.Seconds)
+		if err != nil {
+			return r, fmt.Errorf("invalid range '%s': %w", spec, err)
+		}
+	}
+
+	if r.End <= r.Start {
+		return r, fmt.Errorf("invalid range '%s', the end must be after the start", spec)
+	}
+
+	return r, nil
+}
+
+// Parse one side of a range.
+func parseRangeValue(s string, seconds bool) (float64, error) {
+	if seconds {
+		v, err := strconv.ParseFloat(strings.TrimSuffix(s, "s"), 64)
+		if err == nil && v < 0 {
+			err = fmt.Errorf("negative time")
+		}
+		return v, err
+	}
+
+	v, err := strconv.Atoi(s)
+	if err == nil && v < 0 {
+		err = fmt.Errorf("negative frame")
+	}
+	return float64(v), err
+}
+
+// IsSet returns true if the range has been parsed from a specification.
+func (r *Range) IsSet() bool {
+	return r.set
+}
+
+// Contains returns true if a frame is inside the range. The frame is described
+// by its index and the time in seconds at which it is first shown.
+func (r *Range) Contains(index int, elapsed float64) bool {
+	v := float64(index)
+	if r.Seconds {
+		v = elapsed
+	}
+	return v >= r.Start && v < r.End
+}
+
+// String implements the flag.Value interface.
+func (r *Range) String() string {
+	if r == nil || !r.set {
+		return ""
+	}
+
+	unit := ""
+	if r.Seconds {
+		unit = "s"
+	}
+
+	s := strconv.FormatFloat(r.Start, 'f', -1, 64) + unit + "-"
+	if !math.IsInf(r.End, 1) {
+		s += strconv.FormatFloat(r.End, 'f', -1, 64) + unit
+	}
+	return s
+}
+
+// Set implements the flag.Value interface.
+func (r *Range) Set(spec string) error {
+	parsed, err := ParseRange(spec)
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
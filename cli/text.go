@@ -0,0 +1,81 @@
+package cli
+
+import (
+	"io"
+	"os"
+	"strings"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/nomad-software/meme/output"
+)
+
+const (
+	banners = 2 // The number of text boxes, top and bottom.
+)
+
+// SplitText splits the meme text into banners at each unescaped pipe. The
+// banners keep their escapes so they can be parsed further.
+func SplitText(text string) []string {
+	var parts []string
+	var b strings.Builder
+
+	for i := 0; i < len(text); i++ {
+		switch {
+		case text[i] == '\\' && i+1 < len(text):
+			b.WriteByte(text[i])
+			b.WriteByte(text[i+1])
+			i++
+		case text[i] == '|':
+			parts = append(parts, b.String())
+			b.Reset()
+		default:
+			b.WriteByte(text[i])
+		}
+	}
+
+	return append(parts, b.String())
+}
+
+// Unescape replaces the escapes in the meme text. '\n' is a line break and a
+// backslash before any other character is replaced by that character, so '\|'
+// is a literal pipe and '\\' is a backslash.
+func Unescape(text string) string {
+	if !strings.Contains(text, `\`) {
+		return text
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\\' && i+1 < len(text) {
+			i++
+			if text[i] == 'n' {
+				b.WriteByte('\n')
+			} else {
+				b.WriteByte(text[i])
+			}
+			continue
+		}
+		b.WriteByte(text[i])
+	}
+
+	return b.String()
+}
+
+// Read the meme text from a file, or from stdin if the path is '-'. The
+// trailing line break is removed.
+func readText(path string) string {
+	var b []byte
+	var err error
+
+	if path == "-" {
+		b, err = io.ReadAll(os.Stdin)
+		output.OnError(err, "Could not read text from stdin")
+	} else {
+		path, err = homedir.Expand(path)
+		output.OnError(err, "Could not expand path")
+		b, err = os.ReadFile(path)
+		output.OnError(err, "Could not read text file")
+	}
+
+	return strings.TrimRight(string(b), "\r\n")
+}
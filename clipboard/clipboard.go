@@ -0,0 +1,104 @@
+package clipboard
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+
+	"github.com/nomad-software/meme/output"
+)
+
+// WriteText copies text to the system clipboard.
+func WriteText(text string) {
+	var cmd *exec.Cmd
+
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("pbcopy")
+	case "windows":
+		cmd = exec.Command("clip")
+	default:
+		if tool, args := linuxTool("text/plain"); tool != "" {
+			cmd = exec.Command(tool, args...)
+		}
+	}
+
+	run(cmd, []byte(text))
+}
+
+// WriteImage copies an image to the system clipboard.
+func WriteImage(data []byte, contentType string, ext string) {
+	var cmd *exec.Cmd
+
+	switch runtime.GOOS {
+	case "darwin", "windows":
+		// These tools can only copy images from files.
+		file, err := os.CreateTemp("", "meme-clipboard-*."+ext)
+		output.OnError(err, "Could not create temporary file")
+		defer os.Remove(file.Name())
+
+		_, err = file.Write(data)
+		file.Close()
+		output.OnError(err, "Could not write temporary file")
+
+		path, _ := filepath.Abs(file.Name())
+		if runtime.GOOS == "darwin" {
+			script := fmt.Sprintf(`set the clipboard to (read (POSIX file %q) as «class PNGf»)`, path)
+			if ext == "gif" {
+				script = fmt.Sprintf(`set the clipboard to (read (POSIX file %q) as GIF picture)`, path)
+			}
+			cmd = exec.Command("osascript", "-e", script)
+		} else {
+			script := fmt.Sprintf(`Add-Type -AssemblyName System.Windows.Forms; [Windows.Forms.Clipboard]::SetImage([Drawing.Image]::FromFile('%s'))`, path)
+			cmd = exec.Command("powershell", "-NoProfile", "-Command", script)
+		}
+		data = nil
+
+	default:
+		if tool, args := linuxTool(contentType); tool != "" {
+			cmd = exec.Command(tool, args...)
+		}
+	}
+
+	run(cmd, data)
+}
+
+// Find a clipboard tool on Linux and the arguments to copy the content type.
+func linuxTool(contentType string) (string, []string) {
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		if _, err := exec.LookPath("wl-copy"); err == nil {
+			return "wl-copy", []string{"--type", contentType}
+		}
+	}
+
+	if _, err := exec.LookPath("xclip"); err == nil {
+		return "xclip", []string{"-selection", "clipboard", "-t", contentType}
+	}
+
+	if _, err := exec.LookPath("xsel"); err == nil && contentType == "text/plain" {
+		return "xsel", []string{"--clipboard", "--input"}
+	}
+
+	return "", nil
+}
+
+// Run the clipboard command, passing the data to its stdin.
+func run(cmd *exec.Cmd, data []byte) {
+	if cmd == nil {
+		output.Error("No clipboard tool found, install wl-clipboard or xclip")
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if stderr.Len() > 0 {
+			err = fmt.Errorf("%s", bytes.TrimSpace(stderr.Bytes()))
+		}
+		output.OnError(err, "Could not copy to the clipboard")
+	}
+}
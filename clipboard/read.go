@@ -0,0 +1,131 @@
+package clipboard
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+var (
+	// The image types read from the clipboard, in order of preference.
+	imageTypes = []string{"image/png", "image/gif", "image/jpeg"}
+
+	// osascript prints clipboard images as '«data PNGf89504E47...»'.
+	appleDataPattern = regexp.MustCompile(`«data [A-Za-z]{4}([[:xdigit:]]+)»`)
+)
+
+// ReadImage returns the image copied to the system clipboard, or false if
+// there isn't one or no clipboard tool is available.
+func ReadImage() ([]byte, bool) {
+	switch runtime.GOOS {
+	case "darwin":
+		out, ok := paste(exec.Command("osascript", "-e", "the clipboard as «class PNGf»"))
+		if !ok {
+			return nil, false
+		}
+		m := appleDataPattern.FindSubmatch(out)
+		if m == nil {
+			return nil, false
+		}
+		b, err := hex.DecodeString(string(m[1]))
+		return b, err == nil
+
+	case "windows":
+		script := `Add-Type -AssemblyName System.Windows.Forms; Add-Type -AssemblyName System.Drawing; $i = [Windows.Forms.Clipboard]::GetImage(); if ($i) { $m = New-Object IO.MemoryStream; $i.Save($m, [Drawing.Imaging.ImageFormat]::Png); [Convert]::ToBase64String($m.ToArray()) }`
+		out, ok := paste(exec.Command("powershell", "-NoProfile", "-STA", "-Command", script))
+		if !ok {
+			return nil, false
+		}
+		b, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(out)))
+		return b, err == nil && len(b) > 0
+
+	default:
+		tool, list, args := linuxPasteTool()
+		if tool == "" {
+			return nil, false
+		}
+
+		types, ok := paste(exec.Command(tool, list...))
+		if !ok {
+			return nil, false
+		}
+
+		for _, typ := range imageTypes {
+			if contains(strings.Fields(string(types)), typ) {
+				return paste(exec.Command(tool, args(typ)...))
+			}
+		}
+		return nil, false
+	}
+}
+
+// ReadText returns the text copied to the system clipboard, or an empty
+// string if there isn't any or no clipboard tool is available.
+func ReadText() string {
+	var cmd *exec.Cmd
+
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("pbpaste")
+	case "windows":
+		cmd = exec.Command("powershell", "-NoProfile", "-Command", "Get-Clipboard -Raw")
+	default:
+		if tool, _, args := linuxPasteTool(); tool != "" {
+			cmd = exec.Command(tool, args("text/plain")...)
+		} else if _, err := exec.LookPath("xsel"); err == nil {
+			cmd = exec.Command("xsel", "--clipboard", "--output")
+		}
+	}
+
+	if cmd == nil {
+		return ""
+	}
+	out, _ := paste(cmd)
+	return string(out)
+}
+
+// Find a clipboard tool on Linux that can read images, returning the
+// arguments to list the copied types and a function returning the arguments
+// to paste a type.
+func linuxPasteTool() (string, []string, func(string) []string) {
+	if os.Getenv("WAYLAND_DISPLAY") != "" {
+		if _, err := exec.LookPath("wl-paste"); err == nil {
+			return "wl-paste", []string{"--list-types"}, func(typ string) []string {
+				return []string{"--no-newline", "--type", typ}
+			}
+		}
+	}
+
+	if _, err := exec.LookPath("xclip"); err == nil {
+		return "xclip", []string{"-selection", "clipboard", "-t", "TARGETS", "-o"}, func(typ string) []string {
+			if typ == "text/plain" {
+				typ = "UTF8_STRING"
+			}
+			return []string{"-selection", "clipboard", "-t", typ, "-o"}
+		}
+	}
+
+	return "", nil, nil
+}
+
+// Run a clipboard command and return its output, or false if it failed.
+// Tools fail when the clipboard is empty or doesn't hold the requested type.
+func paste(cmd *exec.Cmd) ([]byte, bool) {
+	out, err := cmd.Output()
+	return out, err == nil && len(out) > 0
+}
+
+// Return true if the list contains the value.
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,633 @@
+package editor
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-isatty"
+	"github.com/nomad-software/meme/cli"
+	"github.com/nomad-software/meme/clipboard"
+	"github.com/nomad-software/meme/font"
+	memeimage "github.com/nomad-software/meme/image"
+	"github.com/nomad-software/meme/image/stream"
+	"github.com/nomad-software/meme/output"
+	"github.com/nomad-software/meme/preview"
+	"github.com/nomad-software/meme/upload"
+)
+
+const (
+	renderDelay = 150 * time.Millisecond // Typing pauses for this long before rendering.
+	thumbDelay  = 50 * time.Millisecond  // Scrolling pauses for this long before loading.
+	textFields  = 2                      // The top and bottom text come before the boxes.
+	newBox      = "10,40,80,20:"         // The position and size of an added box.
+)
+
+// The screens of the editor.
+const (
+	browsing = iota
+	editing
+)
+
+// editor is the state of the interactive editor.
+type editor struct {
+	opt    cli.Options // The options being edited.
+	term   *os.File
+	out    *bufio.Writer
+	canvas *preview.Canvas
+	screen int
+
+	// Browsing images.
+	images   []string
+	matches  []string
+	filter   *field
+	selected int
+	scroll   int
+	thumbs   map[string]image.Image
+
+	// Editing text. The top and bottom text are followed by a field for each
+	// text box.
+	fields  []*field
+	initial []string // The text passed on the command line.
+	focus   int
+	fonts   []string
+
+	// The rendered meme.
+	meme     stream.Stream
+	memeOpt  cli.Options
+	rendered bool
+	latest   bool // The meme has the latest changes.
+	frames   []*image.RGBA
+	delays   []int
+	frame    int
+
+	status  string
+	failed  bool
+	busy    bool // A meme is being rendered.
+	pending bool // The meme changed while rendering.
+	redraw  bool // The image needs drawing.
+	clear   bool // The screen needs clearing.
+	quit    bool
+	results []string // Saved files and uploaded URLs.
+
+	events    chan func()
+	renderAt  <-chan time.Time
+	thumbAt   <-chan time.Time
+	nextFrame <-chan time.Time
+}
+
+// Run starts the interactive editor. Templates are browsed with a preview of
+// each, then the text, font and effects are edited while the meme is rendered
+// live. Finished memes can be saved or uploaded.
+func Run(opt cli.Options) {
+	in, term := os.Stdin, os.Stdout
+	if !isatty.IsTerminal(in.Fd()) || !isatty.IsTerminal(term.Fd()) {
+		output.Error("The edit command must be run in a terminal")
+	}
+
+	restore, err := makeRaw(in)
+	output.OnError(err, "Could not use the terminal")
+
+	e := newEditor(opt, term)
+
+	func() {
+		defer restore()
+		e.start()
+		defer e.stop()
+		e.loop(in)
+	}()
+
+	for _, result := range e.results {
+		output.Info(result)
+	}
+}
+
+// Create a new editor, starting on the editing screen if an image was passed.
+func newEditor(opt cli.Options, term *os.File) *editor {
+	e := &editor{
+		opt:    opt,
+		term:   term,
+		out:    bufio.NewWriterSize(term, 1<<16),
+		canvas: preview.NewCanvas(term, opt.PreviewMode),
+		filter: newField("Filter", ""),
+		thumbs: make(map[string]image.Image),
+		events: make(chan func()),
+	}
+
+	e.images = cli.ImageIds
+	if opt.Image != "" && !contains(cli.ImageIds, opt.Image) {
+		e.images = append([]string{opt.Image}, e.images...)
+	}
+	e.matches = e.images
+
+	e.initial = []string{escape(opt.Top), escape(opt.Bottom)}
+	e.fields = []*field{
+		newField("Top", e.initial[0]),
+		newField("Bottom", e.initial[1]),
+	}
+	for _, box := range opt.Boxes {
+		e.fields = append(e.fields, newField("", escape(box.String())))
+	}
+	e.labelBoxes()
+
+	if opt.Image != "" {
+		e.screen = editing
+		e.selected = indexOf(e.matches, opt.Image)
+		e.render()
+	} else {
+		e.screen = browsing
+		e.loadThumb()
+	}
+
+	return e
+}
+
+// Switch to the alternate screen so the terminal is left as it was.
+func (e *editor) start() {
+	e.out.WriteString("\x1b[?1049h\x1b[?25l\x1b[2J")
+	e.out.Flush()
+}
+
+// Switch back to the main screen.
+func (e *editor) stop() {
+	e.canvas.Clear(e.out)
+	e.out.WriteString("\x1b[0m\x1b[2J\x1b[?25h\x1b[?1049l")
+	e.out.Flush()
+}
+
+// Handle keys, resizes and background work until the editor is closed.
+func (e *editor) loop(in *os.File) {
+	keys := make(chan []key)
+	go readKeys(in, keys)
+
+	resize := make(chan os.Signal, 1)
+	notifyResize(resize)
+	defer signal.Stop(resize)
+
+	e.redraw = true
+
+	for !e.quit {
+		e.draw()
+
+		select {
+		case k, ok := <-keys:
+			if !ok {
+				return
+			}
+			for _, k := range k {
+				e.press(k)
+			}
+
+		case fn := <-e.events:
+			fn()
+
+		case <-resize:
+			e.canvas.Resize(e.term)
+			e.clear = true
+
+		case <-e.renderAt:
+			e.renderAt = nil
+			e.render()
+
+		case <-e.thumbAt:
+			e.thumbAt = nil
+			e.loadThumb()
+
+		case <-e.nextFrame:
+			e.nextFrame = nil
+			e.frame = (e.frame + 1) % len(e.frames)
+			e.redraw = true
+		}
+	}
+}
+
+// Read keys from the terminal until it's closed.
+func readKeys(f *os.File, keys chan<- []key) {
+	buf := make([]byte, 1024)
+	for {
+		n, err := f.Read(buf)
+		if err != nil {
+			close(keys)
+			return
+		}
+		keys <- parseKeys(buf[:n])
+	}
+}
+
+// Handle a key press.
+func (e *editor) press(k key) {
+	if k.code == keyCtrl && (k.r == 'c' || k.r == 'q') {
+		e.quit = true
+		return
+	}
+
+	if e.screen == browsing {
+		e.browse(k)
+	} else {
+		e.edit(k)
+	}
+}
+
+// Handle a key press while browsing images.
+func (e *editor) browse(k key) {
+	_, rows := e.canvas.Size()
+	page := max(rows-bottomRows-1, 1)
+
+	switch k.code {
+	case keyUp:
+		e.choose(e.selected - 1)
+	case keyDown:
+		e.choose(e.selected + 1)
+	case keyPageUp:
+		e.choose(e.selected - page)
+	case keyPageDown:
+		e.choose(e.selected + page)
+	case keyHome:
+		e.choose(0)
+	case keyEnd:
+		e.choose(len(e.matches) - 1)
+
+	case keyEnter:
+		if len(e.matches) > 0 {
+			e.open(e.matches[e.selected])
+		}
+
+	case keyEscape:
+		switch {
+		case len(e.filter.text) > 0:
+			e.filter.edit(key{code: keyCtrl, r: 'u'})
+			e.match()
+		case e.opt.Image != "":
+			e.show(editing)
+		default:
+			e.quit = true
+		}
+
+	default:
+		if e.filter.edit(k) {
+			e.match()
+		}
+	}
+}
+
+// Handle a key press while editing the meme.
+func (e *editor) edit(k key) {
+	switch k.code {
+	case keyEscape:
+		e.selected = max(indexOf(e.matches, e.opt.Image), 0)
+		e.show(browsing)
+
+	case keyTab, keyDown, keyEnter:
+		e.focus = (e.focus + 1) % len(e.fields)
+
+	case keyBackTab, keyUp:
+		e.focus = (e.focus + len(e.fields) - 1) % len(e.fields)
+
+	case keyCtrl:
+		switch k.r {
+		case 'k':
+			e.opt.Shake = !e.opt.Shake
+			e.changed()
+		case 't':
+			e.opt.Trigger = !e.opt.Trigger
+			e.changed()
+		case 'g':
+			e.opt.Gif = !e.opt.Gif
+			e.changed()
+		case 'b':
+			e.addBox()
+		case 'x':
+			e.removeBox()
+		case 'f':
+			e.nextFont()
+		case 's':
+			e.save()
+		case 'p':
+			e.upload()
+		default:
+			if e.fields[e.focus].edit(k) {
+				e.changed()
+			}
+		}
+
+	default:
+		if e.fields[e.focus].edit(k) {
+			e.changed()
+		}
+	}
+}
+
+// Switch to a screen.
+func (e *editor) show(screen int) {
+	e.screen = screen
+	e.nextFrame = nil
+	e.redraw = true
+
+	if screen == browsing {
+		e.loadThumb()
+	} else {
+		e.animate()
+	}
+}
+
+// Select an image in the list, loading its preview after a short pause.
+func (e *editor) choose(n int) {
+	n = max(min(n, len(e.matches)-1), 0)
+	if n != e.selected {
+		e.selected = n
+		e.redraw = true
+		e.thumbAt = time.After(thumbDelay)
+	}
+}
+
+// Update the images matching the filter.
+func (e *editor) match() {
+	filter := strings.ToLower(e.filter.String())
+
+	e.matches = nil
+	for _, id := range e.images {
+		if strings.Contains(strings.ToLower(id), filter) {
+			e.matches = append(e.matches, id)
+		}
+	}
+
+	e.selected, e.scroll = 0, 0
+	e.redraw = true
+	e.thumbAt = time.After(thumbDelay)
+}
+
+// Start editing an image.
+func (e *editor) open(id string) {
+	if id != e.opt.Image || !e.rendered {
+		e.opt.Image = id
+		e.rendered, e.latest = false, false
+		e.frames = nil
+		e.render()
+	}
+	e.show(editing)
+}
+
+// Load the preview of the selected image in the background.
+func (e *editor) loadThumb() {
+	if len(e.matches) == 0 {
+		return
+	}
+
+	id := e.matches[e.selected]
+	if _, ok := e.thumbs[id]; ok {
+		e.redraw = true
+		return
+	}
+
+	opt := e.opt
+	opt.Image = id
+
+	go func() {
+		var img image.Image
+		err := output.Catch(func() {
+			st := memeimage.Load(opt)
+			img = st.DecodeImage()
+		})
+
+		e.events <- func() {
+			if err != nil {
+				e.fail(err.Error())
+				return
+			}
+			e.thumbs[id] = img
+			e.redraw = true
+		}
+	}()
+}
+
+// Render the meme after a short pause, so it isn't rendered for every key.
+func (e *editor) changed() {
+	e.latest = false
+	e.renderAt = time.After(renderDelay)
+}
+
+// Render the meme in the background. Only one meme is rendered at a time and
+// changes made while rendering are rendered once it's finished.
+func (e *editor) render() {
+	if e.busy {
+		e.pending = true
+		return
+	}
+
+	opt, err := e.options()
+	if err != nil {
+		e.fail(err.Error())
+		return
+	}
+	e.busy = true
+
+	go func() {
+		var st stream.Stream
+		var frames []*image.RGBA
+		var delays []int
+
+		err := output.Catch(func() {
+			opt.Valid()
+			st = memeimage.Generate(opt)
+			frames, delays, _ = memeimage.Frames(st)
+		})
+
+		e.events <- func() {
+			e.busy = false
+
+			if err != nil {
+				e.fail(err.Error())
+			} else if opt.Image == e.opt.Image {
+				if e.failed {
+					e.message("")
+				}
+				e.meme, e.memeOpt, e.rendered = st, opt, true
+				e.latest = !e.pending && e.renderAt == nil
+				e.frames, e.delays, e.frame = frames, delays, 0
+				e.redraw = true
+				e.animate()
+			}
+
+			if e.pending {
+				e.pending = false
+				e.render()
+			}
+		}
+	}()
+}
+
+// Return the options used to render the meme. Text that hasn't been edited
+// keeps any timed captions passed on the command line.
+func (e *editor) options() (cli.Options, error) {
+	opt := e.opt
+	opt.Command = "render"
+
+	if top := e.fields[0].String(); top != e.initial[0] {
+		opt.Top = cli.Unescape(top)
+		opt.TopCues = nil
+	}
+	if bottom := e.fields[1].String(); bottom != e.initial[1] {
+		opt.Bottom = cli.Unescape(bottom)
+		opt.BottomCues = nil
+	}
+
+	opt.Boxes = nil
+	for _, f := range e.fields[textFields:] {
+		box, err := cli.ParseBox(f.String())
+		if err != nil {
+			return opt, err
+		}
+		opt.Boxes = append(opt.Boxes, box)
+	}
+
+	return opt, nil
+}
+
+// Add a text box and start editing it.
+func (e *editor) addBox() {
+	e.fields = append(e.fields, newField("", newBox))
+	e.focus = len(e.fields) - 1
+	e.labelBoxes()
+	e.changed()
+}
+
+// Remove the text box being edited.
+func (e *editor) removeBox() {
+	if e.focus < textFields {
+		e.fail("Only text boxes can be removed, move to one using Tab")
+		return
+	}
+
+	e.fields = append(e.fields[:e.focus], e.fields[e.focus+1:]...)
+	e.focus = min(e.focus, len(e.fields)-1)
+	e.labelBoxes()
+	e.changed()
+}
+
+// Number the text box fields in order.
+func (e *editor) labelBoxes() {
+	for x, f := range e.fields[textFields:] {
+		f.label = fmt.Sprintf("Box %d", x+1)
+	}
+}
+
+// Show the next frame of an animation once the current one's delay has passed.
+func (e *editor) animate() {
+	if e.screen == editing && len(e.frames) > 1 {
+		e.nextFrame = time.After(preview.FrameDelay(e.delays[e.frame]))
+	}
+}
+
+// Use the next installed font.
+func (e *editor) nextFont() {
+	if e.fonts == nil {
+		err := output.Catch(func() {
+			e.fonts = append([]string{""}, font.List()...)
+		})
+		if err != nil {
+			e.fail(err.Error())
+			return
+		}
+	}
+
+	n := (indexOf(e.fonts, e.opt.Font) + 1) % len(e.fonts)
+	e.opt.Font = e.fonts[n]
+	e.changed()
+}
+
+// Save the rendered meme.
+func (e *editor) save() {
+	if !e.ready() {
+		return
+	}
+
+	var file string
+	err := output.Catch(func() {
+		file = memeimage.Save(e.memeOpt, e.meme)
+	})
+	if err != nil {
+		e.fail(err.Error())
+		return
+	}
+
+	e.results = append(e.results, file)
+	e.message("Saved %s", file)
+}
+
+// Upload the rendered meme in the background.
+func (e *editor) upload() {
+	if !e.ready() {
+		return
+	}
+	if e.opt.Upload == "" {
+		e.fail("No upload provider, pass -upload or -cid to upload memes")
+		return
+	}
+
+	opt, st := e.memeOpt, e.meme
+	e.message("Uploading...")
+
+	go func() {
+		var res upload.Result
+		err := output.Catch(func() {
+			res = upload.New(opt).Upload(st)
+			upload.Record(opt, res)
+			if opt.Copy {
+				clipboard.WriteText(res.URL)
+			}
+		})
+
+		e.events <- func() {
+			if err != nil {
+				e.fail(err.Error())
+				return
+			}
+			e.results = append(e.results, res.URL)
+			e.message("Uploaded %s", res.URL)
+		}
+	}()
+}
+
+// Return true if the meme has been rendered with the latest changes.
+func (e *editor) ready() bool {
+	if e.busy || e.renderAt != nil {
+		e.fail("Wait for the meme to finish rendering")
+		return false
+	}
+	if !e.latest {
+		e.fail("The meme couldn't be rendered with the latest changes")
+		return false
+	}
+	return true
+}
+
+// Show a message in the status line.
+func (e *editor) message(format string, args ...interface{}) {
+	e.status = fmt.Sprintf(format, args...)
+	e.failed = false
+}
+
+// Show an error in the status line.
+func (e *editor) fail(text string) {
+	e.status = text
+	e.failed = true
+}
+
+// Return the index of the value in the list, or -1 if it's missing.
+func indexOf(list []string, value string) int {
+	for i, v := range list {
+		if v == value {
+			return i
+		}
+	}
+	return -1
+}
+
+// Return true if the list contains the value.
+func contains(list []string, value string) bool {
+	return indexOf(list, value) >= 0
+}
@@ -0,0 +1,114 @@
+package editor
+
+import (
+	"strings"
+	"unicode"
+)
+
+// field is a single line of editable text.
+type field struct {
+	label string
+	text  []rune
+	pos   int // The cursor position.
+}
+
+// Create a new field containing the passed text, with the cursor at the end.
+func newField(label string, text string) *field {
+	f := &field{label: label, text: []rune(text)}
+	f.pos = len(f.text)
+	return f
+}
+
+// Return the text of the field.
+func (f *field) String() string {
+	return string(f.text)
+}
+
+// Edit the field using the key, returning true if the text changed.
+func (f *field) edit(k key) bool {
+	switch k.code {
+	case keyRune:
+		f.text = append(f.text[:f.pos], append([]rune{k.r}, f.text[f.pos:]...)...)
+		f.pos++
+		return true
+
+	case keyBackspace:
+		if f.pos > 0 {
+			f.text = append(f.text[:f.pos-1], f.text[f.pos:]...)
+			f.pos--
+			return true
+		}
+
+	case keyDelete:
+		if f.pos < len(f.text) {
+			f.text = append(f.text[:f.pos], f.text[f.pos+1:]...)
+			return true
+		}
+
+	case keyLeft:
+		f.pos = max(f.pos-1, 0)
+
+	case keyRight:
+		f.pos = min(f.pos+1, len(f.text))
+
+	case keyHome:
+		f.pos = 0
+
+	case keyEnd:
+		f.pos = len(f.text)
+
+	case keyCtrl:
+		switch k.r {
+		case 'a':
+			f.pos = 0
+		case 'e':
+			f.pos = len(f.text)
+		case 'u':
+			changed := len(f.text) > 0
+			f.text, f.pos = nil, 0
+			return changed
+		case 'w':
+			return f.deleteWord()
+		}
+	}
+
+	return false
+}
+
+// Delete the word before the cursor.
+func (f *field) deleteWord() bool {
+	start := f.pos
+	for start > 0 && unicode.IsSpace(f.text[start-1]) {
+		start--
+	}
+	for start > 0 && !unicode.IsSpace(f.text[start-1]) {
+		start--
+	}
+
+	if start == f.pos {
+		return false
+	}
+
+	f.text = append(f.text[:start], f.text[f.pos:]...)
+	f.pos = start
+	return true
+}
+
+// Return the visible part of the text in the passed width, scrolled so the
+// cursor can be seen, and the column of the cursor within it.
+func (f *field) view(width int) (string, int) {
+	if width < 1 {
+		return "", 0
+	}
+
+	start := max(f.pos-width+1, 0)
+	end := min(start+width, len(f.text))
+
+	return string(f.text[start:end]), f.pos - start
+}
+
+// Escape line breaks and backslashes so text can be edited on a single line.
+// This is the reverse of cli.Unescape.
+func escape(text string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(text)
+}
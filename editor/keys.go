@@ -0,0 +1,107 @@
+package editor
+
+import (
+	"unicode/utf8"
+)
+
+// The keys understood by the editor.
+const (
+	keyRune = iota
+	keyCtrl
+	keyEnter
+	keyTab
+	keyBackTab
+	keyBackspace
+	keyDelete
+	keyEscape
+	keyUp
+	keyDown
+	keyLeft
+	keyRight
+	keyHome
+	keyEnd
+	keyPageUp
+	keyPageDown
+	keyUnknown
+)
+
+// key is a single key press. The rune is the typed character, or the letter
+// pressed along with ctrl.
+type key struct {
+	code int
+	r    rune
+}
+
+// The escape sequences sent by special keys, after the CSI or SS3 prefix.
+var sequences = map[string]int{
+	"A":  keyUp,
+	"B":  keyDown,
+	"C":  keyRight,
+	"D":  keyLeft,
+	"H":  keyHome,
+	"F":  keyEnd,
+	"Z":  keyBackTab,
+	"1~": keyHome,
+	"3~": keyDelete,
+	"4~": keyEnd,
+	"5~": keyPageUp,
+	"6~": keyPageDown,
+	"7~": keyHome,
+	"8~": keyEnd,
+}
+
+// Parse the keys in the bytes read from the terminal. A read can contain many
+// keys when text is pasted.
+func parseKeys(b []byte) []key {
+	var keys []key
+
+	for len(b) > 0 {
+		k, n := parseKey(b)
+		keys = append(keys, k)
+		b = b[n:]
+	}
+
+	return keys
+}
+
+// Parse the first key in the bytes, returning it and the number of bytes used.
+func parseKey(b []byte) (key, int) {
+	switch c := b[0]; {
+	case c == 0x1b:
+		return parseEscape(b)
+	case c == '\r' || c == '\n':
+		return key{code: keyEnter}, 1
+	case c == '\t':
+		return key{code: keyTab}, 1
+	case c == 0x7f || c == 0x08:
+		return key{code: keyBackspace}, 1
+	case c < 0x20:
+		return key{code: keyCtrl, r: rune('a' + c - 1)}, 1
+	}
+
+	r, n := utf8.DecodeRune(b)
+	if r == utf8.RuneError {
+		return key{code: keyUnknown}, n
+	}
+	return key{code: keyRune, r: r}, n
+}
+
+// Parse an escape sequence. A lone escape is the escape key.
+func parseEscape(b []byte) (key, int) {
+	if len(b) < 2 || (b[1] != '[' && b[1] != 'O') {
+		return key{code: keyEscape}, 1
+	}
+
+	// The sequence ends with a letter or a tilde.
+	for n := 2; n < len(b); n++ {
+		if c := b[n]; c == '~' || (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') {
+			code, ok := sequences[string(b[2:n+1])]
+			if !ok {
+				code = keyUnknown
+			}
+			return key{code: code}, n + 1
+		}
+	}
+
+	return key{code: keyUnknown}, len(b)
+}
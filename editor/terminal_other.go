@@ -0,0 +1,18 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+
+package editor
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+)
+
+// Raw mode isn't supported on this platform.
+func makeRaw(f *os.File) (func(), error) {
+	return nil, fmt.Errorf("not supported on %s", runtime.GOOS)
+}
+
+// Resizes aren't signalled on this platform.
+func notifyResize(c chan os.Signal) {
+}
@@ -0,0 +1,259 @@
+package editor
+
+import (
+	"fmt"
+	"image"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/fatih/color"
+)
+
+const (
+	paneWidth  = 28 // The width of the image list and settings, in columns.
+	bottomRows = 4  // The rows below the preview.
+	minCols    = 50
+	minRows    = 12
+)
+
+// The keys shown at the bottom of each screen.
+var help = map[int]string{
+	browsing: "↑↓ choose  Enter edit  type to filter  Esc back  ^Q quit",
+	editing:  "Tab next  ^B add box  ^X remove box  ^S save  ^P upload  Esc templates  ^Q quit",
+}
+
+// Draw the screen. The preview is only drawn when it has changed, as that's
+// much slower than drawing text.
+func (e *editor) draw() {
+	w := e.out
+	cols, rows := e.canvas.Size()
+
+	// Draw everything at once in terminals which support synchronised output.
+	w.WriteString("\x1b[?2026h\x1b[?25l")
+	defer func() {
+		w.WriteString("\x1b[?2026l")
+		w.Flush()
+	}()
+
+	if e.clear {
+		e.canvas.Clear(w)
+		w.WriteString("\x1b[2J")
+		e.clear, e.redraw = false, true
+	}
+
+	if cols < minCols || rows < minRows {
+		e.moveTo(1, 1)
+		w.WriteString("The terminal is too small\x1b[K")
+		e.redraw = true
+		return
+	}
+
+	body := rows - bottomRows - 1
+
+	e.drawHeader(cols)
+	if e.screen == browsing {
+		e.drawList(body)
+	} else {
+		e.drawSettings(body)
+	}
+
+	if e.redraw {
+		e.drawImage(paneWidth+2, 2, cols-paneWidth-2, body)
+		e.redraw = false
+	}
+
+	// The text being edited, the status and the keys. Only two fields fit, so
+	// they're scrolled to show the one being edited.
+	row := rows - bottomRows + 1
+	var fields []*field
+	focus := 0
+	if e.screen == browsing {
+		fields = []*field{e.filter, nil}
+	} else {
+		start := max(e.focus-1, 0)
+		fields, focus = e.fields[start:start+2], e.focus-start
+	}
+
+	cursorRow, cursorCol := 0, 0
+	for x, f := range fields {
+		e.moveTo(row+x, 1)
+		if f == nil {
+			w.WriteString("\x1b[K")
+			continue
+		}
+
+		label := fmt.Sprintf(" %-7s ", f.label)
+		text, pos := f.view(cols - len(label) - 1)
+		if x == focus {
+			w.WriteString(color.CyanString("%s", label))
+			cursorRow, cursorCol = row+x, len(label)+pos+1
+		} else {
+			w.WriteString(label)
+		}
+		w.WriteString(text)
+		w.WriteString("\x1b[K")
+	}
+
+	e.moveTo(rows-1, 1)
+	status := truncate(" "+e.status, cols)
+	if e.failed {
+		w.WriteString(color.RedString("%s", status))
+	} else {
+		w.WriteString(color.GreenString("%s", status))
+	}
+	w.WriteString("\x1b[K")
+
+	e.moveTo(rows, 1)
+	w.WriteString(color.HiBlackString("%s", truncate(" "+help[e.screen], cols)))
+	w.WriteString("\x1b[K")
+
+	e.moveTo(cursorRow, cursorCol)
+	w.WriteString("\x1b[?25h")
+}
+
+// Draw the title bar.
+func (e *editor) drawHeader(cols int) {
+	title := " meme edit"
+	if e.opt.Image != "" {
+		title += " - " + e.opt.Image
+	}
+
+	state := ""
+	if e.busy || e.renderAt != nil {
+		state = "rendering "
+	}
+
+	e.moveTo(1, 1)
+	e.out.WriteString("\x1b[7m")
+	e.out.WriteString(pad(truncate(title, cols-len(state)), cols-len(state)))
+	e.out.WriteString(state)
+	e.out.WriteString("\x1b[0m")
+}
+
+// Draw the list of images, scrolled so the selected one can be seen.
+func (e *editor) drawList(rows int) {
+	if e.selected < e.scroll {
+		e.scroll = e.selected
+	}
+	if e.selected >= e.scroll+rows {
+		e.scroll = e.selected - rows + 1
+	}
+
+	for x := 0; x < rows; x++ {
+		e.moveTo(x+2, 1)
+
+		n := e.scroll + x
+		if n >= len(e.matches) {
+			e.out.WriteString(pad("", paneWidth))
+		} else if n == e.selected {
+			e.out.WriteString("\x1b[7m" + pad(truncate(" "+e.matches[n], paneWidth), paneWidth) + "\x1b[0m")
+		} else {
+			e.out.WriteString(pad(truncate(" "+e.matches[n], paneWidth), paneWidth))
+		}
+		e.out.WriteString("│")
+	}
+}
+
+// Draw the settings of the meme being edited.
+func (e *editor) drawSettings(rows int) {
+	fontName := e.opt.Font
+	if fontName == "" {
+		fontName = "default"
+	}
+
+	lines := []string{
+		setting("Font", fontName, "^F"),
+		setting("Shake", onOff(e.opt.Shake), "^K"),
+		setting("Trigger", onOff(e.opt.Trigger), "^T"),
+		setting("Gif", onOff(e.opt.Gif), "^G"),
+		setting("Boxes", fmt.Sprint(len(e.fields)-textFields), "^B ^X"),
+		"",
+	}
+
+	if e.rendered {
+		w, h := e.meme.Dimensions()
+		lines = append(lines,
+			setting("Size", fmt.Sprintf("%dx%d", w, h), ""),
+			setting("Frames", fmt.Sprint(len(e.frames)), ""),
+			setting("Format", e.meme.FileExt(), ""),
+		)
+	}
+
+	if e.opt.Upload != "" {
+		lines = append(lines, setting("Upload", e.opt.Upload, ""))
+	}
+
+	for x := 0; x < rows; x++ {
+		e.moveTo(x+2, 1)
+
+		line := ""
+		if x < len(lines) {
+			line = lines[x]
+		}
+		e.out.WriteString(pad(truncate(line, paneWidth), paneWidth))
+		e.out.WriteString("│")
+	}
+}
+
+// Draw the selected image when browsing, otherwise the rendered meme.
+func (e *editor) drawImage(col int, row int, cols int, rows int) {
+	for x := 0; x < rows; x++ {
+		e.moveTo(row+x, col)
+		e.out.WriteString("\x1b[K")
+	}
+	e.canvas.Clear(e.out)
+
+	var img image.Image
+	placeholder := "Loading..."
+
+	if e.screen == browsing {
+		if len(e.matches) == 0 {
+			placeholder = "No matching templates"
+		} else {
+			img = e.thumbs[e.matches[e.selected]]
+		}
+	} else if e.rendered {
+		img = e.frames[e.frame]
+	} else {
+		placeholder = "Rendering..."
+	}
+
+	if img == nil {
+		e.moveTo(row+rows/2, col+max(cols-len(placeholder), 0)/2)
+		e.out.WriteString(placeholder)
+		return
+	}
+
+	e.canvas.Draw(e.out, img, col, row, cols, rows)
+}
+
+// Move the cursor to a row and column, counted from one.
+func (e *editor) moveTo(row int, col int) {
+	fmt.Fprintf(e.out, "\x1b[%d;%dH", row, col)
+}
+
+// Format a setting and the key which changes it.
+func setting(name string, value string, key string) string {
+	return fmt.Sprintf(" %-8s %-12s %s", name, truncate(value, 12), key)
+}
+
+// Return on or off.
+func onOff(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
+
+// Shorten the text to the passed number of characters.
+func truncate(text string, n int) string {
+	if utf8.RuneCountInString(text) <= n {
+		return text
+	}
+	return string([]rune(text)[:max(n, 0)])
+}
+
+// Pad the text with spaces to the passed number of characters.
+func pad(text string, n int) string {
+	return text + strings.Repeat(" ", max(n-utf8.RuneCountInString(text), 0))
+}
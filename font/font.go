@@ -2,67 +2,159 @@ package font
 
 import (
 	"fmt"
+	"io/fs"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
 
-	"github.com/nomad-software/meme/cli"
+	"github.com/golang/freetype/truetype"
+	"github.com/mitchellh/go-homedir"
 	"github.com/nomad-software/meme/data"
 	"github.com/nomad-software/meme/output"
+	"golang.org/x/image/font"
 )
 
 var (
-	// Path is the location of the font file.
-	Path string
+	fontExtensions = []string{".ttf"}
+
+	// Parsed fonts are cached by name so they are only read once.
+	cache = make(map[string]*truetype.Font)
+	mutex sync.Mutex
 )
 
-// Override the font path at runtime.
-func SetPath(opt cli.Options) {
-	if opt.Font == "" {
-		return
+// Load returns the named font. The name is either a path to a ttf file or the
+// name of a font installed on the system. An empty name returns the built-in
+// font. Fonts are cached after they are first loaded.
+func Load(name string) *truetype.Font {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	if f, ok := cache[name]; ok {
+		return f
+	}
+
+	var b []byte
+	var err error
+
+	if name == "" {
+		b, err = data.Files.ReadFile(data.Font)
+		output.OnError(err, "Could not read embedded font")
+	} else {
+		b, err = os.ReadFile(Path(name))
+		output.OnError(err, "Could not read font file")
 	}
 
+	f, err := truetype.Parse(b)
+	output.OnError(err, "Could not parse font file")
+
+	cache[name] = f
+	return f
+}
+
+// Face returns a new face of the font at the passed size in points.
+// Faces are not safe for concurrent use so each drawing context needs its own.
+func Face(f *truetype.Font, size float64) font.Face {
+	return truetype.NewFace(f, &truetype.Options{Size: size})
+}
+
+// Path resolves a font name to the path of a font file.
+func Path(name string) string {
 	// direct file
-	if _, err := os.Stat(opt.Font); err == nil {
-		Path = opt.Font
-		return
+	if path, err := homedir.Expand(name); err == nil {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
 	}
 
 	// try fc-match (Linux/macOS with fontconfig)
 	if fc, err := exec.LookPath("fc-match"); err == nil {
-		out, err := exec.Command(fc, "-f", "%{file}\\n", opt.Font).Output()
+		out, err := exec.Command(fc, "-f", "%{file}\\n", name).Output()
 		if err == nil {
 			f := strings.TrimSpace(string(out))
 			if f != "" {
 				if _, err := os.Stat(f); err == nil {
-					Path = f
-					return
+					return f
 				}
 			}
 		}
 	}
 
-	output.Error(fmt.Sprintf("Invalid font: %s", opt.Font))
+	// search the usual font directories
+	var found string
+	for _, dir := range fontDirs() {
+		filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err == nil && found == "" && isFontFile(path) && strings.EqualFold(strings.TrimSuffix(d.Name(), filepath.Ext(path)), name) {
+				found = path
+			}
+			return nil
+		})
+		if found != "" {
+			return found
+		}
+	}
+
+	output.Error(fmt.Sprintf("Invalid font: %s, run 'meme fonts' to list the installed fonts", name))
+	panic("Never reached")
 }
 
-// Write the embedded font to the temporary directory.
-func init() {
-	if Path != "" {
-		return
+// List returns the names of the fonts installed on the system.
+func List() []string {
+	found := make(map[string]bool)
+
+	if fc, err := exec.LookPath("fc-list"); err == nil {
+		out, err := exec.Command(fc, "--format", "%{family[0]}\\n", ":fontformat=TrueType").Output()
+		output.OnError(err, "Could not list fonts")
+
+		for _, name := range strings.Split(string(out), "\n") {
+			if name = strings.TrimSpace(name); name != "" {
+				found[name] = true
+			}
+		}
+	} else {
+		for _, dir := range fontDirs() {
+			filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+				if err == nil && !d.IsDir() && isFontFile(path) {
+					found[strings.TrimSuffix(d.Name(), filepath.Ext(path))] = true
+				}
+				return nil
+			})
+		}
+	}
+
+	var names []string
+	for name := range found {
+		names = append(names, name)
 	}
+	sort.Strings(names)
 
-	Path = filepath.Join(os.TempDir(), filepath.Base(data.Font))
+	return names
+}
 
-	if _, err := os.Stat(Path); os.IsNotExist(err) {
-		file, err := os.Create(Path)
-		output.OnError(err, "Could not create font file")
-		defer file.Close()
+// Return the directories fonts are usually installed in.
+func fontDirs() []string {
+	home, _ := homedir.Dir()
 
-		stream, err := data.Files.ReadFile(data.Font)
-		output.OnError(err, "Could not read embedded font")
+	switch runtime.GOOS {
+	case "darwin":
+		return []string{"/System/Library/Fonts", "/Library/Fonts", filepath.Join(home, "Library", "Fonts")}
+	case "windows":
+		return []string{filepath.Join(os.Getenv("WINDIR"), "Fonts")}
+	default:
+		return []string{"/usr/share/fonts", "/usr/local/share/fonts", filepath.Join(home, ".fonts"), filepath.Join(home, ".local", "share", "fonts")}
+	}
+}
 
-		_, err = file.Write(stream)
-		output.OnError(err, "Could not write font file")
+// Return true if the path is a font file that can be loaded.
+func isFontFile(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, e := range fontExtensions {
+		if ext == e {
+			return true
+		}
 	}
+	return false
 }
@@ -0,0 +1,154 @@
+package image
+
+import (
+	"image"
+	"image/draw"
+	"image/gif"
+	"math"
+
+	"github.com/nomad-software/meme/cli"
+	"github.com/nomad-software/meme/image/stream"
+	"github.com/nomad-software/meme/output"
+)
+
+const (
+	minGifDelay = 2 // 100ths of a second, browsers slow down anything faster.
+)
+
+// Edit the frames and timing of a gif before it's reduced and drawn on.
+func editGif(opt cli.Options, src *gif.GIF) *gif.GIF {
+	if opt.Trim.IsSet() || opt.Drop > 1 || opt.Reverse || opt.PingPong {
+		src = coalescedGif(src)
+	}
+
+	if opt.Trim.IsSet() {
+		src = trimGif(src, opt.Trim)
+	}
+
+	if opt.Drop > 1 {
+		src = dropFrames(src, opt.Drop)
+	}
+
+	if opt.Reverse {
+		src = reverseGif(src)
+	}
+
+	if opt.PingPong {
+		src = pingPongGif(src)
+	}
+
+	if opt.Speed > 0 && opt.Speed != 1 {
+		for x, delay := range src.Delay {
+			src.Delay[x] = int(math.Max(minGifDelay, math.Round(float64(delay)/opt.Speed)))
+		}
+	}
+
+	if opt.Loop == 0 {
+		src.LoopCount = 0
+	} else if opt.Loop == 1 {
+		src.LoopCount = -1
+	} else if opt.Loop > 1 {
+		src.LoopCount = opt.Loop - 1
+	}
+
+	return src
+}
+
+// Return a copy of the gif where every frame is a full image. This allows
+// frames to be removed or reordered without breaking the animation.
+func coalescedGif(src *gif.GIF) *gif.GIF {
+	frames := coalesceGif(src)
+	images := make([]*image.Paletted, len(frames))
+
+	for x, frame := range frames {
+		images[x] = palettedFrame(frame, src.Image[x].Palette)
+	}
+
+	bounds := images[0].Bounds()
+
+	return &gif.GIF{
+		Image:     images,
+		Delay:     append([]int{}, src.Delay...),
+		LoopCount: src.LoopCount,
+		Config:    image.Config{Width: bounds.Dx(), Height: bounds.Dy()},
+	}
+}
+
+// Remove all frames outside of the passed range.
+func trimGif(src *gif.GIF, r cli.Range) *gif.GIF {
+	var images []*image.Paletted
+	var delays []int
+	var elapsed float64
+
+	for x, frame := range src.Image {
+		if r.Contains(x, elapsed) {
+			images = append(images, frame)
+			delays = append(delays, src.Delay[x])
+		}
+		elapsed += float64(src.Delay[x]) / 100
+	}
+
+	if len(images) == 0 {
+		output.Error("The trim range doesn't contain any frames")
+	}
+
+	src.Image = images
+	src.Delay = delays
+
+	return src
+}
+
+// Drop every nth frame, adding its delay to the previous frame so the overall
+// timing of the animation is preserved.
+func dropFrames(src *gif.GIF, n int) *gif.GIF {
+	var images []*image.Paletted
+	var delays []int
+
+	for x, frame := range src.Image {
+		if (x+1)%n == 0 && len(delays) > 0 {
+			delays[len(delays)-1] += src.Delay[x]
+			continue
+		}
+		images = append(images, frame)
+		delays = append(delays, src.Delay[x])
+	}
+
+	src.Image = images
+	src.Delay = delays
+
+	return src
+}
+
+// Reverse the frames of a gif.
+func reverseGif(src *gif.GIF) *gif.GIF {
+	for x, y := 0, len(src.Image)-1; x < y; x, y = x+1, y-1 {
+		src.Image[x], src.Image[y] = src.Image[y], src.Image[x]
+		src.Delay[x], src.Delay[y] = src.Delay[y], src.Delay[x]
+	}
+	return src
+}
+
+// Play the gif forwards then backwards. The first and last frames are not
+// repeated so the loop is seamless.
+func pingPongGif(src *gif.GIF) *gif.GIF {
+	for x := len(src.Image) - 2; x > 0; x-- {
+		src.Image = append(src.Image, src.Image[x])
+		src.Delay = append(src.Delay, src.Delay[x])
+	}
+	return src
+}
+
+// Frames returns every frame of the image as a complete picture, along with
+// the delay of each frame in 100ths of a second and the gif loop count.
+// Images that aren't gifs have a single frame.
+func Frames(st stream.Stream) ([]*image.RGBA, []int, int) {
+	if !st.IsGif() {
+		img := st.DecodeImage()
+		frame := image.NewRGBA(img.Bounds())
+		draw.Draw(frame, frame.Bounds(), img, img.Bounds().Min, draw.Src)
+		return []*image.RGBA{frame}, []int{0}, -1
+	}
+
+	src := st.DecodeGif()
+	return coalesceGif(src), src.Delay, src.LoopCount
+}
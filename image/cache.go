@@ -0,0 +1,129 @@
+package image
+
+import (
+	"fmt"
+	"image/color"
+
+	"github.com/nomad-software/meme/cache"
+	"github.com/nomad-software/meme/cli"
+	"github.com/nomad-software/meme/image/stream"
+)
+
+// Kinds of cached entries.
+const (
+	cacheSource   = "source"
+	cacheEmbedded = "embedded"
+	cacheOutput   = "output"
+
+	// Change this when the renderer changes so memes cached on disk by older
+	// versions aren't used.
+	cacheVersion = 2
+)
+
+// renderOptions are the options that change how a loaded image is rendered.
+// Options used while loading, such as the video times, are part of the
+// loaded image instead. Animation frames are assembled after the cache is
+// checked, so the options used to assemble them are included.
+type renderOptions struct {
+	Version    int
+	Animate    bool
+	Delay      int
+	Gif        bool
+	Shake      bool
+	Trigger    bool
+	Top        string
+	Bottom     string
+	Boxes      []cli.Box
+	TopCues    []cli.Cue
+	BottomCues []cli.Cue
+	Font       string
+	Color      color.Color
+	Stroke     color.Color
+	MaxSize    int
+	Crop       string
+	Rotate     float64
+	Flip       string
+	Pad        int
+	PadColor   color.Color
+	Round      int
+	Trim       cli.Range
+	Speed      float64
+	Drop       int
+	Reverse    bool
+	PingPong   bool
+	Loop       int
+}
+
+// Return the key of a rendered meme, which is the hash of the loaded images
+// and the normalized options. The images must hold their encoded bytes, as
+// they do when loaded, so they aren't encoded to make the key.
+func outputKey(opt cli.Options, sources []stream.Stream) string {
+	flip := opt.Flip
+	if flip == "vh" {
+		flip = "hv"
+	}
+
+	ro := renderOptions{
+		Version:    cacheVersion,
+		Animate:    opt.Animate,
+		Delay:      opt.Delay,
+		Gif:        opt.Gif,
+		Shake:      opt.Shake,
+		Trigger:    opt.Trigger,
+		Top:        opt.Top,
+		Bottom:     opt.Bottom,
+		Boxes:      opt.Boxes,
+		TopCues:    opt.TopCues,
+		BottomCues: opt.BottomCues,
+		Font:       opt.Font,
+		Color:      parseColor(opt.Color),
+		Stroke:     parseColor(opt.Stroke),
+		MaxSize:    opt.MaxSize,
+		Crop:       opt.Crop,
+		Rotate:     opt.Rotate,
+		Flip:       flip,
+		Pad:        opt.Pad,
+		PadColor:   parseColor(opt.PadColor),
+		Round:      opt.Round,
+		Trim:       opt.Trim,
+		Speed:      opt.Speed,
+		Drop:       opt.Drop,
+		Reverse:    opt.Reverse,
+		PingPong:   opt.PingPong,
+		Loop:       opt.Loop,
+	}
+
+	var parts [][]byte
+	for _, src := range sources {
+		parts = append(parts, src.Bytes())
+	}
+
+	// The Go syntax representation quotes strings and includes infinite
+	// ranges, unlike json.
+	parts = append(parts, []byte(fmt.Sprintf("%#v", ro)))
+	return cache.Key(parts...)
+}
+
+// Return a stream of an embedded image, such as a template or decal. These
+// streams are kept in memory so each image is only read and decoded once. They
+// are also kept in the embedded cache of the options, if there is one, which
+// doesn't depend on the size of the memory cache.
+func embeddedStream(opt cli.Options, name string, load func() stream.Stream) stream.Stream {
+	if opt.Embedded != nil {
+		if v, ok := opt.Embedded.Get(name); ok {
+			return v.(stream.Stream)
+		}
+	}
+	if v, ok := cache.Value(cacheEmbedded, name); ok {
+		return v.(stream.Stream)
+	}
+
+	st := load()
+	w, h := st.Dimensions()
+	size := int64(len(st.Bytes()) + w*h*4*st.Frames())
+	cache.PutValue(cacheEmbedded, name, st, size)
+	if opt.Embedded != nil {
+		opt.Embedded.Put(name, st, size)
+	}
+	return st
+}
@@ -0,0 +1,78 @@
+package image
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nomad-software/meme/cache"
+	"github.com/nomad-software/meme/cli"
+	"github.com/nomad-software/meme/image/stream"
+	"github.com/nomad-software/meme/output"
+)
+
+func TestOutputKey(t *testing.T) {
+	var opt cli.Options
+	var doge, cat []stream.Stream
+	err := output.Catch(func() {
+		opt = cli.ParseJob(nil, map[string][]string{"i": {"doge"}, "t": {"wow"}, "flip": {"hv"}})
+		doge = []stream.Stream{Load(opt)}
+		opt.Image = "grumpy-cat"
+		cat = []stream.Stream{Load(opt)}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := outputKey(opt, doge)
+	flipped := opt
+	flipped.Flip = "vh"
+	if outputKey(flipped, doge) != key {
+		t.Errorf("the same flip has a different key")
+	}
+
+	changes := map[string]func(o *cli.Options){
+		"text":    func(o *cli.Options) { o.Top = "such wow" },
+		"animate": func(o *cli.Options) { o.Animate = true },
+		"delay":   func(o *cli.Options) { o.Delay++ },
+	}
+	for name, change := range changes {
+		changed := opt
+		change(&changed)
+		if outputKey(changed, doge) == key {
+			t.Errorf("changing the %s has the same key", name)
+		}
+	}
+
+	if outputKey(opt, cat) == key {
+		t.Errorf("a different image has the same key")
+	}
+	if outputKey(opt, append(doge, cat...)) == key {
+		t.Errorf("more frames have the same key")
+	}
+}
+
+func TestEmbeddedStream(t *testing.T) {
+	cache.Configure(0, "", 0, 0)
+	defer cache.Configure(256<<20, "", 0, 24*time.Hour)
+
+	load := func(opt cli.Options) (st stream.Stream) {
+		err := output.Catch(func() {
+			opt.Image = "doge"
+			st = Load(opt)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return st
+	}
+
+	var opt cli.Options
+	if load(opt) == load(opt) {
+		t.Errorf("the template was kept with the memory cache disabled")
+	}
+
+	opt.Embedded = cache.NewMemory(64<<20, 0)
+	if load(opt) != load(opt) {
+		t.Errorf("the template wasn't kept in the embedded cache")
+	}
+}
@@ -2,12 +2,13 @@ package draw
 
 import (
 	"image"
+	"image/color"
 	"math"
 	"strings"
 
 	"github.com/fogleman/gg"
+	"github.com/golang/freetype/truetype"
 	"github.com/nomad-software/meme/font"
-	"github.com/nomad-software/meme/output"
 )
 
 const (
@@ -19,34 +20,53 @@ const (
 	imageMargin       = 18.0 // px
 )
 
+// Style describes how the text is drawn.
+type Style struct {
+	Font   *truetype.Font
+	Fill   color.Color
+	Stroke color.Color
+}
+
 // NewContext creates a new context for the passed image
 func NewContext(img image.Image) *gg.Context {
 	return gg.NewContextForImage(img)
 }
 
 // TopBanner draws the top text onto the meme.
-func TopBanner(ctx *gg.Context, text string) {
+func TopBanner(ctx *gg.Context, s Style, text string) {
 	x := float64(ctx.Width()) / 2
 	y := imageMargin
-	drawText(ctx, text, x, y, 0.5, 0.0, topTextDivisor)
+	width := float64(ctx.Width()) - (imageMargin * 2)
+	height := float64(ctx.Height()) / topTextDivisor
+	drawText(ctx, s, text, x, y, 0.5, 0.0, width, height)
 }
 
 // BottomBanner draws the bottom text onto the meme.
-func BottomBanner(ctx *gg.Context, text string) {
+func BottomBanner(ctx *gg.Context, s Style, text string) {
 	x := float64(ctx.Width()) / 2
 	y := float64(ctx.Height()) - imageMargin
-	drawText(ctx, text, x, y, 0.5, 1.0, bottomTextDivisor)
+	width := float64(ctx.Width()) - (imageMargin * 2)
+	height := float64(ctx.Height()) / bottomTextDivisor
+	drawText(ctx, s, text, x, y, 0.5, 1.0, width, height)
 }
 
-// Draw text onto the meme.
-func drawText(ctx *gg.Context, text string, x float64, y float64, ax float64, ay float64, divisor float64) {
+// TextBox draws text centred in a box onto the meme. The box is positioned
+// using percentages of the image size.
+func TextBox(ctx *gg.Context, s Style, text string, left float64, top float64, width float64, height float64) {
+	w := float64(ctx.Width()) * width / 100
+	h := float64(ctx.Height()) * height / 100
+	x := float64(ctx.Width())*left/100 + w/2
+	y := float64(ctx.Height())*top/100 + h/2
+	drawText(ctx, s, text, x, y, 0.5, 0.5, w, h)
+}
+
+// Draw text onto the meme, fitting it into the passed width and height.
+func drawText(ctx *gg.Context, s Style, text string, x float64, y float64, ax float64, ay float64, width float64, height float64) {
 	text = strings.ToUpper(text)
-	width := float64(ctx.Width()) - (imageMargin * 2)
-	height := float64(ctx.Height()) / divisor
-	calculateFontSize(ctx, text, width, height)
+	calculateFontSize(ctx, s.Font, text, width, height)
 
 	// Draw the text border.
-	ctx.SetHexColor("#000")
+	ctx.SetColor(s.Stroke)
 	for angle := 0.0; angle < (2 * math.Pi); angle += 0.35 {
 		bx := x + (math.Sin(angle) * fontBorderRadius)
 		by := y + (math.Cos(angle) * fontBorderRadius)
@@ -54,18 +74,17 @@ func drawText(ctx *gg.Context, text string, x float64, y float64, ax float64, ay
 	}
 
 	// Draw the text itself.
-	ctx.SetHexColor("#FFF")
+	ctx.SetColor(s.Fill)
 	ctx.DrawStringWrapped(text, x, y, ax, ay, width, fontLeading, gg.AlignCenter)
 }
 
 // Dynamically calculate the correct size needed for text.
-func calculateFontSize(ctx *gg.Context, text string, width float64, height float64) {
+func calculateFontSize(ctx *gg.Context, f *truetype.Font, text string, width float64, height float64) {
 	for size := maxFontSize; size > 20; size-- {
 		var rWidth, rHeight float64
 		var lWidth, lHeight float64
 
-		err := ctx.LoadFontFace(font.Path, size)
-		output.OnError(err, "Could not load font file")
+		ctx.SetFontFace(font.Face(f, size))
 		lines := ctx.WordWrap(text, width)
 
 		for _, line := range lines {
@@ -0,0 +1,82 @@
+package image
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+const (
+	exifOrientationTag = 0x0112
+)
+
+// Read the exif orientation from the bytes of a jpeg.
+// Returns 1 (normal) if the orientation can't be determined.
+func exifOrientation(b []byte) int {
+	if len(b) < 4 || b[0] != 0xFF || b[1] != 0xD8 {
+		return 1
+	}
+
+	for x := 2; x+4 <= len(b); {
+		if b[x] != 0xFF {
+			return 1
+		}
+
+		marker := b[x+1]
+		if marker == 0xD9 || marker == 0xDA {
+			return 1 // End of image or start of scan, no more metadata.
+		}
+
+		size := int(binary.BigEndian.Uint16(b[x+2:]))
+		if size < 2 || x+2+size > len(b) {
+			return 1
+		}
+
+		segment := b[x+4 : x+2+size]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return tiffOrientation(segment[6:])
+		}
+
+		x += 2 + size
+	}
+
+	return 1
+}
+
+// Read the orientation tag from the first IFD of a tiff header.
+func tiffOrientation(b []byte) int {
+	if len(b) < 8 {
+		return 1
+	}
+
+	var order binary.ByteOrder
+	switch string(b[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	ifd := int(order.Uint32(b[4:]))
+	if ifd+2 > len(b) {
+		return 1
+	}
+
+	entries := int(order.Uint16(b[ifd:]))
+	for x := 0; x < entries; x++ {
+		entry := ifd + 2 + (x * 12)
+		if entry+12 > len(b) {
+			return 1
+		}
+		if order.Uint16(b[entry:]) == exifOrientationTag {
+			o := int(order.Uint16(b[entry+8:]))
+			if o < 1 || o > 8 {
+				return 1
+			}
+			return o
+		}
+	}
+
+	return 1
+}
@@ -0,0 +1,339 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/nomad-software/meme/cli"
+	"github.com/nomad-software/meme/output"
+)
+
+const (
+	maxRedirects = 5
+	dialTimeout  = 10 * time.Second
+)
+
+var (
+	// ErrFetch is the cause of failed downloads, such as when a host can't be
+	// reached or responds with an error.
+	ErrFetch = errors.New("Could not download the image")
+
+	// Clients are reused so connections are kept alive between downloads.
+	clients     = make(map[fetchConfig]*http.Client)
+	clientMutex sync.Mutex
+
+	// The addresses of the proxies in use. These are configured by the user,
+	// so they're trusted even if they're private.
+	proxies sync.Map
+
+	// Address ranges that aren't reachable on the internet, in addition to
+	// the private, loopback and link local ranges.
+	reservedPrefixes = []netip.Prefix{
+		netip.MustParsePrefix("0.0.0.0/8"),
+		netip.MustParsePrefix("100.64.0.0/10"),
+		netip.MustParsePrefix("192.0.0.0/24"),
+		netip.MustParsePrefix("198.18.0.0/15"),
+		netip.MustParsePrefix("240.0.0.0/4"),
+		netip.MustParsePrefix("64:ff9b::/96"),
+	}
+)
+
+// fetchConfig holds the options used to create a client.
+type fetchConfig struct {
+	timeout      time.Duration
+	proxy        string
+	allowPrivate bool
+	schemes      string
+	hosts        string
+}
+
+// Return true if the passed string is a URL, false if not.
+func isURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && u.Scheme != "" && u.Host != "" && !isFileURL(s)
+}
+
+// Download the image located at the passed image URL and return it.
+func downloadURL(opt cli.Options, url string) io.Reader {
+	return bytes.NewReader(fetch(opt, url))
+}
+
+// Download the file at the passed URL. Web pages are followed to their preview
+// image, e.g. the link to a tweet or article.
+func fetch(opt cli.Options, rawURL string) []byte {
+	return fetchURL(opt, rawURL, true)
+}
+
+// Download the file at the passed URL. The URL, any redirects and the
+// response are checked against the options first, and the download is stopped
+// once it's larger than allowed.
+func fetchURL(opt cli.Options, rawURL string, followPage bool) []byte {
+	u := checkURL(opt, rawURL)
+	if !opt.AllowPrivate {
+		checkHost(renderContext(opt), u.Hostname())
+	}
+
+	req, err := http.NewRequestWithContext(renderContext(opt), http.MethodGet, u.String(), nil)
+	output.OnError(err, "Request error")
+	req.Header.Set("User-Agent", opt.UserAgent)
+	req.Header.Set("Accept", "image/*, video/*;q=0.9, text/html;q=0.8, */*;q=0.1")
+
+	res, err := client(opt).Do(req)
+	checkContext(opt)
+	if errors.As(err, new(refusal)) {
+		output.OnError(err, "Request error")
+	}
+	onFetchError(err, "Request error")
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		output.Fail(ErrFetch, fmt.Sprintf("Could not access URL (%s)", res.Status))
+	}
+
+	typ := mediaType(res.Header.Get("Content-Type"))
+	page := followPage && isPage(typ)
+	if !page && !isMedia(typ) {
+		output.Error(fmt.Sprintf("The URL is not an image or video (%s)", typ))
+	}
+
+	max := int64(opt.MaxDownload) << 20
+	if res.ContentLength > max {
+		output.Error(fmt.Sprintf("The download is larger than %d MB", opt.MaxDownload))
+	}
+
+	b, err := io.ReadAll(io.LimitReader(res.Body, max+1))
+	checkContext(opt)
+	onFetchError(err, "Could not read response body")
+
+	if int64(len(b)) > max {
+		output.Error(fmt.Sprintf("The download is larger than %d MB", opt.MaxDownload))
+	}
+
+	if page {
+		src, ok := pageImage(b, res.Request.URL)
+		if !ok {
+			output.Error("The web page has no preview image (og:image or twitter:image)")
+		}
+		return fetchURL(opt, src, false)
+	}
+
+	return b
+}
+
+// refusal is an error stopping a download because of the options, rather than
+// a problem reaching the host.
+type refusal struct {
+	error
+}
+
+// Raise an error if a download failed, with ErrFetch as its cause.
+func onFetchError(err error, text string) {
+	if err != nil {
+		output.Fail(fmt.Errorf("%w: %w", ErrFetch, err), fmt.Sprintf("%s: %s", text, err))
+	}
+}
+
+// Fail if the scheme or host of the URL isn't allowed.
+func checkURL(opt cli.Options, rawURL string) *url.URL {
+	u, err := url.Parse(rawURL)
+	output.OnError(err, "Invalid URL")
+
+	if !matchList(opt.AllowSchemes, strings.ToLower(u.Scheme), false) {
+		output.Error(fmt.Sprintf("URL scheme not allowed: %s", u.Scheme))
+	}
+
+	if opt.AllowHosts != "" && !matchList(opt.AllowHosts, strings.ToLower(u.Hostname()), true) {
+		output.Error(fmt.Sprintf("Host not allowed: %s", u.Hostname()))
+	}
+
+	return u
+}
+
+// Return true if the value is in the comma separated list. Hosts can also
+// match a wildcard, e.g. '*.example.com'.
+func matchList(list string, value string, host bool) bool {
+	for _, item := range strings.Split(list, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item == value {
+			return true
+		}
+		if host && strings.HasPrefix(item, "*.") && strings.HasSuffix(value, item[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Fail if the host resolves to an address that isn't public. This gives a
+// clear error before connecting, and covers hosts reached through a proxy.
+// Connections made directly are checked again when dialing, as the host could
+// resolve differently the second time. Hosts that can't be resolved are left
+// to the proxy, or fail to connect.
+func checkHost(ctx context.Context, host string) {
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return
+	}
+
+	for _, addr := range addrs {
+		if !isPublic(addr) {
+			output.Error(fmt.Sprintf("The URL's host is a private address: %s", host))
+		}
+	}
+}
+
+// Return true if the address is reachable on the internet.
+func isPublic(addr netip.Addr) bool {
+	addr = addr.Unmap()
+
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() {
+		return false
+	}
+
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// Stop connections to addresses that aren't public. This runs after the host
+// has been resolved, so it can't be avoided by changing DNS records.
+func blockPrivate(network string, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+
+	if !isPublic(addr) {
+		return refusal{fmt.Errorf("%s is a private address", host)}
+	}
+	return nil
+}
+
+// Return the client used for the options, creating it if needed.
+func client(opt cli.Options) *http.Client {
+	cfg := fetchConfig{
+		timeout:      opt.FetchTimeout,
+		proxy:        opt.Proxy,
+		allowPrivate: opt.AllowPrivate,
+		schemes:      opt.AllowSchemes,
+		hosts:        opt.AllowHosts,
+	}
+
+	clientMutex.Lock()
+	defer clientMutex.Unlock()
+
+	if c, ok := clients[cfg]; ok {
+		return c
+	}
+
+	dialer := &net.Dialer{Timeout: dialTimeout, KeepAlive: 30 * time.Second}
+	safeDialer := &net.Dialer{Timeout: dialTimeout, KeepAlive: 30 * time.Second, Control: blockPrivate}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = proxyFunc(opt.Proxy)
+	transport.DialContext = func(ctx context.Context, network string, address string) (net.Conn, error) {
+		if _, ok := proxies.Load(address); ok || cfg.allowPrivate {
+			return dialer.DialContext(ctx, network, address)
+		}
+		return safeDialer.DialContext(ctx, network, address)
+	}
+
+	c := &http.Client{
+		Timeout:   opt.FetchTimeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return errors.New("Too many redirects")
+			}
+			err := output.Catch(func() {
+				checkURL(opt, req.URL.String())
+				if !cfg.allowPrivate {
+					checkHost(req.Context(), req.URL.Hostname())
+				}
+			})
+			if err != nil {
+				return refusal{err}
+			}
+			return nil
+		},
+	}
+
+	clients[cfg] = c
+	return c
+}
+
+// Return the function that chooses the proxy of a request, remembering the
+// addresses of the proxies so they can be connected to.
+func proxyFunc(proxy string) func(*http.Request) (*url.URL, error) {
+	choose := http.ProxyFromEnvironment
+	if proxy != "" {
+		u, err := url.Parse(proxy)
+		output.OnError(err, "Invalid proxy URL")
+		choose = http.ProxyURL(u)
+	}
+
+	return func(req *http.Request) (*url.URL, error) {
+		u, err := choose(req)
+		if u != nil {
+			proxies.Store(proxyAddr(u), true)
+		}
+		return u, err
+	}
+}
+
+// Return the address dialed to reach a proxy.
+func proxyAddr(u *url.URL) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+
+	port := "80"
+	switch u.Scheme {
+	case "https":
+		port = "443"
+	case "socks5", "socks5h":
+		port = "1080"
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// Return the media type of a Content-Type header.
+func mediaType(header string) string {
+	typ, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		return strings.ToLower(strings.TrimSpace(header))
+	}
+	return typ
+}
+
+// Return true if the media type could be an image or video. Servers that
+// don't know the type send no type or a generic binary type.
+func isMedia(typ string) bool {
+	switch typ {
+	case "", "application/octet-stream", "binary/octet-stream":
+		return true
+	}
+	return strings.HasPrefix(typ, "image/") || strings.HasPrefix(typ, "video/")
+}
@@ -0,0 +1,173 @@
+package image
+
+import (
+	"fmt"
+	"image"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/nfnt/resize"
+	"github.com/nomad-software/meme/cli"
+	"github.com/nomad-software/meme/image/stream"
+	"github.com/nomad-software/meme/output"
+)
+
+const (
+	maxFrames = 1000 // The most images an animation can be made from.
+)
+
+var (
+	frameExtensions = []string{".gif", ".jpeg", ".jpg", ".png"}
+)
+
+// LoadFrames loads a sequence of static images and assembles them into a gif
+// animation. Every frame is resized to fit the first frame and centred.
+func LoadFrames(opt cli.Options) stream.Stream {
+	return assembleFrames(opt, loadFrames(opt))
+}
+
+// Load the images of an animation without decoding them. The animation is
+// checked against the maximum pixels using the size of the first image, as
+// every frame is made the same size.
+func loadFrames(opt cli.Options) []stream.Stream {
+	names := expandFrames(opt.Images)
+	if len(names) == 0 {
+		output.Error("No animation frames found")
+	}
+	if len(names) > maxFrames {
+		output.Error(fmt.Sprintf("Animations can be made from at most %d images, not %d", maxFrames, len(names)))
+	}
+
+	var frames []stream.Stream
+	for _, name := range names {
+		st := stream.NewStream(open(opt, name))
+		checkPixels(opt, st)
+		frames = append(frames, st)
+	}
+
+	w, h := frames[0].Dimensions()
+	checkFrames(opt, reducedBounds(w, h, opt.MaxSize), len(frames))
+
+	return frames
+}
+
+// Assemble loaded images into a gif animation. Each image is decoded as it's
+// fitted to the first.
+func assembleFrames(opt cli.Options, frames []stream.Stream) stream.Stream {
+	bounds := reduceImage(frames[0].DecodeImage(), uint(opt.MaxSize)).Bounds()
+	bg := image.NewUniform(parseColor(opt.PadColor))
+
+	dst := &gif.GIF{
+		Image: make([]*image.Paletted, len(frames)),
+		Delay: make([]int, len(frames)),
+	}
+
+	for x, st := range frames {
+		dst.Image[x] = fitFrame(st.DecodeImage(), bounds, bg)
+		dst.Delay[x] = opt.Delay
+	}
+
+	return stream.FromGif(dst)
+}
+
+// Expand directories and glob patterns into a list of frames.
+// Directories are expanded into the images they contain, sorted by name.
+func expandFrames(names []string) []string {
+	var frames []string
+
+	for _, name := range names {
+		if isURL(name) || isDataURI(name) || isFileURL(name) || isClipboard(name) {
+			frames = append(frames, name)
+			continue
+		}
+
+		path, err := homedir.Expand(name)
+		output.OnError(err, "Could not expand path")
+
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			entries, err := os.ReadDir(path)
+			output.OnError(err, "Could not read frame directory")
+
+			for _, entry := range entries {
+				if !entry.IsDir() && isFrameFile(entry.Name()) {
+					frames = append(frames, filepath.Join(path, entry.Name()))
+				}
+			}
+			continue
+		}
+
+		if strings.ContainsAny(path, "*?[") {
+			matches, err := filepath.Glob(path)
+			output.OnError(err, "Invalid frame pattern")
+
+			if len(matches) == 0 {
+				output.Error(fmt.Sprintf("No frames match the pattern: %s", name))
+			}
+
+			sort.Strings(matches)
+			frames = append(frames, matches...)
+			continue
+		}
+
+		frames = append(frames, name)
+	}
+
+	return frames
+}
+
+// Return true if the file has the extension of a supported image.
+func isFrameFile(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, e := range frameExtensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// Return the bounds of an image of the passed size once it's been reduced to
+// the maximum size, rounding up.
+func reducedBounds(w int, h int, maxSize int) image.Rectangle {
+	if w > h && w > maxSize {
+		w, h = maxSize, (h*maxSize+w-1)/w
+	} else if h > w && h > maxSize {
+		w, h = (w*maxSize+h-1)/h, maxSize
+	}
+	return image.Rect(0, 0, w, h)
+}
+
+// Resize an image to fit inside the passed bounds, keeping its aspect ratio.
+// The image is centred and any uncovered area is filled with the background.
+func fitFrame(img image.Image, bounds image.Rectangle, bg image.Image) *image.Paletted {
+	w := bounds.Dx()
+	h := bounds.Dy()
+	iw := img.Bounds().Dx()
+	ih := img.Bounds().Dy()
+
+	if iw != w || ih != h {
+		if iw*h > ih*w {
+			img = resize.Resize(uint(w), 0, img, resize.Bilinear)
+		} else {
+			img = resize.Resize(0, uint(h), img, resize.Bilinear)
+		}
+	}
+
+	canvas := image.NewRGBA(bounds)
+	draw.Draw(canvas, bounds, bg, image.Point{}, draw.Src)
+
+	r := img.Bounds()
+	offset := image.Pt((w-r.Dx())/2, (h-r.Dy())/2)
+	draw.Draw(canvas, r.Sub(r.Min).Add(offset), img, r.Min, draw.Over)
+
+	frame := image.NewPaletted(bounds, palette.Plan9)
+	draw.FloydSteinberg.Draw(frame, bounds, canvas, image.Point{})
+
+	return frame
+}
@@ -0,0 +1,74 @@
+package image
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nomad-software/meme/cli"
+	"github.com/nomad-software/meme/output"
+)
+
+// Write the passed number of 100x50 frames to a new directory.
+func writeFrames(t *testing.T, frames int) string {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 100, 50))); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	for x := range frames {
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("%04d.png", x)), buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoadFrames(t *testing.T) {
+	tests := []struct {
+		frames int
+		values map[string][]string
+		ok     bool
+	}{
+		{200, map[string][]string{"max-pixels": {"1"}}, true},
+		{201, map[string][]string{"max-pixels": {"1"}}, false},
+		{400, map[string][]string{"max-pixels": {"1"}, "max-size": {"50"}}, true},
+		{maxFrames, nil, true},
+		{maxFrames + 1, nil, false},
+	}
+
+	for _, test := range tests {
+		dir := writeFrames(t, test.frames)
+		err := output.Catch(func() {
+			opt := cli.ParseJob(nil, test.values)
+			opt.Images = []string{dir}
+			loadFrames(opt)
+		})
+		if (err == nil) != test.ok {
+			t.Errorf("%d frames %v: got error %v", test.frames, test.values, err)
+		}
+	}
+}
+
+func TestReducedBounds(t *testing.T) {
+	tests := []struct {
+		w, h, max int
+		want      image.Rectangle
+	}{
+		{100, 50, 650, image.Rect(0, 0, 100, 50)},
+		{2000, 1000, 650, image.Rect(0, 0, 650, 325)},
+		{1000, 2001, 650, image.Rect(0, 0, 325, 650)},
+		{700, 700, 650, image.Rect(0, 0, 700, 700)},
+	}
+
+	for _, test := range tests {
+		if got := reducedBounds(test.w, test.h, test.max); got != test.want {
+			t.Errorf("%dx%d: got %v, want %v", test.w, test.h, got, test.want)
+		}
+	}
+}
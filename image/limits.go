@@ -0,0 +1,71 @@
+package image
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"github.com/fogleman/gg"
+
+	"github.com/nomad-software/meme/cli"
+	"github.com/nomad-software/meme/image/stream"
+	"github.com/nomad-software/meme/output"
+)
+
+// Fail if the image has more pixels than allowed, counting every frame of a
+// gif. Only the headers are read, so images that would use a huge amount of
+// memory are rejected before they're decoded.
+func checkPixels(opt cli.Options, st stream.Stream) {
+	w, h := st.Dimensions()
+
+	frames := st.Frames()
+	if int64(w)*int64(h)*int64(frames) > int64(opt.MaxPixels)*1000000 {
+		output.Error(fmt.Sprintf("The image is too large (%dx%d, %d frames), the maximum is %d million pixels", w, h, frames, opt.MaxPixels))
+	}
+}
+
+// Fail if transforming the image would make it larger than allowed. The size
+// is worked out from the headers before anything is allocated, as padding and
+// rotating can make a small image much larger.
+func checkTransform(opt cli.Options, st stream.Stream) {
+	w, h := st.Dimensions()
+	tw, th := transformedSize(opt, w, h)
+
+	frames := 1
+	if st.IsGif() && isAnimated(opt, st) {
+		frames = st.Frames()
+	}
+
+	if tw*th*float64(frames) > float64(opt.MaxPixels)*1000000 {
+		output.Error(fmt.Sprintf("The transformed image is too large (%.0fx%.0f, %d frames), the maximum is %d million pixels", tw, th, frames, opt.MaxPixels))
+	}
+}
+
+// Return the size of an image of the passed size once it's been cropped,
+// rotated and padded.
+func transformedSize(opt cli.Options, w int, h int) (float64, float64) {
+	if opt.Crop != "" {
+		rect := cropRect(opt.Crop, image.Rect(0, 0, w, h))
+		w, h = rect.Dx(), rect.Dy()
+	}
+
+	tw, th := float64(w), float64(h)
+
+	if opt.Rotate != 0 {
+		rad := gg.Radians(opt.Rotate)
+		tw = math.Ceil(math.Abs(float64(w)*math.Cos(rad)) + math.Abs(float64(h)*math.Sin(rad)))
+		th = math.Ceil(math.Abs(float64(w)*math.Sin(rad)) + math.Abs(float64(h)*math.Cos(rad)))
+	}
+
+	pad := float64(opt.Pad) * 2
+	return tw + pad, th + pad
+}
+
+// Fail if an animation made from an image of the passed size has more pixels
+// than allowed, counting every frame. This is checked before the frames are
+// made.
+func checkFrames(opt cli.Options, b image.Rectangle, frames int) {
+	if int64(b.Dx())*int64(b.Dy())*int64(frames) > int64(opt.MaxPixels)*1000000 {
+		output.Error(fmt.Sprintf("The animation is too large (%dx%d, %d frames), the maximum is %d million pixels", b.Dx(), b.Dy(), frames, opt.MaxPixels))
+	}
+}
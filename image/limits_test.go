@@ -0,0 +1,59 @@
+package image
+
+import (
+	"testing"
+
+	"github.com/nomad-software/meme/cli"
+	"github.com/nomad-software/meme/output"
+)
+
+func TestCheckTransform(t *testing.T) {
+	// The doge template is 620x620.
+	tests := []struct {
+		values map[string][]string
+		ok     bool
+	}{
+		{map[string][]string{"pad": {"100"}}, true},
+		{map[string][]string{"pad": {"4000"}}, true},
+		{map[string][]string{"pad": {"4800"}}, false},
+		{map[string][]string{"pad": {"4800"}, "crop": {"0,0,10,10"}}, true},
+		{map[string][]string{"pad": {"4800"}, "max-pixels": {"200"}}, true},
+		{map[string][]string{"rotate": {"45"}, "pad": {"3300"}}, true},
+		{map[string][]string{"rotate": {"45"}, "pad": {"4600"}}, false},
+	}
+
+	for _, test := range tests {
+		test.values["i"] = []string{"doge"}
+		err := output.Catch(func() {
+			opt := cli.ParseJob(nil, test.values)
+			opt.Valid()
+			checkTransform(opt, Load(opt))
+		})
+		if (err == nil) != test.ok {
+			t.Errorf("%v: got error %v", test.values, err)
+		}
+	}
+}
+
+func TestCheckFrames(t *testing.T) {
+	tests := []struct {
+		values map[string][]string
+		ok     bool
+	}{
+		{map[string][]string{"t": {"0-0.2s:hold"}, "max-size": {"50"}}, true},
+		{map[string][]string{"t": {"0-50s:shake"}, "shake": {"true"}}, false},
+		{map[string][]string{"t": {"0-50s:hold"}, "max-pixels": {"1"}}, false},
+	}
+
+	for _, test := range tests {
+		test.values["i"] = []string{"doge"}
+		err := output.Catch(func() {
+			opt := cli.ParseJob(nil, test.values)
+			opt.Valid()
+			Generate(opt)
+		})
+		if (err == nil) != test.ok {
+			t.Errorf("%v: got error %v", test.values, err)
+		}
+	}
+}
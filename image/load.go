@@ -4,13 +4,14 @@ import (
 	"bytes"
 	"io"
 	"io/ioutil"
-	"net/http"
 	"os"
 	"path"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/mitchellh/go-homedir"
+	"github.com/nomad-software/meme/cache"
 	"github.com/nomad-software/meme/cli"
 	"github.com/nomad-software/meme/data"
 	"github.com/nomad-software/meme/image/stream"
@@ -19,6 +20,11 @@ import (
 
 var (
 	imageMap = make(map[string]string)
+
+	// Downloads in progress, so generating many memes from the same URL at
+	// the same time only downloads it once.
+	sources     = make(map[string]*source)
+	sourceMutex sync.Mutex
 )
 
 // Initialise the package.
@@ -33,27 +39,151 @@ func init() {
 }
 
 // Load an image from the passed string or stdin.
-// The string will be a embedded asset id, an image URL or a local file.
+// The string will be a embedded asset id, an image URL, a web page with a
+// preview image, a data URI, a file URL, a local file or 'clipboard'.
 func Load(opt cli.Options) stream.Stream {
-	var s io.Reader
+	if opt.IsVideo() {
+		return loadVideo(opt)
+	}
 
+	// Templates are built in, so they don't need checking.
+	if isAsset(opt.Image) {
+		return loadCached(opt, opt.Image)
+	}
+
+	var st stream.Stream
 	if isURL(opt.Image) {
-		s = downloadURL(opt.Image)
+		st = loadCached(opt, opt.Image)
+	} else {
+		st = stream.NewStream(open(opt, opt.Image))
+	}
+
+	checkPixels(opt, st)
+	return st
+}
+
+// Generate loads the image (or animation frames) referenced by the options and
+// renders the meme.
+func Generate(opt cli.Options) stream.Stream {
+	report(opt, stageLoading, 0, 1)
+
+	var sources []stream.Stream
+	if opt.Animate {
+		sources = loadFrames(opt)
+	} else {
+		sources = []stream.Stream{Load(opt)}
+	}
+
+	key := outputKey(opt, sources)
+	if b, ok := cache.Bytes(cacheOutput, key); ok {
+		report(opt, stageLoading, 1, 1)
+		return stream.FromBytes(b)
+	}
+
+	st := sources[0]
+	if opt.Animate {
+		st = assembleFrames(opt, sources)
+	}
+
+	report(opt, stageLoading, 1, 1)
+
+	st = RenderImage(opt, st)
+	cache.PutBytes(cacheOutput, key, st.Bytes())
+	return st
+}
+
+// source is a download in progress. Each has its own lock so different
+// sources can be downloaded at the same time.
+type source struct {
+	sync.Mutex
+	users int
+}
+
+// Load a template or download an image, reusing it if it has been loaded
+// before. Downloads are cached by URL.
+func loadCached(opt cli.Options, image string) stream.Stream {
+	if isAsset(image) {
+		return embeddedStream(opt, image, func() stream.Stream {
+			return stream.NewStream(loadAsset(image))
+		})
+	}
+
+	// The URL is checked before looking in the cache, so it can't be used to
+	// avoid the allowed schemes and hosts.
+	checkURL(opt, image)
+
+	key := cache.Key([]byte(image))
+	src := lockSource(key)
+	defer unlockSource(key, src)
+
+	if b, ok := cache.Bytes(cacheSource, key); ok {
+		return stream.FromBytes(b)
+	}
 
-	} else if isStdin(opt.Image) {
+	st := stream.NewStream(open(opt, image))
+	cache.PutBytes(cacheSource, key, st.Bytes())
+	return st
+}
+
+// Lock the source with the passed key, waiting for any download of it to
+// finish.
+func lockSource(key string) *source {
+	sourceMutex.Lock()
+	src, ok := sources[key]
+	if !ok {
+		src = &source{}
+		sources[key] = src
+	}
+	src.users++
+	sourceMutex.Unlock()
+
+	src.Lock()
+	return src
+}
+
+// Unlock the source with the passed key, forgetting it once it's unused.
+func unlockSource(key string, src *source) {
+	src.Unlock()
+
+	sourceMutex.Lock()
+	defer sourceMutex.Unlock()
+
+	src.users--
+	if src.users == 0 {
+		delete(sources, key)
+	}
+}
+
+// Open the image referenced by the passed string.
+func open(opt cli.Options, image string) io.Reader {
+	var s io.Reader
+
+	if isURL(image) {
+		s = downloadURL(opt, image)
+
+	} else if isDataURI(image) {
+		s = decodeDataURI(opt, image)
+
+	} else if isFileURL(image) {
+		s = readFile(filePath(image))
+
+	} else if isStdin(image) {
 		s = readStdin()
 
-	} else if isAsset(opt.Image) {
-		s = loadAsset(opt.Image)
+	} else if isAsset(image) {
+		s = loadAsset(image)
 
-	} else if isLocalFile(opt.Image) {
-		s = readFile(opt.Image)
+	} else if isLocalFile(image) {
+		s = readFile(image)
+
+	} else if isClipboard(image) {
+		s = readClipboard(opt)
 
 	} else {
 		output.Error("Image not recognised")
 	}
 
-	return stream.NewStream(s)
+	return s
 }
 
 // Return true if the passed string is an embedded asset id, false if not.
@@ -73,27 +203,6 @@ func loadAsset(id string) io.Reader {
 	return bytes.NewReader(st)
 }
 
-// Return true if the passed string is an image URL, false if not.
-func isURL(url string) bool {
-	return strings.HasPrefix(url, "http")
-}
-
-// Download the image located at the passed image URL, decode and return it.
-func downloadURL(url string) io.Reader {
-	res, err := http.Get(url)
-	output.OnError(err, "Request error")
-	defer res.Body.Close()
-
-	if res.StatusCode != 200 {
-		output.Error("Could not access URL")
-	}
-
-	st, err := ioutil.ReadAll(res.Body)
-	output.OnError(err, "Could not read response body")
-
-	return bytes.NewReader(st)
-}
-
 // Return true if the passed string is a file that exists on the local
 // filesystem, false if not.
 func isLocalFile(path string) bool {
@@ -131,9 +240,10 @@ func readStdin() io.Reader {
 }
 
 // Decal returns the named decal as a stream.
-func Decal(name string) stream.Stream {
-	st, err := data.Files.ReadFile(name)
-	output.OnError(err, "Could not read embedded decal")
-
-	return stream.NewStream(bytes.NewReader(st))
+func Decal(opt cli.Options, name string) stream.Stream {
+	return embeddedStream(opt, name, func() stream.Stream {
+		b, err := data.Files.ReadFile(name)
+		output.OnError(err, "Could not read embedded decal")
+		return stream.FromBytes(b)
+	})
 }
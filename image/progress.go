@@ -0,0 +1,71 @@
+package image
+
+import (
+	"bytes"
+	"context"
+	"image/gif"
+	"io"
+
+	"github.com/nomad-software/meme/cli"
+	"github.com/nomad-software/meme/image/stream"
+	"github.com/nomad-software/meme/output"
+)
+
+// Stages of rendering reported as progress.
+const (
+	stageLoading    = "loading"
+	stageShaking    = "shaking"
+	stageTriggering = "triggering"
+	stageReducing   = "reducing"
+	stageDrawing    = "drawing"
+	stageEncoding   = "encoding"
+)
+
+// Return the context that stops rendering.
+func renderContext(opt cli.Options) context.Context {
+	if opt.Context == nil {
+		return context.Background()
+	}
+	return opt.Context
+}
+
+// Stop rendering if the context is done.
+func checkContext(opt cli.Options) {
+	output.OnError(renderContext(opt).Err(), "Rendering stopped")
+}
+
+// Report the progress of a stage of rendering, stopping if the context is
+// done. This must be called from the goroutine rendering the meme.
+func report(opt cli.Options, stage string, done int, total int) {
+	checkContext(opt)
+	if opt.Progress != nil {
+		opt.Progress(stage, done, total)
+	}
+}
+
+// Encode a gif, stopping part way through if the context is done.
+func encodeGif(opt cli.Options, g *gif.GIF) stream.Stream {
+	report(opt, stageEncoding, 0, 1)
+
+	var buf bytes.Buffer
+	err := gif.EncodeAll(contextWriter{renderContext(opt), &buf}, g)
+	checkContext(opt)
+	stream.OnEncodeError(err, "Could not encode gif")
+
+	report(opt, stageEncoding, 1, 1)
+	return stream.FromBytes(buf.Bytes())
+}
+
+// contextWriter fails writes once its context is done.
+type contextWriter struct {
+	ctx context.Context
+	w   io.Writer
+}
+
+// Write implements the io.Writer interface.
+func (w contextWriter) Write(b []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return w.w.Write(b)
+}
@@ -2,6 +2,7 @@ package image
 
 import (
 	"image"
+	"image/color"
 	"image/color/palette"
 	"image/draw"
 	"image/gif"
@@ -9,30 +10,36 @@ import (
 	"math/rand"
 	"time"
 
+	"github.com/fogleman/gg"
 	"github.com/nfnt/resize"
 	"github.com/nomad-software/meme/cli"
 	"github.com/nomad-software/meme/data"
+	"github.com/nomad-software/meme/font"
 	gfx "github.com/nomad-software/meme/image/draw"
 	"github.com/nomad-software/meme/image/stream"
 )
 
 const (
-	maxImageSize   = 650 // px
-	shakeDelay     = 2   // 100ths of a second
-	shakeFrames    = 10  // Number of frames to create when shaking static images
-	shakeIntensity = 8   // px
+	holdDelay      = 10 // 100ths of a second
+	shakeDelay     = 2  // 100ths of a second
+	shakeFrames    = 10 // Number of frames to create when shaking static images
+	shakeIntensity = 8  // px
 )
 
 // RenderImage performs the graphical manipulation of the image.
 func RenderImage(opt cli.Options, st stream.Stream) stream.Stream {
+	st = transform(opt, st)
+
 	if opt.Trigger {
-		st = shake(st)
-		st = trigger(st)
+		st = shake(opt, st)
+		st = trigger(opt, st)
 	} else if opt.Shake {
-		st = shake(st)
+		st = shake(opt, st)
+	} else if opt.Timed() && !st.IsGif() {
+		st = holdImage(opt, st)
 	}
 
-	if opt.Trigger || opt.Shake || (opt.Gif && st.IsGif()) {
+	if isAnimated(opt, st) {
 		st = renderGif(opt, st)
 	} else {
 		st = renderImage(opt, st)
@@ -41,63 +48,52 @@ func RenderImage(opt cli.Options, st stream.Stream) stream.Stream {
 	return st
 }
 
+// Return true if the passed options and stream produce an animation.
+func isAnimated(opt cli.Options, st stream.Stream) bool {
+	return opt.Trigger || opt.Shake || opt.Timed() || (opt.Gif && st.IsGif())
+}
+
 // Trigger adds the triggered banner.
-func trigger(st stream.Stream) stream.Stream {
+func trigger(opt cli.Options, st stream.Stream) stream.Stream {
 	src := st.DecodeGif()
 	width := uint(src.Config.Width + (shakeIntensity * 2))
-	ds := Decal(data.TriggeredDecal)
+	ds := Decal(opt, data.TriggeredDecal)
 	decal := resize.Resize(width, 0, ds.DecodeImage(), resize.NearestNeighbor)
-	queue := make(chan triggerInfo)
-
-	for x, frame := range src.Image {
-		ti := triggerInfo{
-			frame: frame,
-			decal: decal,
-			index: x,
-		}
-		go processTrigger(ti, queue)
-	}
+	pool := newFramePool(opt, stageTriggering, len(src.Image), frameSize(src.Image[0].Bounds(), 1))
 
-	for range src.Image {
-		ti := <-queue
-		src.Image[ti.index] = ti.frame
+	for _, frame := range src.Image {
+		pool.Go(func() {
+			processTrigger(frame, decal)
+		})
 	}
 
-	close(queue)
-	return stream.EncodeGif(src)
-}
-
-// A unit of work containing frame information for triggering gifs.
-type triggerInfo struct {
-	frame *image.Paletted
-	decal image.Image
-	index int
+	pool.Wait()
+	return stream.FromGif(src)
 }
 
 // Draw the triggered banner on the frame.
-func processTrigger(ti triggerInfo, output chan triggerInfo) {
+func processTrigger(frame *image.Paletted, decal image.Image) {
 	r := rand.New(rand.NewSource(time.Now().UnixNano()))
 	rx := r.Intn(shakeIntensity*2) - shakeIntensity
 	ry := r.Intn(shakeIntensity*2) - shakeIntensity
 
-	fHeight := ti.frame.Bounds().Dy()
-	dHeight := ti.decal.Bounds().Dy()
+	fHeight := frame.Bounds().Dy()
+	dHeight := decal.Bounds().Dy()
 
 	x := shakeIntensity + rx
 	y := (fHeight - (dHeight - shakeIntensity)) + ry
 
 	point := image.Point{x, -y}
 
-	draw.FloydSteinberg.Draw(ti.frame, ti.frame.Bounds(), ti.decal, point)
-	output <- ti
+	draw.FloydSteinberg.Draw(frame, frame.Bounds(), decal, point)
 }
 
 // Shake randomly shakes an image.
-func shake(st stream.Stream) stream.Stream {
+func shake(opt cli.Options, st stream.Stream) stream.Stream {
 	if st.IsGif() {
-		return shakeGif(st)
+		return shakeGif(opt, st)
 	}
-	return shakeImage(st)
+	return shakeImage(opt, st)
 }
 
 // Create a random point for shaking the image.
@@ -120,7 +116,7 @@ func shakeBounds(b image.Rectangle) image.Rectangle {
 // shakeGif randomly shakes a gif.
 // This function can't use concurrency because normalising the gif needs a
 // shared base image for all frames.
-func shakeGif(st stream.Stream) stream.Stream {
+func shakeGif(opt cli.Options, st stream.Stream) stream.Stream {
 	src := st.DecodeGif()
 	base := src.Image[0]
 	images := make([]*image.Paletted, len(src.Image))
@@ -138,6 +134,7 @@ func shakeGif(st stream.Stream) stream.Stream {
 
 		images[x] = img.SubImage(crop).(*image.Paletted)
 		delays[x] = shakeDelay
+		report(opt, stageShaking, x+1, len(src.Image))
 	}
 
 	dst := &gif.GIF{
@@ -145,78 +142,122 @@ func shakeGif(st stream.Stream) stream.Stream {
 		Delay: delays,
 	}
 
-	return stream.EncodeGif(dst)
-}
-
-// A unit of work containing frame information for shaking an image.
-type shakeImgInfo struct {
-	img   image.Image
-	frame *image.Paletted
-	point image.Point
-	crop  image.Rectangle
-	index int
+	return stream.FromGif(dst)
 }
 
 // shakeImage randomly shakes an image creating a gif animation.
 // This function can use concurrency because nothing is shared between frames.
-func shakeImage(st stream.Stream) stream.Stream {
+func shakeImage(opt cli.Options, st stream.Stream) stream.Stream {
 	src := st.DecodeImage()
-	images := make([]*image.Paletted, shakeFrames)
-	delays := make([]int, shakeFrames)
+	frames := captionFrames(opt, shakeDelay)
+	if frames < shakeFrames {
+		frames = shakeFrames
+	}
+	checkFrames(opt, src.Bounds(), frames)
+	images := make([]*image.Paletted, frames)
+	delays := make([]int, frames)
 	crop := shakeBounds(src.Bounds())
-	queue := make(chan shakeImgInfo)
+	pool := newFramePool(opt, stageShaking, frames, frameSize(src.Bounds(), 1))
 	shakePoint := pointShaker()
 
 	for x := range images {
-		si := shakeImgInfo{
-			img:   src,
-			point: shakePoint(),
-			crop:  crop,
-			index: x,
-		}
-		go processImageShake(si, queue)
-	}
-
-	for range images {
-		si := <-queue
-		images[si.index] = si.frame
-		delays[si.index] = shakeDelay
+		point := shakePoint()
+		pool.Go(func() {
+			images[x] = processImageShake(src, point, crop)
+		})
+		delays[x] = shakeDelay
 	}
 
-	close(queue)
+	pool.Wait()
 
 	dst := &gif.GIF{
 		Image: images,
 		Delay: delays,
 	}
 
-	return stream.EncodeGif(dst)
+	return stream.FromGif(dst)
 }
 
 // Process shaking an image.
-func processImageShake(si shakeImgInfo, output chan shakeImgInfo) {
-	img := image.NewPaletted(si.img.Bounds(), palette.Plan9)
-	draw.FloydSteinberg.Draw(img, img.Bounds(), si.img, si.point)
-	si.frame = img.SubImage(si.crop).(*image.Paletted)
+func processImageShake(src image.Image, point image.Point, crop image.Rectangle) *image.Paletted {
+	img := image.NewPaletted(src.Bounds(), palette.Plan9)
+	draw.FloydSteinberg.Draw(img, img.Bounds(), src, point)
+	return img.SubImage(crop).(*image.Paletted)
+}
+
+// holdImage repeats a static image to create a gif animation long enough to
+// show all of the timed captions. The image is reduced first, as every frame
+// is drawn on separately.
+func holdImage(opt cli.Options, st stream.Stream) stream.Stream {
+	src := reduceImage(st.DecodeImage(), uint(opt.MaxSize))
+	frames := captionFrames(opt, holdDelay)
+	if frames < 1 {
+		frames = 1
+	}
+	checkFrames(opt, src.Bounds(), frames)
+
+	img := image.NewPaletted(src.Bounds(), palette.Plan9)
+	draw.FloydSteinberg.Draw(img, img.Bounds(), src, src.Bounds().Min)
+
+	dst := &gif.GIF{
+		Image: make([]*image.Paletted, frames),
+		Delay: make([]int, frames),
+	}
+
+	for x := range dst.Image {
+		dst.Image[x] = img
+		dst.Delay[x] = holdDelay
+	}
 
-	output <- si
+	return stream.FromGif(dst)
+}
+
+// Calculate how many frames of the passed delay are needed to show all of the
+// timed captions.
+func captionFrames(opt cli.Options, delay int) int {
+	frames, seconds := opt.CaptionLength()
+	n := int(math.Ceil(seconds * 100 / float64(delay)))
+	if frames > n {
+		return frames
+	}
+	return n
 }
 
 // RenderImage performs the graphical manipulation of the image.
 func renderImage(opt cli.Options, st stream.Stream) stream.Stream {
 	img := st.DecodeImage()
-	img = reduceImage(img, maxImageSize)
+	img = reduceImage(img, uint(opt.MaxSize))
 
 	// Draw on the text.
+	style := textStyle(opt)
 	ctx := gfx.NewContext(img)
 	if opt.Top != "" {
-		gfx.TopBanner(ctx, opt.Top)
+		gfx.TopBanner(ctx, style, opt.Top)
 	}
 	if opt.Bottom != "" {
-		gfx.BottomBanner(ctx, opt.Bottom)
+		gfx.BottomBanner(ctx, style, opt.Bottom)
 	}
+	drawBoxes(ctx, style, opt.Boxes)
 
-	return stream.EncodeImage(ctx.Image())
+	return stream.FromImage(ctx.Image())
+}
+
+// Draw the text boxes onto the meme.
+func drawBoxes(ctx *gg.Context, style gfx.Style, boxes []cli.Box) {
+	for _, b := range boxes {
+		if b.Text != "" {
+			gfx.TextBox(ctx, style, b.Text, b.X, b.Y, b.Width, b.Height)
+		}
+	}
+}
+
+// Return the style used to draw the text.
+func textStyle(opt cli.Options) gfx.Style {
+	return gfx.Style{
+		Font:   font.Load(opt.Font),
+		Fill:   parseColor(opt.Color),
+		Stroke: parseColor(opt.Stroke),
+	}
 }
 
 // reduceImage will resize an image if any of its dimensions are above the passed max
@@ -238,39 +279,57 @@ func reduceImage(img image.Image, maxSize uint) image.Image {
 type drawInfo struct {
 	bounds image.Rectangle
 	frame  *image.Paletted
-	index  int
+	style  gfx.Style
 	top    string
 	bottom string
+	boxes  []cli.Box
 }
 
 // RenderGif performs the graphical manipulation of the gif.
 func renderGif(opt cli.Options, st stream.Stream) stream.Stream {
 	src := st.DecodeGif()
-	src = reduceGif(opt, src, maxImageSize)
-	queue := make(chan drawInfo)
+	src = editGif(opt, src)
+	src = reduceGif(opt, src, opt.MaxSize)
+
+	// Each frame is expanded to the size of the first, then drawn on using an
+	// RGBA context and converted back.
+	bounds := src.Image[0].Bounds()
+	pool := newFramePool(opt, stageDrawing, len(src.Image), frameSize(bounds, 6))
+	style := textStyle(opt)
+
+	var duration, elapsed float64
+	for _, delay := range src.Delay {
+		duration += float64(delay) / 100
+	}
 
 	for x, frame := range src.Image {
 		fi := drawInfo{
-			bounds: src.Image[0].Bounds(),
+			bounds: bounds,
 			frame:  frame,
-			index:  x,
+			style:  style,
 			top:    opt.Top,
 			bottom: opt.Bottom,
+			boxes:  opt.Boxes,
 		}
-		go processFrameDraw(fi, queue)
-	}
+		if len(opt.TopCues) > 0 {
+			fi.top = cli.CaptionAt(opt.TopCues, x, elapsed, len(src.Image), duration)
+		}
+		if len(opt.BottomCues) > 0 {
+			fi.bottom = cli.CaptionAt(opt.BottomCues, x, elapsed, len(src.Image), duration)
+		}
+		elapsed += float64(src.Delay[x]) / 100
 
-	for range src.Image {
-		fi := <-queue
-		src.Image[fi.index] = fi.frame
+		pool.Go(func() {
+			src.Image[x] = processFrameDraw(fi)
+		})
 	}
 
-	close(queue)
-	return stream.EncodeGif(src)
+	pool.Wait()
+	return encodeGif(opt, src)
 }
 
 // Process drawing on each gif frame.
-func processFrameDraw(fi drawInfo, output chan drawInfo) {
+func processFrameDraw(fi drawInfo) *image.Paletted {
 	// Expand each frame, if needed, so it's the same size as the base.
 	// This is to make it easier to draw and position the text.
 	img := image.NewPaletted(fi.bounds, fi.frame.Palette)
@@ -279,31 +338,24 @@ func processFrameDraw(fi drawInfo, output chan drawInfo) {
 	// Draw on the text.
 	ctx := gfx.NewContext(img)
 	if fi.top != "" {
-		gfx.TopBanner(ctx, fi.top)
+		gfx.TopBanner(ctx, fi.style, fi.top)
 	}
 	if fi.bottom != "" {
-		gfx.BottomBanner(ctx, fi.bottom)
+		gfx.BottomBanner(ctx, fi.style, fi.bottom)
 	}
+	drawBoxes(ctx, fi.style, fi.boxes)
 
 	// Convert the graphic context to a paletted image.
 	img = image.NewPaletted(img.Bounds(), img.Palette)
 	draw.Draw(img, img.Bounds(), ctx.Image(), image.ZP, draw.Src)
 
-	fi.frame = img.SubImage(fi.frame.Bounds()).(*image.Paletted)
-	output <- fi
-}
-
-// A unit of work containing frame information for reducing a gif frame.
-type reduceInfo struct {
-	config *image.Config
-	base   *image.RGBA
-	frame  *image.Paletted
-	fctr   float64
-	index  int
+	return img.SubImage(fi.frame.Bounds()).(*image.Paletted)
 }
 
 // reduceGif will resize a gif if any of its dimensions are above the passed max
 // size.
+// Each frame is drawn over the frames before it, so frames are drawn onto a
+// shared base in order, then a copy of the base is resized concurrently.
 func reduceGif(opt cli.Options, src *gif.GIF, maxSize int) *gif.GIF {
 	first := src.Image[0]
 	fctr := calcFactor(first, maxSize)
@@ -313,49 +365,56 @@ func reduceGif(opt cli.Options, src *gif.GIF, maxSize int) *gif.GIF {
 		return src
 	}
 
+	resBounds := reduceBounds(first.Bounds(), fctr)
+	src.Config.Width = resBounds.Dx()
+	src.Config.Height = resBounds.Dy()
+
+	// Each frame uses a copy of the base, the resized image and the new frame.
+	size := frameSize(first.Bounds(), 4) + frameSize(resBounds, 5)
+	pool := newFramePool(opt, stageReducing, len(src.Image), size)
 	base := image.NewRGBA(first.Bounds())
 
 	for x, frame := range src.Image {
-		rs := reduceInfo{
-			config: &src.Config,
-			base:   base,
-			frame:  frame,
-			fctr:   fctr,
-			index:  x,
+		if frame.Bounds().Dx() == 0 || frame.Bounds().Dy() == 0 {
+			pool.Skip() // Empty frame, don't change or can cause corruption.
+			continue
 		}
-		src.Image[x] = processFrameReduction(rs)
-	}
 
-	return src
-}
+		// Draw over the base.
+		draw.Draw(base, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
 
-// Process resizing each gif frame at max quality.
-func processFrameReduction(rs reduceInfo) *image.Paletted {
-	if rs.index == 0 {
-		resBounds := reduceBounds(rs.frame.Bounds(), rs.fctr)
-		rs.config.Width = resBounds.Dx()
-		rs.config.Height = resBounds.Dy()
-	}
+		composite := image.NewRGBA(base.Bounds())
+		copy(composite.Pix, base.Pix)
 
-	if rs.frame.Bounds().Dx() == 0 || rs.frame.Bounds().Dy() == 0 {
-		return rs.frame // Empty frame, don't change or can cause corruption.
+		pool.Go(func() {
+			src.Image[x] = processFrameReduction(composite, frame.Palette, src.Config)
+		})
 	}
 
-	// Draw over the base.
-	draw.Draw(rs.base, rs.frame.Bounds(), rs.frame, rs.frame.Bounds().Min, draw.Over)
+	pool.Wait()
+	return src
+}
 
+// Process resizing each gif frame at max quality.
+func processFrameReduction(composite *image.RGBA, p color.Palette, config image.Config) *image.Paletted {
 	// Resize the base to the required size.
-	w := uint(rs.config.Width)
-	h := uint(rs.config.Height)
-	res := resize.Resize(w, h, rs.base, resize.NearestNeighbor)
+	w := uint(config.Width)
+	h := uint(config.Height)
+	res := resize.Resize(w, h, composite, resize.NearestNeighbor)
 
 	// Create a new frame.
-	img := image.NewPaletted(res.Bounds(), rs.frame.Palette)
+	img := image.NewPaletted(res.Bounds(), p)
 	draw.Draw(img, res.Bounds(), res, image.ZP, draw.Src)
 
 	return img
 }
 
+// Return the approximate number of bytes used to process a frame of the
+// passed size, using the passed number of bytes per pixel.
+func frameSize(b image.Rectangle, bytesPerPixel int) int64 {
+	return int64(b.Dx()) * int64(b.Dy()) * int64(bytesPerPixel)
+}
+
 // Calculate the reduction factor from a desired maximum size.
 func calcFactor(img image.Image, maxSize int) float64 {
 	w := img.Bounds().Dx()
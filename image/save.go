@@ -1,38 +1,144 @@
 package image
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/mitchellh/go-homedir"
 	"github.com/nomad-software/meme/cli"
 	"github.com/nomad-software/meme/image/stream"
 	"github.com/nomad-software/meme/output"
 )
 
-// Save the passed image to disk.
+const (
+	defaultNameTemplate = "{template}-{date}-{hash}.{ext}"
+)
+
+// Save the passed image to disk, or to stdout if the output name is '-'.
 func Save(opt cli.Options, st stream.Stream) string {
-	var name string
+	if isStdout(opt.OutName) {
+		_, err := io.Copy(os.Stdout, st.Reader())
+		output.OnError(err, "Could not write image to stdout")
+		return opt.OutName
+	}
+
+	if opt.OutName == "" && opt.OutDir == "" && opt.NameTemplate == "" {
+		return saveTemp(st)
+	}
 
-	if opt.OutName != "" {
-		name = opt.OutName
-	} else {
-		name = tempName(st.FileExt())
+	name := outputName(opt, st)
+
+	dir := filepath.Dir(name)
+	err := os.MkdirAll(dir, 0755)
+	output.OnError(err, "Could not create output directory")
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if opt.Force {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
 	}
 
-	file, err := os.Create(name)
+	file, err := os.OpenFile(name, flags, 0644)
+	if os.IsExist(err) {
+		output.Error(fmt.Sprintf("The output file already exists, use -force to overwrite it: %s", name))
+	}
+	output.OnError(err, "Could not create image file")
+	defer file.Close()
+
+	_, err = file.Write(st.Bytes())
+	output.OnError(err, "Could not save image stream to file")
+
+	return name
+}
+
+// Return true if the passed name is '-' meaning we should write the image to
+// stdout.
+func isStdout(name string) bool {
+	return name == "-"
+}
+
+// Save the image to a uniquely named file in the temporary directory.
+func saveTemp(st stream.Stream) string {
+	file, err := os.CreateTemp(os.TempDir(), fmt.Sprintf("meme-*.%s", st.FileExt()))
 	output.OnError(err, "Could not create image file")
 	defer file.Close()
 
-	_, err = io.Copy(file, &st)
+	_, err = file.Write(st.Bytes())
 	output.OnError(err, "Could not save image stream to file")
 
+	return file.Name()
+}
+
+// Generate the output file name from the options. The extension of the image
+// is added if the name doesn't have one.
+func outputName(opt cli.Options, st stream.Stream) string {
+	name := opt.OutName
+	if name == "" {
+		tmpl := opt.NameTemplate
+		if tmpl == "" {
+			tmpl = defaultNameTemplate
+		}
+		name = expandTemplate(tmpl, opt, st)
+	}
+
+	name, err := homedir.Expand(name)
+	output.OnError(err, "Could not expand path")
+
+	if opt.OutDir != "" && !filepath.IsAbs(name) {
+		dir, err := homedir.Expand(opt.OutDir)
+		output.OnError(err, "Could not expand path")
+		name = filepath.Join(dir, name)
+	}
+
+	if filepath.Ext(name) == "" {
+		name += "." + st.FileExt()
+	}
+
 	return name
 }
 
-// Generate a temporary file name.
-func tempName(ext string) string {
-	dir := os.TempDir()
-	return filepath.Join(dir, fmt.Sprintf("meme.%s", ext))
+// Expand the variables in a file name template.
+func expandTemplate(tmpl string, opt cli.Options, st stream.Stream) string {
+	now := time.Now()
+	sum := sha256.Sum256(st.Bytes())
+
+	r := strings.NewReplacer(
+		"{template}", sourceName(opt),
+		"{date}", now.Format("2006-01-02"),
+		"{time}", now.Format("150405"),
+		"{hash}", hex.EncodeToString(sum[:4]),
+		"{ext}", st.FileExt(),
+	)
+
+	return r.Replace(tmpl)
+}
+
+// Return a short name describing the source image, such as the template id or
+// the name of the file without its extension.
+func sourceName(opt cli.Options) string {
+	source := opt.Image
+	if opt.Animate && len(opt.Images) > 0 {
+		source = opt.Images[0]
+	}
+
+	if isStdin(source) {
+		return "stdin"
+	}
+
+	if u, err := url.Parse(source); err == nil && strings.HasPrefix(u.Scheme, "http") {
+		source = u.Path
+	}
+
+	name := strings.TrimSuffix(filepath.Base(source), filepath.Ext(source))
+	if name == "" || name == "." || name == "/" {
+		return "meme"
+	}
+
+	return name
 }
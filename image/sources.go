@@ -0,0 +1,165 @@
+package image
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"io"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/nomad-software/meme/cli"
+	"github.com/nomad-software/meme/clipboard"
+	"github.com/nomad-software/meme/output"
+)
+
+const (
+	clipboardSource = "clipboard"
+)
+
+var (
+	metaPattern      = regexp.MustCompile(`(?is)<meta\s[^>]*>`)
+	attributePattern = regexp.MustCompile(`(?s)([a-zA-Z:-]+)\s*=\s*("[^"]*"|'[^']*'|[^\s"'>]+)`)
+
+	// The meta tags naming the preview image of a page, in order of
+	// preference.
+	pageImageTags = []string{
+		"og:image:secure_url",
+		"og:image",
+		"og:image:url",
+		"twitter:image",
+		"twitter:image:src",
+	}
+)
+
+// Return true if the passed string is a data URI, false if not.
+func isDataURI(s string) bool {
+	return len(s) > 5 && strings.EqualFold(s[:5], "data:")
+}
+
+// Decode the image contained in a data URI, e.g. 'data:image/png;base64,...'.
+func decodeDataURI(opt cli.Options, uri string) io.Reader {
+	comma := strings.IndexByte(uri, ',')
+	if comma < 0 {
+		output.Error("Invalid data URI, the data must follow a comma")
+	}
+
+	params, data := uri[5:comma], uri[comma+1:]
+	typ := mediaType(strings.Split(params, ";")[0])
+	if !isMedia(typ) {
+		output.Error(fmt.Sprintf("The data URI is not an image (%s)", typ))
+	}
+
+	var b []byte
+	if strings.HasSuffix(strings.ToLower(params), ";base64") {
+		data = strings.Map(func(r rune) rune {
+			if strings.ContainsRune(" \t\r\n", r) {
+				return -1
+			}
+			return r
+		}, data)
+
+		var err error
+		b, err = base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			b, err = base64.RawStdEncoding.DecodeString(data)
+		}
+		output.OnError(err, "Could not decode data URI")
+	} else {
+		s, err := url.PathUnescape(data)
+		output.OnError(err, "Could not decode data URI")
+		b = []byte(s)
+	}
+
+	if int64(len(b)) > int64(opt.MaxDownload)<<20 {
+		output.Error(fmt.Sprintf("The data URI is larger than %d MB", opt.MaxDownload))
+	}
+
+	return bytes.NewReader(b)
+}
+
+// Return true if the passed string is a file URL, false if not.
+func isFileURL(s string) bool {
+	return len(s) > 7 && strings.EqualFold(s[:7], "file://")
+}
+
+// Return the local path of a file URL.
+func filePath(fileURL string) string {
+	u, err := url.Parse(fileURL)
+	output.OnError(err, "Invalid file URL")
+
+	if u.Host != "" && u.Host != "localhost" {
+		output.Error(fmt.Sprintf("File URLs must be on this computer, not %s", u.Host))
+	}
+
+	path := u.Path
+	if runtime.GOOS == "windows" {
+		// file:///C:/Users/... has a leading slash before the drive letter.
+		path = filepath.FromSlash(strings.TrimPrefix(path, "/"))
+	}
+	return path
+}
+
+// Return true if the passed string refers to the system clipboard.
+func isClipboard(s string) bool {
+	return s == clipboardSource
+}
+
+// Read the image copied to the system clipboard. If a link was copied
+// instead, the image it links to is loaded.
+func readClipboard(opt cli.Options) io.Reader {
+	if b, ok := clipboard.ReadImage(); ok {
+		return bytes.NewReader(b)
+	}
+
+	text := strings.TrimSpace(clipboard.ReadText())
+	if isURL(text) || isDataURI(text) || isFileURL(text) {
+		return open(opt, text)
+	}
+
+	output.Error("The clipboard doesn't contain an image or a link to one")
+	return nil
+}
+
+// Return true if the media type is a web page.
+func isPage(typ string) bool {
+	return typ == "text/html" || typ == "application/xhtml+xml"
+}
+
+// Find the preview image of a web page, which is shown when the page is
+// shared, e.g. in a tweet or article. Relative URLs are resolved against the
+// page's URL.
+func pageImage(page []byte, base *url.URL) (string, bool) {
+	images := make(map[string]string)
+
+	for _, tag := range metaPattern.FindAll(page, -1) {
+		attrs := make(map[string]string)
+		for _, m := range attributePattern.FindAllSubmatch(tag, -1) {
+			value := strings.Trim(string(m[2]), `"'`)
+			attrs[strings.ToLower(string(m[1]))] = html.UnescapeString(value)
+		}
+
+		name := attrs["property"]
+		if name == "" {
+			name = attrs["name"]
+		}
+		name = strings.ToLower(name)
+
+		if _, ok := images[name]; !ok && attrs["content"] != "" {
+			images[name] = strings.TrimSpace(attrs["content"])
+		}
+	}
+
+	for _, tag := range pageImageTags {
+		if src, ok := images[tag]; ok {
+			if u, err := base.Parse(src); err == nil {
+				return u.String(), true
+			}
+		}
+	}
+	return "", false
+}
@@ -2,36 +2,111 @@ package stream
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
 	"image"
+	"image/draw"
 	"image/gif"
 	"image/png"
 	"io"
-	"io/ioutil"
+	"sync"
 
 	"github.com/nomad-software/meme/output"
 )
 
-// Stream contains information about a loaded image.
+// ErrEncode is the cause of failures to encode an image.
+var ErrEncode = errors.New("Could not encode image")
+
+// Stream contains a loaded image. It holds the encoded bytes, the decoded
+// image or both, converting between them only when needed. This lets the
+// stages of rendering pass images to each other without encoding and decoding
+// them each time. Copies of a stream share the same image, so decoding returns
+// a copy that can be changed freely. Streams are safe to use from many
+// goroutines.
 type Stream struct {
-	io.Reader
-	bytes []byte
-	index int
-	typ   string
+	*state
+}
+
+// state is the image shared by copies of a stream.
+type state struct {
+	mutex  sync.Mutex
+	bytes  []byte
+	typ    string
+	img    image.Image
+	gif    *gif.GIF
+	frames int
+}
+
+// NewStream creates a new stream by reading an encoded image.
+func NewStream(r io.Reader) Stream {
+	b, err := io.ReadAll(r)
+	output.OnError(err, "Could not read image bytes")
+	return FromBytes(b)
+}
+
+// FromBytes creates a new stream from an encoded image. The bytes aren't
+// copied, so they must not be changed afterwards.
+func FromBytes(b []byte) Stream {
+	_, typ, err := image.DecodeConfig(bytes.NewReader(b))
+	output.OnError(err, "Could not decode image config")
+
+	frames := 1
+	if typ == "gif" {
+		frames = countFrames(b)
+	}
+
+	return Stream{&state{bytes: b, typ: typ, frames: frames}}
+}
+
+// FromImage creates a new stream from a still image, which is encoded as a
+// png when its bytes are needed. The image must not be changed afterwards.
+func FromImage(img image.Image) Stream {
+	return Stream{&state{img: img, typ: "png", frames: 1}}
+}
+
+// FromGif creates a new stream from a gif, which is encoded when its bytes
+// are needed. The gif must not be changed afterwards.
+func FromGif(g *gif.GIF) Stream {
+	// Fill in what the encoder would, so the gif is the same as if it had
+	// been encoded and decoded again.
+	if g.Config.Width == 0 && g.Config.Height == 0 && len(g.Image) > 0 {
+		size := g.Image[0].Bounds().Max
+		g.Config.Width, g.Config.Height = size.X, size.Y
+	}
+	for len(g.Delay) < len(g.Image) {
+		g.Delay = append(g.Delay, 0)
+	}
+	for len(g.Disposal) > 0 && len(g.Disposal) < len(g.Image) {
+		g.Disposal = append(g.Disposal, 0)
+	}
+
+	return Stream{&state{gif: g, typ: "gif", frames: len(g.Image)}}
 }
 
-// Bytes returns the stream's bytes.
+// Bytes returns the stream's encoded bytes, which must not be changed.
 func (st *Stream) Bytes() []byte {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	if st.bytes == nil {
+		var buf bytes.Buffer
+		if st.gif != nil {
+			err := gif.EncodeAll(&buf, st.gif)
+			OnEncodeError(err, "Could not encode gif")
+		} else {
+			err := png.Encode(&buf, st.img)
+			OnEncodeError(err, "Could not encode image")
+		}
+		st.bytes = buf.Bytes()
+	}
+
 	return st.bytes
 }
 
-// Read implements the io.Reader interface for the Stream.
-func (st *Stream) Read(b []byte) (n int, err error) {
-	if st.index >= len(st.bytes) {
-		return 0, io.EOF
-	}
-	n = copy(b, st.bytes[st.index:])
-	st.index += n
-	return
+// Reader returns a reader of the stream's encoded bytes. Each reader starts
+// at the beginning, so a stream can be read any number of times.
+func (st *Stream) Reader() io.Reader {
+	return bytes.NewReader(st.Bytes())
 }
 
 // IsGif returns true if the loaded image is a gif.
@@ -63,50 +138,175 @@ func (st *Stream) FileExt() string {
 	panic("File extension not recognised")
 }
 
-// NewStream creates a new stream.
-func NewStream(stream io.Reader) Stream {
-	a, err := ioutil.ReadAll(stream)
-	output.OnError(err, "Could not read image bytes")
-
-	b := make([]byte, len(a))
-	copy(b, a)
+// ContentType returns the mime type of the image.
+func (st *Stream) ContentType() string {
+	return "image/" + st.typ
+}
 
-	_, typ, err := image.DecodeConfig(bytes.NewReader(a))
-	output.OnError(err, "Could not decode image config")
+// Dimensions returns the width and height of the image.
+func (st *Stream) Dimensions() (int, int) {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
 
-	return Stream{
-		bytes: b,
-		typ:   typ,
+	if st.gif != nil {
+		return st.gif.Config.Width, st.gif.Config.Height
 	}
+	if st.img != nil {
+		b := st.img.Bounds()
+		return b.Dx(), b.Dy()
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(st.bytes))
+	output.OnError(err, "Could not decode image config")
+	return cfg.Width, cfg.Height
 }
 
-// EncodeImage encodes an image into a stream.
-func EncodeImage(img image.Image) Stream {
-	var buffer bytes.Buffer
-	png.Encode(&buffer, img)
-	return NewStream(&buffer)
+// Frames returns the number of frames in the image. The frames of a gif are
+// counted when the stream is created, without decoding them.
+func (st *Stream) Frames() int {
+	return st.frames
 }
 
-// DecodeImage decodes the byte stream and returns an image.
+// DecodeImage returns a copy of the image. Gifs return their first frame.
 func (st *Stream) DecodeImage() image.Image {
-	img, _, err := image.Decode(st)
-	output.OnError(err, "Could not decode image")
-	return img
-}
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
 
-// EncodeGif encodes a gif into a stream.
-func EncodeGif(img *gif.GIF) Stream {
-	var buffer bytes.Buffer
-	gif.EncodeAll(&buffer, img)
-	return NewStream(&buffer)
+	if st.img == nil {
+		if st.gif != nil {
+			st.img = st.gif.Image[0]
+		} else {
+			img, _, err := image.Decode(bytes.NewReader(st.bytes))
+			output.OnError(err, "Could not decode image")
+			st.img = img
+		}
+	}
+
+	return cloneImage(st.img)
 }
 
-// DecodeGif decodes the byte stream and returns a gif.
+// DecodeGif returns a copy of the gif.
 func (st *Stream) DecodeGif() *gif.GIF {
 	if !st.IsGif() {
 		output.Error("Can't decode stream to gif")
 	}
-	gif, err := gif.DecodeAll(st)
-	output.OnError(err, "Could not decode gif")
-	return gif
+
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+
+	return cloneGif(st.decodeGif())
+}
+
+// Return the decoded gif, decoding it if needed. The mutex must be held.
+func (st *Stream) decodeGif() *gif.GIF {
+	if st.gif == nil {
+		g, err := gif.DecodeAll(bytes.NewReader(st.bytes))
+		output.OnError(err, "Could not decode gif")
+		st.gif = g
+	}
+	return st.gif
+}
+
+// Count the frames of a gif without decoding them by skipping over the blocks
+// of the file. Every frame fits within the size of the gif.
+func countFrames(b []byte) int {
+	if len(b) < 13 {
+		return 0
+	}
+
+	// Skip the header, screen descriptor and global colour table.
+	i := 13
+	if b[10]&0x80 != 0 {
+		i += 3 << (b[10]&0x07 + 1)
+	}
+
+	frames := 0
+	for i < len(b) {
+		switch b[i] {
+		case 0x21: // Extension
+			i = skipSubBlocks(b, i+2)
+
+		case 0x2C: // Image descriptor
+			frames++
+			if i+10 >= len(b) {
+				return frames
+			}
+			flags := b[i+9]
+			i += 10
+			if flags&0x80 != 0 {
+				i += 3 << (flags&0x07 + 1)
+			}
+			i = skipSubBlocks(b, i+1) // After the LZW minimum code size.
+
+		default: // Trailer
+			return frames
+		}
+	}
+
+	return frames
+}
+
+// Skip the data sub blocks starting at the passed index, returning the index
+// after the block terminator.
+func skipSubBlocks(b []byte, i int) int {
+	for i < len(b) && b[i] != 0 {
+		i += int(b[i]) + 1
+	}
+	return i + 1
+}
+
+// Copy a gif, including its frames.
+func cloneGif(src *gif.GIF) *gif.GIF {
+	dst := *src
+	dst.Image = make([]*image.Paletted, len(src.Image))
+	for x, frame := range src.Image {
+		dst.Image[x] = cloneImage(frame).(*image.Paletted)
+	}
+	dst.Delay = append([]int(nil), src.Delay...)
+	if src.Disposal != nil {
+		dst.Disposal = append([]byte(nil), src.Disposal...)
+	}
+	return &dst
+}
+
+// Copy an image. Common image types are copied as they are, anything else is
+// converted to RGBA.
+func cloneImage(img image.Image) image.Image {
+	switch src := img.(type) {
+	case *image.Paletted:
+		dst := *src
+		dst.Pix = append([]uint8(nil), src.Pix...)
+		dst.Palette = append(src.Palette[:0:0], src.Palette...)
+		return &dst
+	case *image.YCbCr:
+		dst := *src
+		dst.Y = append([]uint8(nil), src.Y...)
+		dst.Cb = append([]uint8(nil), src.Cb...)
+		dst.Cr = append([]uint8(nil), src.Cr...)
+		return &dst
+	case *image.RGBA:
+		dst := *src
+		dst.Pix = append([]uint8(nil), src.Pix...)
+		return &dst
+	case *image.NRGBA:
+		dst := *src
+		dst.Pix = append([]uint8(nil), src.Pix...)
+		return &dst
+	case *image.Gray:
+		dst := *src
+		dst.Pix = append([]uint8(nil), src.Pix...)
+		return &dst
+	}
+
+	dst := image.NewRGBA(img.Bounds())
+	draw.Draw(dst, dst.Bounds(), img, img.Bounds().Min, draw.Src)
+	return dst
+}
+
+// OnEncodeError raises an error if an image couldn't be encoded, with
+// ErrEncode as its cause.
+func OnEncodeError(err error, text string) {
+	if err != nil {
+		output.Fail(fmt.Errorf("%w: %w", ErrEncode, err), fmt.Sprintf("%s: %s", text, err))
+	}
 }
@@ -0,0 +1,49 @@
+package stream
+
+import (
+	"bytes"
+	"image"
+	"image/color/palette"
+	"image/gif"
+	"testing"
+)
+
+// Return a gif with the passed number of frames.
+func newGif(frames int) *gif.GIF {
+	g := &gif.GIF{}
+	for range frames {
+		g.Image = append(g.Image, image.NewPaletted(image.Rect(0, 0, 4, 4), palette.Plan9))
+		g.Delay = append(g.Delay, 10)
+	}
+	return g
+}
+
+func TestFrames(t *testing.T) {
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, newGif(3)); err != nil {
+		t.Fatal(err)
+	}
+
+	// Loaded gifs are counted without decoding them.
+	st := FromBytes(buf.Bytes())
+	if got := st.Frames(); got != 3 {
+		t.Errorf("a loaded gif has %d frames", got)
+	}
+	if st.gif != nil {
+		t.Errorf("the loaded gif was decoded")
+	}
+
+	// Rendered gifs are counted without encoding them.
+	st = FromGif(newGif(5))
+	if got := st.Frames(); got != 5 {
+		t.Errorf("a rendered gif has %d frames", got)
+	}
+	if st.bytes != nil {
+		t.Errorf("the rendered gif was encoded")
+	}
+
+	st = FromImage(image.NewRGBA(image.Rect(0, 0, 4, 4)))
+	if got := st.Frames(); got != 1 {
+		t.Errorf("an image has %d frames", got)
+	}
+}
@@ -0,0 +1,410 @@
+package image
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/fogleman/gg"
+	"github.com/nomad-software/meme/cli"
+	"github.com/nomad-software/meme/image/stream"
+	"github.com/nomad-software/meme/output"
+)
+
+// Transform applies the geometric transformations to the source image before
+// any text is drawn. Animated sources have every frame transformed the same.
+func transform(opt cli.Options, st stream.Stream) stream.Stream {
+	if hasTransforms(opt) {
+		checkTransform(opt, st)
+	}
+
+	if st.IsGif() && isAnimated(opt, st) {
+		if !hasTransforms(opt) {
+			return st
+		}
+		return transformGif(opt, st)
+	}
+
+	orientation := 1
+	if st.IsJpg() {
+		orientation = exifOrientation(st.Bytes())
+	}
+
+	if !hasTransforms(opt) && orientation == 1 {
+		return st
+	}
+
+	img := st.DecodeImage()
+	img = orientImage(img, orientation)
+	img = transformFrame(opt, img)
+
+	return stream.FromImage(img)
+}
+
+// Return true if any source transformations have been requested.
+func hasTransforms(opt cli.Options) bool {
+	return opt.Crop != "" || opt.Flip != "" || opt.Rotate != 0 || opt.Pad > 0 || opt.Round > 0
+}
+
+// Transform each frame of a gif.
+// Frames are coalesced first so partial frames are transformed consistently.
+func transformGif(opt cli.Options, st stream.Stream) stream.Stream {
+	src := st.DecodeGif()
+	frames := coalesceGif(src)
+
+	for x, frame := range frames {
+		img := transformFrame(opt, frame)
+		src.Image[x] = palettedFrame(img, src.Image[x].Palette)
+	}
+
+	bounds := src.Image[0].Bounds()
+	src.Config = image.Config{Width: bounds.Dx(), Height: bounds.Dy()}
+	src.Disposal = nil
+
+	return stream.FromGif(src)
+}
+
+// Apply the requested transformations in order to a single frame.
+func transformFrame(opt cli.Options, img image.Image) image.Image {
+	if opt.Crop != "" {
+		img = cropImage(img, cropRect(opt.Crop, img.Bounds()))
+	}
+
+	switch opt.Flip {
+	case "h":
+		img = flipHorizontal(img)
+	case "v":
+		img = flipVertical(img)
+	case "hv", "vh":
+		img = rotate180(img)
+	}
+
+	if opt.Rotate != 0 {
+		img = rotateImage(img, opt.Rotate, parseColor(opt.PadColor))
+	}
+
+	if opt.Pad > 0 {
+		img = padImage(img, opt.Pad, parseColor(opt.PadColor))
+	}
+
+	if opt.Round > 0 {
+		img = roundCorners(img, opt.Round)
+	}
+
+	return img
+}
+
+// Composite each gif frame over the previous ones so every frame is a full
+// image the size of the gif. After each frame is shown, its disposal method
+// decides what the next frame is drawn over: the frame is left in place,
+// cleared to transparent or replaced by what was there before it.
+func coalesceGif(src *gif.GIF) []*image.RGBA {
+	bounds := image.Rect(0, 0, src.Config.Width, src.Config.Height)
+	if bounds.Empty() {
+		bounds = src.Image[0].Bounds()
+	}
+
+	base := image.NewRGBA(bounds)
+	frames := make([]*image.RGBA, len(src.Image))
+	var previous []uint8
+
+	for x, frame := range src.Image {
+		var disposal byte
+		if x < len(src.Disposal) {
+			disposal = src.Disposal[x]
+		}
+
+		if disposal == gif.DisposalPrevious {
+			previous = append(previous[:0], base.Pix...)
+		}
+
+		draw.Draw(base, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+
+		img := image.NewRGBA(bounds)
+		copy(img.Pix, base.Pix)
+		frames[x] = img
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(base, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			copy(base.Pix, previous)
+		}
+	}
+
+	return frames
+}
+
+// Convert an image to a paletted frame using the passed palette.
+// A transparent colour is added to the palette if the image needs one.
+func palettedFrame(img image.Image, p color.Palette) *image.Paletted {
+	if hasTransparency(img) && !hasTransparentColor(p) {
+		p = append(color.Palette{}, p...)
+		if len(p) < 256 {
+			p = append(p, color.Transparent)
+		} else {
+			p[len(p)-1] = color.Transparent
+		}
+	}
+
+	b := img.Bounds()
+	frame := image.NewPaletted(image.Rect(0, 0, b.Dx(), b.Dy()), p)
+	draw.FloydSteinberg.Draw(frame, frame.Bounds(), img, b.Min)
+
+	return frame
+}
+
+// Return true if any pixel in the image is not fully opaque.
+func hasTransparency(img image.Image) bool {
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if _, _, _, a := img.At(x, y).RGBA(); a != 0xffff {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Return true if the palette contains a fully transparent colour.
+func hasTransparentColor(p color.Palette) bool {
+	for _, c := range p {
+		if _, _, _, a := c.RGBA(); a == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse the crop specification into a rectangle within the passed bounds.
+// The specification is either 'x,y,w,h' in pixels or an aspect ratio 'w:h'
+// which is cropped from the centre of the image.
+func cropRect(spec string, b image.Rectangle) image.Rectangle {
+	if strings.Contains(spec, ":") {
+		parts := strings.Split(spec, ":")
+		if len(parts) != 2 {
+			output.Error(fmt.Sprintf("Invalid crop aspect ratio: %s", spec))
+		}
+
+		aw, err1 := strconv.ParseFloat(parts[0], 64)
+		ah, err2 := strconv.ParseFloat(parts[1], 64)
+		if err1 != nil || err2 != nil || aw <= 0 || ah <= 0 {
+			output.Error(fmt.Sprintf("Invalid crop aspect ratio: %s", spec))
+		}
+
+		w := b.Dx()
+		h := int(math.Round(float64(w) * ah / aw))
+		if h > b.Dy() {
+			h = b.Dy()
+			w = int(math.Round(float64(h) * aw / ah))
+		}
+
+		x := b.Min.X + (b.Dx()-w)/2
+		y := b.Min.Y + (b.Dy()-h)/2
+
+		return image.Rect(x, y, x+w, y+h)
+	}
+
+	parts := strings.Split(spec, ",")
+	if len(parts) != 4 {
+		output.Error(fmt.Sprintf("Invalid crop rectangle: %s", spec))
+	}
+
+	var v [4]int
+	for x, part := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		output.OnError(err, "Invalid crop rectangle")
+		v[x] = n
+	}
+
+	rect := image.Rect(v[0], v[1], v[0]+v[2], v[1]+v[3]).Add(b.Min).Intersect(b)
+	if rect.Empty() {
+		output.Error(fmt.Sprintf("Crop rectangle is outside of the image: %s", spec))
+	}
+
+	return rect
+}
+
+// Crop an image to the passed rectangle.
+func cropImage(img image.Image, rect image.Rectangle) image.Image {
+	dst := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	draw.Draw(dst, dst.Bounds(), img, rect.Min, draw.Src)
+	return dst
+}
+
+// Correct the orientation of an image using its exif orientation value.
+func orientImage(img image.Image, orientation int) image.Image {
+	switch orientation {
+	case 2:
+		return flipHorizontal(img)
+	case 3:
+		return rotate180(img)
+	case 4:
+		return flipVertical(img)
+	case 5:
+		return transpose(img)
+	case 6:
+		return rotate90(img)
+	case 7:
+		return transverse(img)
+	case 8:
+		return rotate270(img)
+	}
+	return img
+}
+
+// Remap the pixels of an image into a new image of the passed size.
+// The passed function returns the source coordinate for each destination
+// coordinate, both relative to the origin.
+func remap(img image.Image, w int, h int, fn func(x, y int) (int, int)) image.Image {
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			sx, sy := fn(x, y)
+			dst.Set(x, y, img.At(b.Min.X+sx, b.Min.Y+sy))
+		}
+	}
+
+	return dst
+}
+
+// Mirror an image horizontally.
+func flipHorizontal(img image.Image) image.Image {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	return remap(img, w, h, func(x, y int) (int, int) { return w - 1 - x, y })
+}
+
+// Mirror an image vertically.
+func flipVertical(img image.Image) image.Image {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	return remap(img, w, h, func(x, y int) (int, int) { return x, h - 1 - y })
+}
+
+// Rotate an image 90 degrees clockwise.
+func rotate90(img image.Image) image.Image {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	return remap(img, h, w, func(x, y int) (int, int) { return y, h - 1 - x })
+}
+
+// Rotate an image 180 degrees.
+func rotate180(img image.Image) image.Image {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	return remap(img, w, h, func(x, y int) (int, int) { return w - 1 - x, h - 1 - y })
+}
+
+// Rotate an image 270 degrees clockwise.
+func rotate270(img image.Image) image.Image {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	return remap(img, h, w, func(x, y int) (int, int) { return w - 1 - y, x })
+}
+
+// Mirror an image along its top-left to bottom-right diagonal.
+func transpose(img image.Image) image.Image {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	return remap(img, h, w, func(x, y int) (int, int) { return y, x })
+}
+
+// Mirror an image along its top-right to bottom-left diagonal.
+func transverse(img image.Image) image.Image {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	return remap(img, h, w, func(x, y int) (int, int) { return w - 1 - y, h - 1 - x })
+}
+
+// Rotate an image clockwise by the passed degrees.
+// Right angles are rotated exactly, any other angle enlarges the image to fit
+// and fills the exposed corners with the background colour.
+func rotateImage(img image.Image, degrees float64, bg color.Color) image.Image {
+	degrees = math.Mod(degrees, 360)
+	if degrees < 0 {
+		degrees += 360
+	}
+
+	switch degrees {
+	case 0:
+		return img
+	case 90:
+		return rotate90(img)
+	case 180:
+		return rotate180(img)
+	case 270:
+		return rotate270(img)
+	}
+
+	rad := gg.Radians(degrees)
+	w := float64(img.Bounds().Dx())
+	h := float64(img.Bounds().Dy())
+	rw := math.Abs(w*math.Cos(rad)) + math.Abs(h*math.Sin(rad))
+	rh := math.Abs(w*math.Sin(rad)) + math.Abs(h*math.Cos(rad))
+
+	ctx := gg.NewContext(int(math.Ceil(rw)), int(math.Ceil(rh)))
+	ctx.SetColor(bg)
+	ctx.Clear()
+
+	cx := float64(ctx.Width()) / 2
+	cy := float64(ctx.Height()) / 2
+	ctx.RotateAbout(rad, cx, cy)
+	ctx.DrawImageAnchored(img, int(cx), int(cy), 0.5, 0.5)
+
+	return ctx.Image()
+}
+
+// Pad an image on all sides with the background colour.
+func padImage(img image.Image, pad int, bg color.Color) image.Image {
+	b := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx()+(pad*2), b.Dy()+(pad*2)))
+
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(bg), image.Point{}, draw.Src)
+	draw.Draw(dst, image.Rect(pad, pad, pad+b.Dx(), pad+b.Dy()), img, b.Min, draw.Over)
+
+	return dst
+}
+
+// Round the corners of an image leaving them transparent. The radius is at
+// most half the size of the image.
+func roundCorners(img image.Image, radius int) image.Image {
+	b := img.Bounds()
+	radius = min(radius, b.Dx()/2, b.Dy()/2)
+	ctx := gg.NewContext(b.Dx(), b.Dy())
+
+	ctx.DrawRoundedRectangle(0, 0, float64(b.Dx()), float64(b.Dy()), float64(radius))
+	ctx.Clip()
+	ctx.DrawImage(img, -b.Min.X, -b.Min.Y)
+
+	return ctx.Image()
+}
+
+// Parse a hex colour such as '#FFF', '#FF0000' or '#FF000080'.
+// An empty string is parsed as transparent.
+func parseColor(hex string) color.Color {
+	if hex == "" || hex == "transparent" {
+		return color.Transparent
+	}
+
+	s := strings.TrimPrefix(hex, "#")
+	if len(s) == 3 {
+		s = string([]byte{s[0], s[0], s[1], s[1], s[2], s[2]})
+	}
+	if len(s) == 6 {
+		s += "ff"
+	}
+
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil || len(s) != 8 {
+		output.Error(fmt.Sprintf("Invalid colour: %s", hex))
+	}
+
+	return color.NRGBA{
+		R: uint8(v >> 24),
+		G: uint8(v >> 16),
+		B: uint8(v >> 8),
+		A: uint8(v),
+	}
+}
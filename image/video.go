@@ -0,0 +1,142 @@
+package image
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/nomad-software/meme/cli"
+	"github.com/nomad-software/meme/image/stream"
+	"github.com/nomad-software/meme/output"
+)
+
+const (
+	videoDuration = 3.0 // Seconds to extract when no duration is passed.
+	videoFPS      = 15  // Frames per second of the extracted animation.
+)
+
+var (
+	// The ffmpeg format used to read each kind of video clip. Clips are only
+	// read as these formats and only from local files, so a clip can't make
+	// ffmpeg read other files or URLs, as playlists and concat lists can.
+	videoFormats = map[string]string{
+		".avi":  "avi",
+		".m4v":  "mov",
+		".mkv":  "matroska",
+		".mov":  "mov",
+		".mp4":  "mov",
+		".webm": "matroska",
+	}
+)
+
+// Load frames from a video clip using ffmpeg. Either a single still frame is
+// extracted or a range of frames is converted into a gif animation.
+func loadVideo(opt cli.Options) stream.Stream {
+	ffmpeg, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		output.Error("ffmpeg is required to read video clips, see https://ffmpeg.org")
+	}
+
+	var input string
+	if isURL(opt.Image) {
+		input = downloadVideo(opt)
+		defer os.Remove(input)
+	} else {
+		input, err = homedir.Expand(opt.Image)
+		output.OnError(err, "Could not expand path")
+	}
+
+	format, ok := videoFormats[strings.ToLower(filepath.Ext(input))]
+	if !ok {
+		output.Error(fmt.Sprintf("Unsupported video clip: %s", opt.Image))
+	}
+
+	// Input options come before the input and output options after it.
+	var seek, encode []string
+	if opt.Still {
+		seek = []string{"-ss", formatSeconds(opt.Frame)}
+		encode = []string{
+			"-frames:v", "1",
+			"-f", "image2pipe",
+			"-vcodec", "png",
+		}
+	} else {
+		duration := opt.Duration
+		if duration <= 0 {
+			duration = videoDuration
+		}
+
+		size := strconv.Itoa(opt.MaxSize)
+		filter := fmt.Sprintf(
+			"fps=%d,scale='min(%s,iw)':'min(%s,ih)':force_original_aspect_ratio=decrease:flags=lanczos,split[a][b];[a]palettegen[p];[b][p]paletteuse",
+			videoFPS, size, size,
+		)
+
+		seek = []string{"-ss", formatSeconds(opt.Start), "-t", formatSeconds(duration)}
+		encode = []string{
+			"-vf", filter,
+			"-f", "gif",
+		}
+	}
+
+	args := []string{"-v", "error", "-nostdin"}
+	args = append(args, seek...)
+	args = append(args, "-protocol_whitelist", "file", "-f", format, "-i", "file:"+input)
+	args = append(args, encode...)
+	args = append(args, "-")
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(renderContext(opt), ffmpeg, args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		checkContext(opt)
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = errors.New(msg)
+		}
+		output.OnError(err, "Could not extract frames from video")
+	}
+
+	if stdout.Len() == 0 {
+		output.Error("No frames could be extracted from the video, check the start time")
+	}
+
+	return stream.FromBytes(stdout.Bytes())
+}
+
+// Format seconds as an ffmpeg time argument.
+func formatSeconds(s float64) string {
+	return strconv.FormatFloat(s, 'f', -1, 64)
+}
+
+// Download a video clip to a temporary file and return its name. Videos are
+// downloaded the same way as images rather than by ffmpeg, so the same limits
+// apply.
+func downloadVideo(opt cli.Options) string {
+	b := fetch(opt, opt.Image)
+
+	ext := ".mp4"
+	if u, err := url.Parse(opt.Image); err == nil && filepath.Ext(u.Path) != "" {
+		ext = filepath.Ext(u.Path)
+	}
+
+	f, err := os.CreateTemp("", "meme-*"+ext)
+	output.OnError(err, "Could not create temporary file")
+	defer f.Close()
+
+	_, err = f.Write(b)
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	output.OnError(err, "Could not write temporary file")
+
+	return f.Name()
+}
@@ -0,0 +1,92 @@
+package image
+
+import (
+	"github.com/nomad-software/meme/cli"
+)
+
+// framePool processes the frames of an animation using a limited number of
+// goroutines. Frames are started by the goroutine rendering the meme, which
+// waits while every worker is busy, so large gifs don't process all of their
+// frames at once. Progress is reported and failures are raised in the
+// rendering goroutine.
+type framePool struct {
+	opt     cli.Options
+	stage   string
+	total   int
+	done    int
+	workers int
+	running int
+	results chan interface{}
+}
+
+// Create a pool to process the frames of a stage of rendering. The frame size
+// is the approximate number of bytes used while processing one frame, which
+// limits the number of workers to fit the memory budget.
+func newFramePool(opt cli.Options, stage string, total int, frameSize int64) *framePool {
+	workers := opt.Workers
+	if frameSize > 0 {
+		if limit := (int64(opt.FrameMemory) << 20) / frameSize; limit < int64(workers) {
+			workers = int(limit)
+		}
+	}
+	if workers < 1 {
+		workers = 1
+	}
+
+	return &framePool{
+		opt:     opt,
+		stage:   stage,
+		total:   total,
+		workers: workers,
+		results: make(chan interface{}, workers),
+	}
+}
+
+// Go processes a frame on a worker, waiting for one to be free first.
+func (p *framePool) Go(fn func()) {
+	for p.running >= p.workers {
+		p.receive()
+	}
+
+	p.running++
+	go func() {
+		defer func() {
+			// Errors are sent to the rendering goroutine and raised again,
+			// otherwise they would crash the program instead of being
+			// caught there. Frames left running after rendering stops still
+			// send their errors, which are ignored.
+			p.results <- recover()
+		}()
+		fn()
+	}()
+}
+
+// Skip counts a frame that doesn't need processing as done.
+func (p *framePool) Skip() {
+	p.done++
+	report(p.opt, p.stage, p.done, p.total)
+}
+
+// Wait waits for all of the frames to be processed.
+func (p *framePool) Wait() {
+	for p.running > 0 {
+		p.receive()
+	}
+}
+
+// Receive the result of a processed frame, stopping if the context is done.
+// Frames still being processed when rendering stops are left to finish.
+func (p *framePool) receive() {
+	select {
+	case r := <-p.results:
+		p.running--
+		if r != nil {
+			panic(r)
+		}
+	case <-renderContext(p.opt).Done():
+		checkContext(p.opt)
+	}
+
+	p.done++
+	report(p.opt, p.stage, p.done, p.total)
+}
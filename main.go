@@ -5,37 +5,148 @@ import (
 	_ "image/gif"
 	_ "image/jpeg"
 	_ "image/png"
+	"os"
 
 	"github.com/fatih/color"
+	"github.com/nomad-software/meme/batch"
+	"github.com/nomad-software/meme/cache"
 	"github.com/nomad-software/meme/cli"
+	"github.com/nomad-software/meme/clipboard"
+	"github.com/nomad-software/meme/editor"
 	"github.com/nomad-software/meme/font"
 	"github.com/nomad-software/meme/image"
 	"github.com/nomad-software/meme/output"
+	"github.com/nomad-software/meme/preview"
+	"github.com/nomad-software/meme/server"
+	"github.com/nomad-software/meme/upload"
 )
 
+// summary describes the generated meme when printing json.
+type summary struct {
+	File       string `json:"file,omitempty"`
+	URL        string `json:"url,omitempty"`
+	DeleteHash string `json:"deletehash,omitempty"`
+	Width      int    `json:"width"`
+	Height     int    `json:"height"`
+	Frames     int    `json:"frames"`
+	Bytes      int    `json:"bytes"`
+	Format     string `json:"format"`
+}
+
 func main() {
+	output.Exit(run)
+}
+
+// Run the command passed on the command line.
+func run() {
 	opt := cli.ParseOptions()
 
 	if opt.Help {
 		opt.PrintUsage()
 
-	} else if opt.ListTemplates {
-		for _, id := range cli.ImageIds {
-			fmt.Fprintln(output.Stdout, color.CyanString("%s", id))
+	} else if opt.Valid() {
+		cache.Configure(int64(opt.CacheSize)<<20, opt.CacheDir, int64(opt.CacheDiskSize)<<20, opt.CacheTTL)
+
+		switch opt.Command {
+		case "templates":
+			for _, id := range cli.ImageIds {
+				fmt.Fprintln(output.Stdout, color.CyanString("%s", id))
+			}
+
+		case "fonts":
+			for _, name := range font.List() {
+				fmt.Fprintln(output.Stdout, color.CyanString("%s", name))
+			}
+
+		case "completion":
+			cli.WriteCompletion(output.Stdout, opt.Args[0], upload.Providers)
+
+		case "man":
+			cli.WriteManPage(output.Stdout, upload.Providers)
+
+		case "edit":
+			editor.Run(opt)
+
+		case "batch":
+			batch.Run(opt)
+
+		case "serve":
+			server.Serve(opt)
+
+		case "web":
+			server.Web(opt)
+
+		case "bot":
+			server.Bot(opt)
+
+		case "delete":
+			for _, ref := range opt.Args {
+				upload.Delete(opt, ref)
+				output.Info("Deleted %s", ref)
+			}
+
+		default:
+			render(opt)
 		}
+	}
+}
 
-	} else if opt.Valid() {
-		font.SetPath(opt)
+// Render the meme, then save, upload and copy it as requested.
+func render(opt cli.Options) {
+	st := image.Generate(opt)
+
+	var file string
+	var res upload.Result
 
-		st := image.Load(opt)
-		st = image.RenderImage(opt, st)
+	if opt.Upload == "" || opt.Keep || opt.OutName != "" {
+		file = image.Save(opt, st)
+	}
+
+	if opt.Upload != "" {
+		res = upload.New(opt).Upload(st)
+		upload.Record(opt, res)
+	}
 
-		if opt.ClientID != "" {
-			url := image.Upload(opt, st)
-			output.Info(url)
+	if opt.Copy {
+		if res.URL != "" {
+			clipboard.WriteText(res.URL)
 		} else {
-			file := image.Save(opt, st)
+			clipboard.WriteImage(st.Bytes(), st.ContentType(), st.FileExt())
+		}
+	}
+
+	if opt.JSON {
+		w, h := st.Dimensions()
+		output.JSON(summary{
+			File:       file,
+			URL:        res.URL,
+			DeleteHash: res.DeleteHash,
+			Width:      w,
+			Height:     h,
+			Frames:     st.Frames(),
+			Bytes:      len(st.Bytes()),
+			Format:     st.FileExt(),
+		})
+	} else {
+		if file != "" && file != "-" {
 			output.Info(file)
 		}
+		if res.URL != "" {
+			output.Info(res.URL)
+		}
+		if res.DeleteHash != "" {
+			output.Info("Delete hash: %s", res.DeleteHash)
+		}
+		if opt.Copy {
+			output.Info("Copied to the clipboard")
+		}
+	}
+
+	if opt.Preview {
+		terminal := os.Stdout
+		if opt.OutName == "-" {
+			terminal = os.Stderr
+		}
+		preview.Show(st, opt.PreviewMode, terminal)
 	}
 }
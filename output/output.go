@@ -1,6 +1,7 @@
 package output
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 
@@ -14,23 +15,101 @@ var (
 
 	// Stderr is a color friendly pipe.
 	Stderr = colorable.NewColorableStderr()
+
+	// The pipe used for information, which is moved to stderr when stdout is
+	// used for data.
+	info = Stdout
 )
 
+// Failure is an error raised by Error, OnError or Fail. Errors are raised by
+// panicking with a failure, which is recovered by Catch or Exit further up the
+// same goroutine. Every goroutine that can raise errors must run inside one of
+// them, otherwise a failure crashes the program.
+type Failure struct {
+	Message string
+	Err     error // The cause, if there is one.
+}
+
+// Error implements the error interface.
+func (f *Failure) Error() string {
+	return f.Message
+}
+
+// Unwrap returns the cause of the failure.
+func (f *Failure) Unwrap() error {
+	return f.Err
+}
+
+// Catch runs the passed function, returning any error it raises instead of
+// exiting the program. This allows long running commands to report errors for
+// a single unit of work and carry on. Only errors raised by the goroutine
+// running the function are caught.
+func Catch(fn func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if f, ok := r.(*Failure); ok {
+				err = f
+				return
+			}
+			panic(r)
+		}
+	}()
+
+	fn()
+	return nil
+}
+
+// Exit runs the passed function, printing any error it raises and exiting the
+// program. The main goroutine runs inside Exit.
+func Exit(fn func()) {
+	if err := Catch(fn); err != nil {
+		fmt.Fprintln(Stderr, color.RedString("%s", err))
+		os.Exit(1)
+	}
+}
+
+// Raise an error, which is returned by Catch or printed by Exit.
+func raise(text string, err error) {
+	panic(&Failure{Message: text, Err: err})
+}
+
 // OnError prints an error if err is not nil and exits the program.
 func OnError(err error, text string) {
 	if err != nil {
-		fmt.Fprintln(Stderr, color.RedString(text+": %s", err.Error()))
-		os.Exit(1)
+		raise(fmt.Sprintf("%s: %s", text, err.Error()), err)
 	}
 }
 
 // Error prints an error and exits the program.
 func Error(text string) {
-	fmt.Fprintln(Stderr, color.RedString(text))
-	os.Exit(1)
+	raise(text, nil)
+}
+
+// Fail prints an error and exits the program, like Error. The cause isn't
+// printed but is kept by the Failure returned from Catch, so it can be checked
+// using errors.Is.
+func Fail(err error, text string) {
+	raise(text, err)
 }
 
 // Info prints information.
 func Info(format string, args ...interface{}) {
-	fmt.Fprintf(Stdout, color.GreenString(format)+"\n", args...)
+	fmt.Fprintf(info, color.GreenString(format)+"\n", args...)
+}
+
+// Warn prints a problem that doesn't stop the program.
+func Warn(format string, args ...interface{}) {
+	fmt.Fprintf(Stderr, color.RedString(format)+"\n", args...)
+}
+
+// InfoToStderr moves all information to stderr, leaving stdout free for data.
+func InfoToStderr() {
+	info = Stderr
+}
+
+// JSON prints a value as indented json.
+func JSON(v interface{}) {
+	b, err := json.MarshalIndent(v, "", "  ")
+	OnError(err, "Could not encode json")
+	fmt.Fprintln(info, string(b))
 }
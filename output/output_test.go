@@ -0,0 +1,49 @@
+package output
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestCatch(t *testing.T) {
+	cause := errors.New("cause")
+	err := Catch(func() {
+		Fail(cause, "Something failed")
+	})
+	if err == nil || err.Error() != "Something failed" || !errors.Is(err, cause) {
+		t.Errorf("got %v", err)
+	}
+
+	if err := Catch(func() {}); err != nil {
+		t.Errorf("got %v without an error", err)
+	}
+
+	// Goroutines catch their own errors, whatever the others are doing.
+	var wg sync.WaitGroup
+	errs := make([]error, 8)
+	for x := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[x] = Catch(func() {
+				if x%2 == 0 {
+					Error("Even")
+				}
+			})
+		}()
+	}
+	wg.Wait()
+	for x, err := range errs {
+		if (err != nil) != (x%2 == 0) {
+			t.Errorf("goroutine %d got %v", x, err)
+		}
+	}
+
+	defer func() {
+		if r := recover(); r != "boom" {
+			t.Errorf("other panics weren't passed on: %v", r)
+		}
+	}()
+	Catch(func() { panic("boom") })
+}
@@ -0,0 +1,59 @@
+package preview
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"os"
+)
+
+// Canvas draws images into areas of the terminal, such as the panes of an
+// interactive editor. The cursor is moved using absolute positions so it can
+// be used while the terminal is in raw mode.
+type Canvas struct {
+	protocol string
+	size     termSize
+	id       int
+}
+
+// NewCanvas returns a canvas for the terminal, drawing images using the passed
+// protocol or the best one the terminal supports when it's 'auto'.
+func NewCanvas(f *os.File, protocol string) *Canvas {
+	if protocol == "" || protocol == "auto" {
+		protocol = detect()
+	}
+
+	return &Canvas{
+		protocol: protocol,
+		size:     terminalSize(f),
+		id:       os.Getpid()%1000000 + 1,
+	}
+}
+
+// Resize reads the size of the terminal again after it has changed.
+func (c *Canvas) Resize(f *os.File) {
+	c.size = terminalSize(f)
+}
+
+// Size returns the number of columns and rows in the terminal.
+func (c *Canvas) Size() (int, int) {
+	return c.size.cols, c.size.rows
+}
+
+// Draw fits the image into the area at the passed column and row, counted from
+// one, and centres it horizontally.
+func (c *Canvas) Draw(w io.Writer, img image.Image, col int, row int, cols int, rows int) {
+	l := fit(img.Bounds(), cols, rows, c.size)
+	col += (cols - l.cols) / 2
+
+	fmt.Fprintf(w, "\x1b[%d;%dH", row, col)
+	drawFrame(w, c.protocol, img, l, c.id, fmt.Sprintf("\x1b[1B\x1b[%dG", col))
+}
+
+// Clear removes the drawn images. Only needed for protocols which don't remove
+// images along with the text beneath them.
+func (c *Canvas) Clear(w io.Writer) {
+	if c.protocol == "kitty" {
+		fmt.Fprint(w, "\x1b_Ga=d,q=2\x1b\\")
+	}
+}
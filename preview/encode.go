@@ -0,0 +1,175 @@
+package preview
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/png"
+	"io"
+	"strings"
+
+	"github.com/nomad-software/meme/output"
+)
+
+const (
+	kittyChunkSize = 4096 // The largest chunk of base64 data kitty accepts.
+	alphaThreshold = 128  // Pixels more transparent than this aren't drawn.
+)
+
+// Draw the image using the kitty graphics protocol. The terminal scales the
+// image to fit the cells. Sending an image with the same id replaces the last
+// one, so animation frames don't pile up.
+func kitty(w io.Writer, img image.Image, l layout, id int) {
+	data := base64.StdEncoding.EncodeToString(encodePNG(img))
+
+	for first := true; len(data) > 0; first = false {
+		chunk := data
+		if len(chunk) > kittyChunkSize {
+			chunk = chunk[:kittyChunkSize]
+		}
+		data = data[len(chunk):]
+
+		more := 0
+		if len(data) > 0 {
+			more = 1
+		}
+
+		if first {
+			fmt.Fprintf(w, "\x1b_Ga=T,f=100,q=2,C=1,i=%d,c=%d,r=%d,m=%d;%s\x1b\\", id, l.cols, l.rows, more, chunk)
+		} else {
+			fmt.Fprintf(w, "\x1b_Gm=%d;%s\x1b\\", more, chunk)
+		}
+	}
+}
+
+// Draw the image using the iTerm2 inline image protocol.
+func iterm(w io.Writer, img image.Image, l layout) {
+	data := encodePNG(img)
+	fmt.Fprintf(w, "\x1b]1337;File=inline=1;size=%d;width=%d;height=%d;preserveAspectRatio=1:%s\a",
+		len(data), l.cols, l.rows, base64.StdEncoding.EncodeToString(data))
+}
+
+// Draw the image using sixel graphics. The image is reduced to a palette of
+// 256 colours first. Transparent pixels are left undrawn.
+func sixel(w io.Writer, img image.Image) {
+	b := img.Bounds()
+	p := image.NewPaletted(image.Rect(0, 0, b.Dx(), b.Dy()), palette.Plan9)
+	draw.FloydSteinberg.Draw(p, p.Bounds(), img, b.Min)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "\x1bP0;1;0q\"1;1;%d;%d", b.Dx(), b.Dy())
+
+	for x, c := range p.Palette {
+		r, g, b, _ := c.RGBA()
+		fmt.Fprintf(&buf, "#%d;2;%d;%d;%d", x, r*100/0xffff, g*100/0xffff, b*100/0xffff)
+	}
+
+	width, height := p.Rect.Dx(), p.Rect.Dy()
+
+	for band := 0; band < height; band += 6 {
+		// The sixels of each colour used in the band.
+		rows := make(map[uint8][]byte)
+		var order []uint8
+
+		for y := band; y < band+6 && y < height; y++ {
+			for x := 0; x < width; x++ {
+				if !isOpaque(img.At(b.Min.X+x, b.Min.Y+y)) {
+					continue
+				}
+				index := p.ColorIndexAt(x, y)
+				if rows[index] == nil {
+					rows[index] = make([]byte, width)
+					order = append(order, index)
+				}
+				rows[index][x] |= 1 << (y - band)
+			}
+		}
+
+		for x, index := range order {
+			if x > 0 {
+				buf.WriteByte('$')
+			}
+			fmt.Fprintf(&buf, "#%d", index)
+			writeSixels(&buf, rows[index])
+		}
+		buf.WriteByte('-')
+	}
+
+	buf.WriteString("\x1b\\")
+	w.Write(buf.Bytes())
+}
+
+// Write a row of sixels, compressing repeated characters.
+func writeSixels(buf *bytes.Buffer, bits []byte) {
+	for x := 0; x < len(bits); {
+		n := 1
+		for x+n < len(bits) && bits[x+n] == bits[x] {
+			n++
+		}
+
+		c := bits[x] + '?'
+		if n > 3 {
+			fmt.Fprintf(buf, "!%d%c", n, c)
+		} else {
+			buf.WriteString(strings.Repeat(string(c), n))
+		}
+		x += n
+	}
+}
+
+// Draw the image using coloured half blocks. Each cell shows two pixels, the
+// top one in the foreground colour and the bottom one in the background. Rows
+// are separated using the passed string.
+func blocks(w io.Writer, img image.Image, newline string) {
+	b := img.Bounds()
+
+	var buf bytes.Buffer
+	for y := b.Min.Y; y < b.Max.Y; y += 2 {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			top := img.At(x, y)
+			bottom := color.Color(color.Transparent)
+			if y+1 < b.Max.Y {
+				bottom = img.At(x, y+1)
+			}
+
+			switch {
+			case isOpaque(top) && isOpaque(bottom):
+				fmt.Fprintf(&buf, "\x1b[38;2;%sm\x1b[48;2;%sm▀", rgb(top), rgb(bottom))
+			case isOpaque(top):
+				fmt.Fprintf(&buf, "\x1b[0m\x1b[38;2;%sm▀", rgb(top))
+			case isOpaque(bottom):
+				fmt.Fprintf(&buf, "\x1b[0m\x1b[38;2;%sm▄", rgb(bottom))
+			default:
+				buf.WriteString("\x1b[0m ")
+			}
+		}
+		buf.WriteString("\x1b[0m")
+		buf.WriteString(newline)
+	}
+
+	w.Write(buf.Bytes())
+}
+
+// Return true if a pixel is opaque enough to draw.
+func isOpaque(c color.Color) bool {
+	_, _, _, a := c.RGBA()
+	return a>>8 >= alphaThreshold
+}
+
+// Format a colour as an ANSI truecolor parameter.
+func rgb(c color.Color) string {
+	n := color.NRGBAModel.Convert(c).(color.NRGBA)
+	return fmt.Sprintf("%d;%d;%d", n.R, n.G, n.B)
+}
+
+// Encode an image as a png.
+func encodePNG(img image.Image) []byte {
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	output.OnError(err, "Could not encode preview")
+	return buf.Bytes()
+}
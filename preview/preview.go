@@ -0,0 +1,165 @@
+package preview
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-isatty"
+	"github.com/nfnt/resize"
+	memeimage "github.com/nomad-software/meme/image"
+	"github.com/nomad-software/meme/image/stream"
+	"github.com/nomad-software/meme/output"
+)
+
+const (
+	maxLoops     = 3  // The most times an animation is played.
+	defaultDelay = 10 // 100ths of a second, used for frames without a delay.
+	minDelay     = 2  // 100ths of a second, browsers slow down anything faster.
+	promptRows   = 2  // Rows left free for the prompt.
+)
+
+// layout is the size of the preview in terminal cells and pixels.
+type layout struct {
+	cols   int
+	rows   int
+	width  int // px
+	height int // px
+}
+
+// Show displays the image in the terminal using the passed protocol, or the
+// best one the terminal supports when it's 'auto'. Animations are played a few
+// times before leaving the last frame on screen.
+func Show(st stream.Stream, protocol string, w *os.File) {
+	if !isatty.IsTerminal(w.Fd()) && !isatty.IsCygwinTerminal(w.Fd()) {
+		output.Warn("Can't show a preview, the output is not a terminal")
+		return
+	}
+
+	if protocol == "" || protocol == "auto" {
+		protocol = detect()
+	}
+
+	frames, delays, loops := memeimage.Frames(st)
+	size := terminalSize(w)
+	l := fit(frames[0].Bounds(), size.cols, max(size.rows-promptRows, 1), size)
+
+	b := bufio.NewWriter(w)
+	defer b.Flush()
+
+	// Reserve the rows, then move back up so every frame is drawn in the same
+	// place without scrolling.
+	fmt.Fprint(b, strings.Repeat("\n", l.rows))
+	fmt.Fprintf(b, "\x1b[%dA\x1b7", l.rows)
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt)
+	defer signal.Stop(stop)
+
+	plays := 1
+	if len(frames) > 1 {
+		plays = playCount(loops)
+	}
+
+	id := os.Getpid()%1000000 + 1
+
+play:
+	for p := 0; p < plays; p++ {
+		for x, frame := range frames {
+			fmt.Fprint(b, "\x1b8")
+			drawFrame(b, protocol, frame, l, id, "\n")
+			b.Flush()
+
+			if len(frames) == 1 {
+				break
+			}
+
+			select {
+			case <-stop:
+				break play
+			case <-time.After(FrameDelay(delays[x])):
+			}
+		}
+	}
+
+	fmt.Fprintf(b, "\x1b8\x1b[%dB\x1b[0m\n", l.rows)
+}
+
+// Draw a frame at the cursor. Rows of blocks are separated using the passed
+// string.
+func drawFrame(w io.Writer, protocol string, frame image.Image, l layout, id int, newline string) {
+	switch protocol {
+	case "kitty":
+		kitty(w, frame, l, id)
+	case "iterm":
+		iterm(w, frame, l)
+	case "sixel":
+		sixel(w, resize.Resize(uint(l.width), uint(l.height), frame, resize.Bilinear))
+	default:
+		blocks(w, resize.Resize(uint(l.cols), uint(l.rows*2), frame, resize.Bilinear), newline)
+	}
+}
+
+// Detect the graphics protocol supported by the terminal.
+func detect() string {
+	term := os.Getenv("TERM")
+	program := os.Getenv("TERM_PROGRAM")
+
+	switch {
+	case os.Getenv("KITTY_WINDOW_ID") != "" || strings.Contains(term, "kitty") || strings.Contains(term, "ghostty"):
+		return "kitty"
+	case program == "iTerm.app" || program == "WezTerm" || os.Getenv("LC_TERMINAL") == "iTerm2":
+		return "iterm"
+	case strings.Contains(term, "sixel") || term == "foot" || strings.HasPrefix(term, "mlterm") || program == "mintty":
+		return "sixel"
+	default:
+		return "blocks"
+	}
+}
+
+// Fit the image into an area of the terminal, keeping its aspect ratio. Images
+// are never made larger than they are.
+func fit(b image.Rectangle, cols int, rows int, size termSize) layout {
+	w, h := float64(b.Dx()), float64(b.Dy())
+	cellW, cellH := size.cellWidth(), size.cellHeight()
+
+	maxW := float64(cols) * cellW
+	maxH := float64(rows) * cellH
+
+	scale := math.Min(1, math.Min(maxW/w, maxH/h))
+	width := math.Max(1, math.Round(w*scale))
+	height := math.Max(1, math.Round(h*scale))
+
+	return layout{
+		cols:   int(math.Ceil(width / cellW)),
+		rows:   int(math.Ceil(height / cellH)),
+		width:  int(width),
+		height: int(height),
+	}
+}
+
+// Return the number of times to play an animation from its gif loop count.
+func playCount(loops int) int {
+	switch {
+	case loops == 0:
+		return maxLoops
+	case loops < 0:
+		return 1
+	default:
+		return min(loops+1, maxLoops)
+	}
+}
+
+// FrameDelay returns how long an animation frame is shown for.
+func FrameDelay(delay int) time.Duration {
+	if delay < minDelay {
+		delay = defaultDelay
+	}
+	return time.Duration(delay) * 10 * time.Millisecond
+}
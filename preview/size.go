@@ -0,0 +1,51 @@
+package preview
+
+import (
+	"os"
+	"strconv"
+)
+
+const (
+	defaultCols       = 80
+	defaultRows       = 24
+	defaultCellWidth  = 8  // px
+	defaultCellHeight = 16 // px
+)
+
+// termSize is the size of the terminal in cells and, if known, pixels.
+type termSize struct {
+	cols   int
+	rows   int
+	width  int // px
+	height int // px
+}
+
+// Return the width of a cell in pixels.
+func (s termSize) cellWidth() float64 {
+	if s.width == 0 {
+		return defaultCellWidth
+	}
+	return float64(s.width) / float64(s.cols)
+}
+
+// Return the height of a cell in pixels.
+func (s termSize) cellHeight() float64 {
+	if s.height == 0 {
+		return defaultCellHeight
+	}
+	return float64(s.height) / float64(s.rows)
+}
+
+// Return the size of the terminal from the environment, or a typical size.
+func defaultSize() termSize {
+	size := termSize{cols: defaultCols, rows: defaultRows}
+
+	if n, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && n > 0 {
+		size.cols = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("LINES")); err == nil && n > 0 {
+		size.rows = n
+	}
+
+	return size
+}
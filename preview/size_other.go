@@ -0,0 +1,12 @@
+//go:build !unix
+
+package preview
+
+import (
+	"os"
+)
+
+// Return the size of the terminal.
+func terminalSize(f *os.File) termSize {
+	return defaultSize()
+}
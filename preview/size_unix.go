@@ -0,0 +1,24 @@
+//go:build unix
+
+package preview
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// Return the size of the terminal.
+func terminalSize(f *os.File) termSize {
+	ws, err := unix.IoctlGetWinsize(int(f.Fd()), unix.TIOCGWINSZ)
+	if err != nil || ws.Col == 0 || ws.Row == 0 {
+		return defaultSize()
+	}
+
+	return termSize{
+		cols:   int(ws.Col),
+		rows:   int(ws.Row),
+		width:  int(ws.Xpixel),
+		height: int(ws.Ypixel),
+	}
+}
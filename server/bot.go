@@ -0,0 +1,624 @@
+package server
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/nomad-software/meme/cli"
+	"github.com/nomad-software/meme/image/stream"
+	"github.com/nomad-software/meme/output"
+	"github.com/nomad-software/meme/upload"
+)
+
+const (
+	maxRequestAge = 5 * time.Minute  // The oldest signed Slack request accepted.
+	maxHosted     = 100              // The number of images the bot hosts itself.
+	maxAltText    = 250              // characters
+	replyTimeout  = 30 * time.Second // The time allowed to post a reply.
+)
+
+var (
+	// Providers that post messages can't be used to host the images of the
+	// bot, which posts the messages itself.
+	postingProviders = []string{"discord", "mattermost", "slack"}
+
+	replyClient = &http.Client{Timeout: replyTimeout}
+)
+
+// bot answers slash commands from Slack and Mattermost. Discord is answered
+// separately as its interactions work differently.
+type bot struct {
+	base   cli.Options
+	hosted *hosted
+	queue  *renderQueue
+}
+
+// chat is where the reply to a slash command is sent.
+type chat struct {
+	mattermost  bool
+	responseURL string
+	user        string // The user who ran the command, as a mention.
+}
+
+// button is the meme attached to the buttons of a preview.
+type button struct {
+	Action      string `json:"action,omitempty"`
+	Image       string `json:"image"`
+	Alt         string `json:"alt"`
+	ResponseURL string `json:"response_url,omitempty"`
+	User        string `json:"user,omitempty"`
+	Signature   string `json:"signature,omitempty"`
+}
+
+// slackAction is the payload sent by Slack when a button is pressed.
+type slackAction struct {
+	User struct {
+		ID string `json:"id"`
+	} `json:"user"`
+	ResponseURL string `json:"response_url"`
+	Actions     []struct {
+		ActionID string `json:"action_id"`
+		Value    string `json:"value"`
+	} `json:"actions"`
+}
+
+// mattermostAction is the payload sent by Mattermost when a button is pressed.
+type mattermostAction struct {
+	Context button `json:"context"`
+}
+
+// Bot serves the slash command and blocks until it fails. Memes are rendered
+// in the background and shown privately with buttons to post or cancel them.
+// The options passed to the bot command are used as defaults for every meme,
+// including the upload provider used to host the images.
+//
+//	POST /command       A slash command, e.g. '/meme doge such wow|very meme'.
+//	POST /actions       A button pressed on a preview.
+//	GET  /images/{name} An image hosted by the bot itself.
+//	POST /discord       A Discord interaction.
+func Bot(opt cli.Options) {
+	// The upload provider is only known once the options are fully parsed.
+	job := cli.ParseJob(opt.BaseArgs, nil)
+	opt.Upload = job.Upload
+
+	// Discord memes are attached to the reply, Slack and Mattermost memes are
+	// linked so they must be hosted somewhere.
+	linked := opt.SigningSecret != "" || opt.MattermostToken != ""
+	if linked && opt.Upload == "" && opt.PublicURL == "" {
+		output.Error("The bot needs a public URL (-public-url) to host images itself, or an upload provider (-upload)")
+	}
+	if opt.Upload != "" {
+		for _, name := range postingProviders {
+			if opt.Upload == name {
+				output.Error(fmt.Sprintf("The %s provider posts messages, so it can't host the images of the bot", name))
+			}
+		}
+		// Fail now rather than on the first meme if the provider is missing
+		// any of its options.
+		upload.New(job)
+	}
+
+	b := &bot{
+		base:   opt,
+		hosted: &hosted{baseURL: strings.TrimSuffix(opt.PublicURL, "/") + "/images/"},
+		queue:  newRenderQueue(runtime.NumCPU()),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/command", b.command)
+	mux.HandleFunc("/actions", b.action)
+	mux.Handle("/images/", b.hosted)
+
+	if opt.DiscordPublicKey != "" {
+		d := newDiscord(opt, b.queue)
+		if opt.DiscordToken != "" {
+			d.register()
+			output.Info("Registered the Discord commands")
+		}
+		mux.Handle("/discord", d)
+	}
+
+	// Memes are rendered in the background, so responses are written
+	// straight away.
+	srv := newServer(opt.Addr, mux, writeTimeout)
+
+	output.Info("Listening on http://%s", opt.Addr)
+	err := srv.ListenAndServe()
+	output.OnError(err, "Could not start the server")
+}
+
+// Answer a slash command. Rendering can take longer than the few seconds
+// allowed for a response, so the reply is sent to the response URL later.
+func (b *bot) command(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, form, err := readForm(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Slack checks the certificate of the server using an unsigned request.
+	if form.Get("ssl_check") == "1" {
+		return
+	}
+
+	c := chat{responseURL: form.Get("response_url")}
+	if r.Header.Get("X-Slack-Signature") != "" {
+		err = verifySlack(b.base.SigningSecret, r.Header, body)
+		c.user = "<@" + form.Get("user_id") + ">"
+	} else {
+		err = verifyMattermost(b.base.MattermostToken, form.Get("token"))
+		c.mattermost = true
+		c.user = "@" + form.Get("user_name")
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	text := strings.TrimSpace(form.Get("text"))
+	switch text {
+	case "", "help":
+		writeJSON(w, http.StatusOK, c.text(usage(form.Get("command"))))
+		return
+	case "templates":
+		writeJSON(w, http.StatusOK, c.text("`"+strings.Join(cli.ImageIds, "`, `")+"`"))
+		return
+	}
+
+	values, err := commandFields(text)
+	if err != nil {
+		writeJSON(w, http.StatusOK, c.text(err.Error()))
+		return
+	}
+	if c.responseURL == "" {
+		http.Error(w, "A response URL is required", http.StatusBadRequest)
+		return
+	}
+
+	if !b.queue.add() {
+		writeJSON(w, http.StatusOK, c.text(busyMessage))
+		return
+	}
+
+	go b.reply(c, values)
+	writeJSON(w, http.StatusOK, c.text("Rendering..."))
+}
+
+// Render the meme of a slash command and reply with a preview. Mattermost
+// buttons need the public URL of the bot, so without one the meme is posted
+// straight away.
+func (b *bot) reply(c chat, values map[string][]string) {
+	image, alt, err := b.render(values)
+
+	var msg interface{}
+	if err != nil {
+		msg = c.text(err.Error())
+	} else if c.mattermost && b.base.PublicURL == "" {
+		msg = c.post(image, alt)
+	} else {
+		msg = b.preview(c, image, alt)
+	}
+
+	if err := send(c.responseURL, msg); err != nil {
+		output.Warn("Could not reply to a slash command: %s", err)
+	}
+}
+
+// Render a meme and host it, returning its URL and a description of it. The
+// meme must have been added to the queue.
+func (b *bot) render(values map[string][]string) (image string, alt string, err error) {
+	opt, st, err := b.queue.generate(b.base, values)
+	if err != nil {
+		return "", "", err
+	}
+
+	var res upload.Result
+	err = output.Catch(func() {
+		if opt.Upload == "" {
+			res = b.hosted.Upload(st)
+			return
+		}
+		res = upload.New(opt).Upload(st)
+		upload.Record(opt, res)
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	alt = strings.TrimSpace(opt.Top + " " + opt.Bottom)
+	if alt == "" {
+		alt = opt.Image
+	}
+	if r := []rune(alt); len(r) > maxAltText {
+		alt = string(r[:maxAltText])
+	}
+
+	return res.URL, alt, nil
+}
+
+// Answer a button pressed on a preview.
+func (b *bot) action(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if r.Header.Get("X-Slack-Signature") != "" {
+		b.slackAction(w, r)
+	} else {
+		b.mattermostAction(w, r)
+	}
+}
+
+// Answer a Slack button. The preview is only visible to the user who ran the
+// command, so posting sends a new message to the channel and deletes it.
+func (b *bot) slackAction(w http.ResponseWriter, r *http.Request) {
+	body, form, err := readForm(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := verifySlack(b.base.SigningSecret, r.Header, body); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var payload slackAction
+	if err := json.Unmarshal([]byte(form.Get("payload")), &payload); err != nil || len(payload.Actions) == 0 {
+		http.Error(w, "Invalid action payload", http.StatusBadRequest)
+		return
+	}
+
+	var meme button
+	if err := json.Unmarshal([]byte(payload.Actions[0].Value), &meme); err != nil {
+		http.Error(w, "Invalid action value", http.StatusBadRequest)
+		return
+	}
+
+	c := chat{responseURL: payload.ResponseURL, user: "<@" + payload.User.ID + ">"}
+	action := payload.Actions[0].ActionID
+
+	go func() {
+		var err error
+		if action == "post" {
+			err = send(c.responseURL, c.post(meme.Image, meme.Alt))
+		}
+		if err == nil {
+			err = send(c.responseURL, map[string]interface{}{"delete_original": true})
+		}
+		if err != nil {
+			output.Warn("Could not answer a button: %s", err)
+		}
+	}()
+}
+
+// Answer a Mattermost button. Mattermost doesn't sign these requests, so the
+// buttons carry a signature made using the token of the slash command.
+func (b *bot) mattermostAction(w http.ResponseWriter, r *http.Request) {
+	var payload mattermostAction
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(&payload)
+	if err != nil {
+		http.Error(w, "Invalid action payload", http.StatusBadRequest)
+		return
+	}
+
+	meme := payload.Context
+	if b.base.MattermostToken == "" || !hmac.Equal([]byte(meme.Signature), []byte(b.sign(meme))) {
+		http.Error(w, "Invalid action signature", http.StatusUnauthorized)
+		return
+	}
+
+	message := "Cancelled"
+	if meme.Action == "post" {
+		c := chat{mattermost: true, responseURL: meme.ResponseURL, user: meme.User}
+		if err := send(c.responseURL, c.post(meme.Image, meme.Alt)); err != nil {
+			writeJSON(w, http.StatusOK, map[string]string{"ephemeral_text": "Could not post the meme: " + err.Error()})
+			return
+		}
+		message = "Posted"
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"update": map[string]interface{}{"message": message, "props": map[string]interface{}{}},
+	})
+}
+
+// Return a message only shown to the user who ran the command.
+func (c chat) text(text string) map[string]interface{} {
+	return map[string]interface{}{"response_type": "ephemeral", "text": text}
+}
+
+// Return a message posting the meme to the channel.
+func (c chat) post(image string, alt string) map[string]interface{} {
+	by := "Posted by " + c.user
+
+	if c.mattermost {
+		return map[string]interface{}{
+			"response_type": "in_channel",
+			"attachments": []map[string]string{
+				{"fallback": image, "image_url": image, "footer": by},
+			},
+		}
+	}
+
+	return map[string]interface{}{
+		"response_type":    "in_channel",
+		"replace_original": false,
+		"text":             image,
+		"blocks": []interface{}{
+			map[string]string{"type": "image", "image_url": image, "alt_text": alt},
+			map[string]interface{}{
+				"type":     "context",
+				"elements": []map[string]string{{"type": "mrkdwn", "text": by}},
+			},
+		},
+	}
+}
+
+// Return a message showing the meme privately with buttons to post or cancel
+// it.
+func (b *bot) preview(c chat, image string, alt string) map[string]interface{} {
+	if c.mattermost {
+		var actions []map[string]interface{}
+		for _, action := range []string{"Post", "Cancel"} {
+			meme := button{Action: strings.ToLower(action), Image: image, Alt: alt, ResponseURL: c.responseURL, User: c.user}
+			meme.Signature = b.sign(meme)
+			actions = append(actions, map[string]interface{}{
+				"id":   meme.Action,
+				"name": action,
+				"integration": map[string]interface{}{
+					"url":     strings.TrimSuffix(b.base.PublicURL, "/") + "/actions",
+					"context": meme,
+				},
+			})
+		}
+
+		return map[string]interface{}{
+			"response_type": "ephemeral",
+			"attachments": []map[string]interface{}{
+				{"fallback": image, "image_url": image, "actions": actions},
+			},
+		}
+	}
+
+	value, _ := json.Marshal(button{Image: image, Alt: alt})
+
+	buttons := []map[string]interface{}{
+		{
+			"type":      "button",
+			"action_id": "post",
+			"style":     "primary",
+			"text":      map[string]string{"type": "plain_text", "text": "Post"},
+			"value":     string(value),
+		},
+		{
+			"type":      "button",
+			"action_id": "cancel",
+			"text":      map[string]string{"type": "plain_text", "text": "Cancel"},
+			"value":     string(value),
+		},
+	}
+
+	return map[string]interface{}{
+		"response_type": "ephemeral",
+		"text":          image,
+		"blocks": []interface{}{
+			map[string]string{"type": "image", "image_url": image, "alt_text": alt},
+			map[string]interface{}{"type": "actions", "elements": buttons},
+		},
+	}
+}
+
+// Sign the meme of a Mattermost button using the token of the slash command.
+func (b *bot) sign(meme button) string {
+	mac := hmac.New(sha256.New, []byte(b.base.MattermostToken))
+	for _, field := range []string{meme.Action, meme.Image, meme.Alt, meme.ResponseURL, meme.User} {
+		mac.Write([]byte(field))
+		mac.Write([]byte{0})
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify the signature of a request from Slack.
+func verifySlack(secret string, header http.Header, body []byte) error {
+	if secret == "" {
+		return errors.New("Slack requests aren't enabled, pass -signing-secret to the bot command")
+	}
+
+	timestamp := header.Get("X-Slack-Request-Timestamp")
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("Invalid request timestamp")
+	}
+
+	age := time.Since(time.Unix(seconds, 0))
+	if age > maxRequestAge || age < -maxRequestAge {
+		return errors.New("The request has expired")
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%s:", timestamp)
+	mac.Write(body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+
+	if !hmac.Equal([]byte(expected), []byte(header.Get("X-Slack-Signature"))) {
+		return errors.New("Invalid request signature")
+	}
+	return nil
+}
+
+// Verify the token of a request from Mattermost.
+func verifyMattermost(expected string, token string) error {
+	if expected == "" {
+		return errors.New("Mattermost requests aren't enabled, pass -mattermost-token to the bot command")
+	}
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(token)) != 1 {
+		return errors.New("Invalid request token")
+	}
+	return nil
+}
+
+// Read a form request, returning the body too as it's needed to verify the
+// signature.
+func readForm(r *http.Request) ([]byte, url.Values, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, maxBodySize))
+	if err != nil {
+		return nil, nil, fmt.Errorf("Could not read request: %s", err)
+	}
+
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, nil, fmt.Errorf("Could not parse form: %s", err)
+	}
+	return body, form, nil
+}
+
+// Post a message to the response URL of a command or button.
+func send(responseURL string, msg interface{}) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	resp, err := replyClient.Post(responseURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s from the response URL", resp.Status)
+	}
+	return nil
+}
+
+// Parse the text of a slash command into render fields. Options come first,
+// e.g. '-shake' or '-color=#f00', followed by the image and the meme text.
+func commandFields(text string) (map[string][]string, error) {
+	values := make(map[string][]string)
+	rest := unescapeChat(text)
+
+	for strings.HasPrefix(rest, "-") {
+		var word string
+		word, rest = cutWord(rest)
+
+		name, value, ok := strings.Cut(word[1:], "=")
+		if !ok {
+			value = "true"
+		}
+		values[name] = append(values[name], value)
+	}
+
+	image, rest := cutWord(rest)
+	if image == "" {
+		return nil, errors.New("An image is required, e.g. 'doge such wow|very meme'")
+	}
+
+	// Slack formats links as '<https://example.com|example.com>'.
+	if strings.HasPrefix(image, "<") && strings.HasSuffix(image, ">") {
+		image, _, _ = strings.Cut(image[1:len(image)-1], "|")
+	}
+
+	values["i"] = []string{image}
+	if rest != "" {
+		values["t"] = []string{rest}
+	}
+	return values, nil
+}
+
+// Split the first word from the text.
+func cutWord(text string) (string, string) {
+	text = strings.TrimSpace(text)
+	if n := strings.IndexFunc(text, unicode.IsSpace); n >= 0 {
+		return text[:n], strings.TrimSpace(text[n:])
+	}
+	return text, ""
+}
+
+// Undo the escaping of the characters Slack uses for formatting.
+func unescapeChat(text string) string {
+	return strings.NewReplacer("&lt;", "<", "&gt;", ">", "&amp;", "&").Replace(text)
+}
+
+// Describe how to use the slash command.
+func usage(command string) string {
+	if command == "" {
+		command = "/meme"
+	}
+	return fmt.Sprintf("Usage: `%[1]s [options] image text`\n"+
+		"The image is a template or URL and `|` separates the top and bottom text, e.g. `%[1]s brace-yourselves brace yourselves|deploys are coming`\n"+
+		"Options come first, e.g. `%[1]s -shake -color=#ff0 doge such wow`\n"+
+		"`%[1]s templates` lists the templates.", command)
+}
+
+// hosted holds the memes hosted by the bot itself. Only the newest are kept,
+// as chat services fetch the image soon after it's posted.
+type hosted struct {
+	baseURL string
+
+	mu    sync.Mutex
+	names []string
+	files map[string]stream.Stream
+}
+
+// Upload implements the upload.Uploader interface.
+func (h *hosted) Upload(st stream.Stream) upload.Result {
+	name := upload.ObjectName(st)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.files == nil {
+		h.files = make(map[string]stream.Stream)
+	}
+	if _, ok := h.files[name]; !ok {
+		h.names = append(h.names, name)
+	}
+	h.files[name] = st
+
+	if len(h.names) > maxHosted {
+		delete(h.files, h.names[0])
+		h.names = h.names[1:]
+	}
+
+	return upload.Result{URL: h.baseURL + name}
+}
+
+// ServeHTTP serves a hosted image.
+func (h *hosted) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/images/")
+
+	h.mu.Lock()
+	st, ok := h.files[name]
+	h.mu.Unlock()
+
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", st.ContentType())
+	w.Header().Set("Cache-Control", "max-age=86400")
+	w.Write(st.Bytes())
+}
@@ -0,0 +1,225 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nomad-software/meme/cli"
+)
+
+// Return the headers Slack sends with a request signed using the secret.
+func slackHeader(secret string, timestamp time.Time, body string) http.Header {
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "v0:%s:%s", ts, body)
+
+	header := make(http.Header)
+	header.Set("X-Slack-Request-Timestamp", ts)
+	header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+	return header
+}
+
+func TestVerifySlack(t *testing.T) {
+	body := "text=doge+wow"
+
+	tests := []struct {
+		name   string
+		secret string
+		header http.Header
+		ok     bool
+	}{
+		{"good signature", "secret", slackHeader("secret", time.Now(), body), true},
+		{"bad signature", "secret", slackHeader("other", time.Now(), body), false},
+		{"expired", "secret", slackHeader("secret", time.Now().Add(-10*time.Minute), body), false},
+		{"future", "secret", slackHeader("secret", time.Now().Add(10*time.Minute), body), false},
+		{"no timestamp", "secret", http.Header{"X-Slack-Signature": {"v0=abc"}}, false},
+		{"not enabled", "", slackHeader("", time.Now(), body), false},
+	}
+
+	for _, test := range tests {
+		err := verifySlack(test.secret, test.header, []byte(body))
+		if (err == nil) != test.ok {
+			t.Errorf("%s: got error %v", test.name, err)
+		}
+	}
+}
+
+func TestVerifyMattermost(t *testing.T) {
+	tests := []struct {
+		expected string
+		token    string
+		ok       bool
+	}{
+		{"token", "token", true},
+		{"token", "other", false},
+		{"token", "", false},
+		{"", "", false},
+	}
+
+	for _, test := range tests {
+		err := verifyMattermost(test.expected, test.token)
+		if (err == nil) != test.ok {
+			t.Errorf("verifyMattermost(%q, %q): got error %v", test.expected, test.token, err)
+		}
+	}
+}
+
+func TestSign(t *testing.T) {
+	b := &bot{base: cli.Options{MattermostToken: "token"}}
+	meme := button{Action: "post", Image: "https://example.com/a.png", Alt: "wow", ResponseURL: "https://example.com/hook", User: "@user"}
+	meme.Signature = b.sign(meme)
+
+	// The signature survives being sent as the context of a button.
+	data, err := json.Marshal(mattermostAction{Context: meme})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var payload mattermostAction
+	if err := json.Unmarshal(data, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if !hmac.Equal([]byte(payload.Context.Signature), []byte(b.sign(payload.Context))) {
+		t.Errorf("the signature doesn't match after a round trip")
+	}
+
+	changed := payload.Context
+	changed.Image = "https://example.com/b.png"
+	if b.sign(changed) == meme.Signature {
+		t.Errorf("changing the image didn't change the signature")
+	}
+
+	other := &bot{base: cli.Options{MattermostToken: "other"}}
+	if other.sign(meme) == meme.Signature {
+		t.Errorf("a different token made the same signature")
+	}
+}
+
+func TestCommandFields(t *testing.T) {
+	tests := []struct {
+		text   string
+		values map[string][]string
+		ok     bool
+	}{
+		{"doge such wow|very meme", map[string][]string{"i": {"doge"}, "t": {"such wow|very meme"}}, true},
+		{"doge", map[string][]string{"i": {"doge"}}, true},
+		{"-shake doge wow", map[string][]string{"shake": {"true"}, "i": {"doge"}, "t": {"wow"}}, true},
+		{"-color=#f00 -max-size=300 doge wow", map[string][]string{"color": {"#f00"}, "max-size": {"300"}, "i": {"doge"}, "t": {"wow"}}, true},
+		{"-box=10,10,50,20:hi -box=0,0,10,10:yo doge", map[string][]string{"box": {"10,10,50,20:hi", "0,0,10,10:yo"}, "i": {"doge"}}, true},
+		{"<https://example.com/a.png|example.com/a.png> wow", map[string][]string{"i": {"https://example.com/a.png"}, "t": {"wow"}}, true},
+		{"<https://example.com/a.png> wow", map[string][]string{"i": {"https://example.com/a.png"}, "t": {"wow"}}, true},
+		{"doge a &lt;b&gt; &amp; c", map[string][]string{"i": {"doge"}, "t": {"a <b> & c"}}, true},
+		{"  doge   spaced  out  ", map[string][]string{"i": {"doge"}, "t": {"spaced  out"}}, true},
+		{"-shake", nil, false},
+		{"", nil, false},
+	}
+
+	for _, test := range tests {
+		values, err := commandFields(test.text)
+		if (err == nil) != test.ok {
+			t.Errorf("commandFields(%q): got error %v", test.text, err)
+			continue
+		}
+		if test.ok && !reflect.DeepEqual(values, test.values) {
+			t.Errorf("commandFields(%q) = %v, want %v", test.text, values, test.values)
+		}
+	}
+}
+
+func TestCommandReply(t *testing.T) {
+	replies := make(chan map[string]interface{}, 1)
+	chat := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var msg map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+			t.Errorf("could not decode the reply: %s", err)
+		}
+		replies <- msg
+	}))
+	defer chat.Close()
+
+	b := &bot{
+		base:   cli.Options{SigningSecret: "secret", PublicURL: "https://bot.example.com"},
+		hosted: &hosted{baseURL: "https://bot.example.com/images/"},
+		queue:  newRenderQueue(1),
+	}
+
+	form := url.Values{
+		"command":      {"/meme"},
+		"text":         {"doge such wow|very meme"},
+		"user_id":      {"U123"},
+		"response_url": {chat.URL},
+	}.Encode()
+
+	req := httptest.NewRequest(http.MethodPost, "/command", strings.NewReader(form))
+	req.Header = slackHeader("secret", time.Now(), form)
+	res := httptest.NewRecorder()
+	b.command(res, req)
+
+	if res.Code != http.StatusOK || !strings.Contains(res.Body.String(), "Rendering...") {
+		t.Fatalf("the command wasn't acknowledged: %d %s", res.Code, res.Body)
+	}
+
+	var msg map[string]interface{}
+	select {
+	case msg = <-replies:
+	case <-time.After(time.Minute):
+		t.Fatal("no reply was sent to the response URL")
+	}
+
+	if msg["response_type"] != "ephemeral" {
+		t.Errorf("the preview isn't private: %v", msg)
+	}
+	image, _ := msg["text"].(string)
+	if !strings.HasPrefix(image, "https://bot.example.com/images/") {
+		t.Fatalf("the preview doesn't link to a hosted image: %v", msg)
+	}
+
+	// The linked image is served by the bot.
+	req = httptest.NewRequest(http.MethodGet, strings.TrimPrefix(image, "https://bot.example.com"), nil)
+	res = httptest.NewRecorder()
+	b.hosted.ServeHTTP(res, req)
+	if res.Code != http.StatusOK || !strings.HasPrefix(res.Header().Get("Content-Type"), "image/") {
+		t.Errorf("the hosted image wasn't served: %d %s", res.Code, res.Header().Get("Content-Type"))
+	}
+}
+
+func TestCommandRejected(t *testing.T) {
+	b := &bot{
+		base:   cli.Options{SigningSecret: "secret", PublicURL: "https://bot.example.com"},
+		hosted: &hosted{},
+		queue:  newRenderQueue(1),
+	}
+	form := url.Values{"text": {"doge wow"}, "response_url": {"http://127.0.0.1:1"}}.Encode()
+
+	// A bad signature.
+	req := httptest.NewRequest(http.MethodPost, "/command", strings.NewReader(form))
+	req.Header = slackHeader("other", time.Now(), form)
+	res := httptest.NewRecorder()
+	b.command(res, req)
+	if res.Code != http.StatusUnauthorized {
+		t.Errorf("a bad signature got %d", res.Code)
+	}
+
+	// A full queue.
+	for b.queue.add() {
+	}
+	req = httptest.NewRequest(http.MethodPost, "/command", strings.NewReader(form))
+	req.Header = slackHeader("secret", time.Now(), form)
+	res = httptest.NewRecorder()
+	b.command(res, req)
+	body, _ := io.ReadAll(res.Body)
+	if res.Code != http.StatusOK || !strings.Contains(string(body), busyMessage) {
+		t.Errorf("a full queue got %d %s", res.Code, body)
+	}
+}
@@ -0,0 +1,482 @@
+package server
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nomad-software/meme/cli"
+	"github.com/nomad-software/meme/output"
+	"github.com/nomad-software/meme/upload"
+)
+
+const (
+	maxChoices     = 25  // The most autocomplete choices Discord accepts.
+	maxPending     = 100 // The number of open meme dialogs remembered.
+	ephemeralFlag  = 64  // Only show a message to the user who ran the command.
+	modalPrefix    = "meme:"
+	messageCommand = "Make a meme"
+)
+
+// Interaction types.
+const (
+	pingInteraction         = 1
+	commandInteraction      = 2
+	autocompleteInteraction = 4
+	modalInteraction        = 5
+)
+
+// Interaction response types.
+const (
+	pongResponse         = 1
+	messageResponse      = 4
+	deferredResponse     = 5
+	autocompleteResponse = 8
+	modalResponse        = 9
+)
+
+var (
+	// The base URL of the Discord API.
+	discordAPI = "https://discord.com/api/v10"
+
+	// The fields set by the options of the slash command.
+	discordFields = map[string]string{
+		"template": "i",
+		"image":    "i",
+		"text":     "t",
+		"shake":    "shake",
+		"trigger":  "trigger",
+	}
+
+	// The commands registered with Discord. The message command makes a meme
+	// from the image of another message, asking for the text using a dialog.
+	discordCommands = []map[string]interface{}{
+		{
+			"name":        "meme",
+			"type":        1,
+			"description": "Make a meme",
+			"options": []map[string]interface{}{
+				{"type": 3, "name": "template", "description": "A built-in template", "autocomplete": true},
+				{"type": 3, "name": "text", "description": "The text, using | to separate the top and bottom", "max_length": 500},
+				{"type": 11, "name": "image", "description": "An image to use instead of a template"},
+				{"type": 5, "name": "shake", "description": "Shake the image"},
+				{"type": 5, "name": "trigger", "description": "Add the triggered banner"},
+			},
+		},
+		{
+			"name": messageCommand,
+			"type": 3,
+		},
+	}
+)
+
+// discord answers Discord interactions. Memes are rendered in the background
+// and attached to the reply.
+type discord struct {
+	base  cli.Options
+	key   ed25519.PublicKey
+	queue *renderQueue
+
+	mu      sync.Mutex
+	ids     []string
+	pending map[string]string // The images of open dialogs by their id.
+}
+
+// interaction is a request from Discord.
+type interaction struct {
+	Type          int             `json:"type"`
+	ApplicationID string          `json:"application_id"`
+	Token         string          `json:"token"`
+	Data          interactionData `json:"data"`
+}
+
+// interactionData is the command, autocomplete or dialog of an interaction.
+type interactionData struct {
+	Name     string `json:"name"`
+	TargetID string `json:"target_id"`
+	CustomID string `json:"custom_id"`
+	Options  []struct {
+		Name    string      `json:"name"`
+		Value   interface{} `json:"value"`
+		Focused bool        `json:"focused"`
+	} `json:"options"`
+	Resolved struct {
+		Attachments map[string]attachment     `json:"attachments"`
+		Messages    map[string]discordMessage `json:"messages"`
+	} `json:"resolved"`
+	Components []struct {
+		Components []struct {
+			CustomID string `json:"custom_id"`
+			Value    string `json:"value"`
+		} `json:"components"`
+	} `json:"components"`
+}
+
+// attachment is a file attached to a Discord message.
+type attachment struct {
+	URL         string `json:"url"`
+	ContentType string `json:"content_type"`
+}
+
+// discordMessage is a Discord message, which can contain images as
+// attachments or embeds.
+type discordMessage struct {
+	Attachments []attachment `json:"attachments"`
+	Embeds      []struct {
+		Image     *attachment `json:"image"`
+		Thumbnail *attachment `json:"thumbnail"`
+		Video     *attachment `json:"video"`
+	} `json:"embeds"`
+}
+
+// Create the Discord handler, sharing the render queue with the bot.
+func newDiscord(opt cli.Options, queue *renderQueue) *discord {
+	key, err := hex.DecodeString(opt.DiscordPublicKey)
+	if err == nil && len(key) != ed25519.PublicKeySize {
+		err = fmt.Errorf("expected %d bytes", ed25519.PublicKeySize)
+	}
+	output.OnError(err, "Invalid Discord public key")
+
+	return &discord{
+		base:    opt,
+		key:     key,
+		queue:   queue,
+		pending: make(map[string]string),
+	}
+}
+
+// Register the commands, replacing any that were registered before.
+func (d *discord) register() {
+	path := "/applications/" + d.base.DiscordAppID + "/commands"
+	if d.base.DiscordGuild != "" {
+		path = "/applications/" + d.base.DiscordAppID + "/guilds/" + d.base.DiscordGuild + "/commands"
+	}
+
+	body, err := json.Marshal(discordCommands)
+	output.OnError(err, "Could not encode the Discord commands")
+
+	err = discordRequest(http.MethodPut, path, "application/json", body, d.base.DiscordToken)
+	output.OnError(err, "Could not register the Discord commands")
+}
+
+// ServeHTTP answers an interaction.
+func (d *discord) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, "Could not read request", http.StatusBadRequest)
+		return
+	}
+
+	if err := d.verify(r.Header, body); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var in interaction
+	if err := json.Unmarshal(body, &in); err != nil {
+		http.Error(w, "Invalid interaction", http.StatusBadRequest)
+		return
+	}
+
+	switch in.Type {
+	case pingInteraction:
+		writeJSON(w, http.StatusOK, map[string]int{"type": pongResponse})
+
+	case autocompleteInteraction:
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"type": autocompleteResponse,
+			"data": map[string]interface{}{"choices": templateChoices(in.Data.option("template"))},
+		})
+
+	case commandInteraction:
+		if in.Data.Name == messageCommand {
+			d.dialog(w, in)
+			return
+		}
+		values, err := in.Data.fields()
+		if err != nil {
+			writeJSON(w, http.StatusOK, ephemeral(err.Error()))
+			return
+		}
+		d.acknowledge(w, in, values)
+
+	case modalInteraction:
+		d.mu.Lock()
+		image, ok := d.pending[strings.TrimPrefix(in.Data.CustomID, modalPrefix)]
+		d.mu.Unlock()
+
+		if !ok {
+			writeJSON(w, http.StatusOK, ephemeral("The dialog has expired, try again"))
+			return
+		}
+
+		values := map[string][]string{"i": {image}}
+		for _, row := range in.Data.Components {
+			for _, input := range row.Components {
+				if input.Value != "" {
+					values[input.CustomID] = []string{input.Value}
+				}
+			}
+		}
+		d.acknowledge(w, in, values)
+
+	default:
+		http.Error(w, "Unsupported interaction", http.StatusBadRequest)
+	}
+}
+
+// Ask for the text of a meme made from the image of another message.
+func (d *discord) dialog(w http.ResponseWriter, in interaction) {
+	image := in.Data.Resolved.Messages[in.Data.TargetID].image()
+	if image == "" {
+		writeJSON(w, http.StatusOK, ephemeral("The message doesn't have an image"))
+		return
+	}
+
+	id := make([]byte, 8)
+	rand.Read(id)
+	key := hex.EncodeToString(id)
+
+	d.mu.Lock()
+	d.pending[key] = image
+	d.ids = append(d.ids, key)
+	if len(d.ids) > maxPending {
+		delete(d.pending, d.ids[0])
+		d.ids = d.ids[1:]
+	}
+	d.mu.Unlock()
+
+	input := func(id string, label string) map[string]interface{} {
+		return map[string]interface{}{
+			"type": 1,
+			"components": []map[string]interface{}{
+				{"type": 4, "custom_id": id, "label": label, "style": 1, "required": false, "max_length": 250},
+			},
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"type": modalResponse,
+		"data": map[string]interface{}{
+			"custom_id":  modalPrefix + key,
+			"title":      messageCommand,
+			"components": []map[string]interface{}{input("top", "Top text"), input("bottom", "Bottom text")},
+		},
+	})
+}
+
+// Acknowledge the interaction, then render the meme and attach it to the
+// reply. Discord only waits a few seconds for the acknowledgement.
+func (d *discord) acknowledge(w http.ResponseWriter, in interaction, values map[string][]string) {
+	if !d.queue.add() {
+		writeJSON(w, http.StatusOK, ephemeral(busyMessage))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]int{"type": deferredResponse})
+
+	go func() {
+		if err := d.reply(in, values); err != nil {
+			output.Warn("Could not reply to a Discord interaction: %s", err)
+		}
+	}()
+}
+
+// Render the meme and replace the acknowledgement with it. If it can't be
+// rendered, the acknowledgement is deleted and the error is only shown to the
+// user who ran the command.
+func (d *discord) reply(in interaction, values map[string][]string) error {
+	opt, st, err := d.queue.generate(d.base, values)
+
+	hook := "/webhooks/" + in.ApplicationID + "/" + in.Token
+	original := hook + "/messages/@original"
+
+	if err != nil {
+		if err := discordRequest(http.MethodDelete, original, "", nil, ""); err != nil {
+			return err
+		}
+		body, _ := json.Marshal(ephemeral(err.Error())["data"])
+		return discordRequest(http.MethodPost, hook, "application/json", body, "")
+	}
+
+	alt := strings.TrimSpace(opt.Top + " " + opt.Bottom)
+	if r := []rune(alt); len(r) > maxAltText {
+		alt = string(r[:maxAltText])
+	}
+
+	var name string
+	var image []byte
+	err = output.Catch(func() {
+		name = upload.ObjectName(st)
+		image = st.Bytes()
+	})
+	if err != nil {
+		return err
+	}
+
+	payload, _ := json.Marshal(map[string]interface{}{
+		"attachments": []map[string]interface{}{
+			{"id": 0, "filename": name, "description": alt},
+		},
+	})
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	mw.WriteField("payload_json", string(payload))
+
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="files[0]"; filename="%s"`, name))
+	header.Set("Content-Type", st.ContentType())
+	part, _ := mw.CreatePart(header)
+	part.Write(image)
+	mw.Close()
+
+	return discordRequest(http.MethodPatch, original, mw.FormDataContentType(), buf.Bytes(), "")
+}
+
+// Verify the signature of an interaction.
+func (d *discord) verify(header http.Header, body []byte) error {
+	timestamp := header.Get("X-Signature-Timestamp")
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("Invalid request timestamp")
+	}
+
+	age := time.Since(time.Unix(seconds, 0))
+	if age > maxRequestAge || age < -maxRequestAge {
+		return errors.New("The request has expired")
+	}
+
+	sig, err := hex.DecodeString(header.Get("X-Signature-Ed25519"))
+	if err != nil || !ed25519.Verify(d.key, append([]byte(timestamp), body...), sig) {
+		return errors.New("Invalid request signature")
+	}
+	return nil
+}
+
+// Return the value of an option as a string.
+func (data interactionData) option(name string) string {
+	for _, opt := range data.Options {
+		if opt.Name == name && opt.Value != nil {
+			return fmt.Sprint(opt.Value)
+		}
+	}
+	return ""
+}
+
+// Return the render fields set by the options of the slash command.
+func (data interactionData) fields() (map[string][]string, error) {
+	values := make(map[string][]string)
+
+	for _, opt := range data.Options {
+		value := fmt.Sprint(opt.Value)
+		if opt.Name == "image" {
+			value = data.Resolved.Attachments[value].URL
+		}
+		if field, ok := discordFields[opt.Name]; ok && value != "" {
+			values[field] = append(values[field], value)
+		}
+	}
+
+	switch len(values["i"]) {
+	case 0:
+		return nil, errors.New("Choose a template or attach an image")
+	case 1:
+		return values, nil
+	default:
+		return nil, errors.New("Choose either a template or an image, not both")
+	}
+}
+
+// Return the first image or video of the message.
+func (m discordMessage) image() string {
+	for _, a := range m.Attachments {
+		if strings.HasPrefix(a.ContentType, "image/") || strings.HasPrefix(a.ContentType, "video/") {
+			return a.URL
+		}
+	}
+	for _, e := range m.Embeds {
+		for _, a := range []*attachment{e.Image, e.Video, e.Thumbnail} {
+			if a != nil && a.URL != "" {
+				return a.URL
+			}
+		}
+	}
+	return ""
+}
+
+// Return the templates matching the text typed so far, starting with those it
+// prefixes.
+func templateChoices(text string) []map[string]string {
+	text = strings.ToLower(strings.TrimSpace(text))
+
+	var prefixed, matched []string
+	for _, id := range cli.ImageIds {
+		if strings.HasPrefix(id, text) {
+			prefixed = append(prefixed, id)
+		} else if strings.Contains(id, text) {
+			matched = append(matched, id)
+		}
+	}
+
+	choices := []map[string]string{}
+	for _, id := range append(prefixed, matched...) {
+		if len(choices) == maxChoices {
+			break
+		}
+		choices = append(choices, map[string]string{"name": id, "value": id})
+	}
+	return choices
+}
+
+// Return a message response only shown to the user who ran the command.
+func ephemeral(text string) map[string]interface{} {
+	return map[string]interface{}{
+		"type": messageResponse,
+		"data": map[string]interface{}{"content": text, "flags": ephemeralFlag},
+	}
+}
+
+// Make a request to the Discord API. Requests using an interaction token
+// don't need the token of the bot.
+func discordRequest(method string, path string, contentType string, body []byte, token string) error {
+	req, err := http.NewRequest(method, discordAPI+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bot "+token)
+	}
+
+	resp, err := replyClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 200))
+		return fmt.Errorf("%s %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
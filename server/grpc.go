@@ -0,0 +1,277 @@
+package server
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nomad-software/meme/cli"
+	"github.com/nomad-software/meme/image"
+	"github.com/nomad-software/meme/image/stream"
+	"github.com/nomad-software/meme/output"
+)
+
+const (
+	grpcService   = "/meme.v1.Meme/" // The path prefix of the methods in meme.proto.
+	grpcChunkSize = 1 << 20          // bytes
+)
+
+// gRPC status codes.
+const (
+	codeOK                = 0
+	codeCanceled          = 1
+	codeInvalidArgument   = 3
+	codeDeadlineExceeded  = 4
+	codeResourceExhausted = 8
+	codeUnimplemented     = 12
+	codeInternal          = 13
+	codeUnavailable       = 14
+)
+
+// grpcError is a failed call, sent as its status.
+type grpcError struct {
+	code    int
+	message string
+}
+
+// Error implements the error interface.
+func (e *grpcError) Error() string {
+	return e.message
+}
+
+// Answer a call of the gRPC API, which is defined in meme.proto. Calls are
+// made over HTTP/2 using length prefixed messages, with the status of the call
+// sent in the trailers. Deadlines set by the client stop rendering, including
+// downloading and encoding.
+func serveGRPC(base cli.Options, queue *renderQueue, w http.ResponseWriter, r *http.Request) {
+	if r.ProtoMajor != 2 || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		http.Error(w, "gRPC calls must use HTTP/2 and the application/grpc content type", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Set("Grpc-Accept-Encoding", "identity")
+
+	ctx := r.Context()
+	var err error
+
+	if timeout := r.Header.Get("Grpc-Timeout"); timeout != "" {
+		var d time.Duration
+		d, err = parseTimeout(timeout)
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d)
+		defer cancel()
+	}
+	base.Context = ctx
+
+	var msg []byte
+	if err == nil {
+		msg, err = readMessage(r.Body)
+	}
+
+	if err == nil {
+		switch method := strings.TrimPrefix(r.URL.Path, grpcService); method {
+		case "ListTemplates":
+			err = writeMessage(w, marshalTemplates(cli.ImageIds))
+		case "Render":
+			err = grpcRender(base, queue, w, msg)
+		case "RenderStream":
+			err = grpcRenderStream(base, queue, w, msg)
+		default:
+			err = &grpcError{codeUnimplemented, fmt.Sprintf("Unknown method: %s", method)}
+		}
+	}
+
+	writeStatus(w, err)
+}
+
+// Render a meme, sending it in a single message.
+func grpcRender(base cli.Options, queue *renderQueue, w http.ResponseWriter, msg []byte) error {
+	res, err := grpcGenerate(base, queue, msg)
+	if err != nil {
+		return err
+	}
+	return writeMessage(w, res.marshal())
+}
+
+// Render a meme, sending its progress and then the image in chunks.
+func grpcRenderStream(base cli.Options, queue *renderQueue, w http.ResponseWriter, msg []byte) error {
+	// Progress is reported from this goroutine, so messages aren't sent at the
+	// same time. A client that has gone away cancels the context.
+	base.Progress = func(stage string, done int, total int) {
+		writeMessage(w, progressEvent(stage, done, total))
+	}
+
+	res, err := grpcGenerate(base, queue, msg)
+	if err != nil {
+		return err
+	}
+
+	image := res.Image
+	res.Image = nil
+	if err := writeMessage(w, resultEvent(res)); err != nil {
+		return err
+	}
+
+	for len(image) > 0 {
+		n := min(len(image), grpcChunkSize)
+		if err := writeMessage(w, chunkEvent(image[:n])); err != nil {
+			return err
+		}
+		image = image[n:]
+	}
+	return nil
+}
+
+// Render the meme of a RenderRequest message. Calls are turned away once too
+// many memes are waiting to be rendered.
+func grpcGenerate(base cli.Options, queue *renderQueue, msg []byte) (res renderResponse, err error) {
+	var req renderRequest
+	if err := req.unmarshal(msg); err != nil {
+		return res, &grpcError{codeInvalidArgument, err.Error()}
+	}
+
+	_, st, err := queue.tryGenerate(base, req.values())
+	if err != nil {
+		return res, &grpcError{errorCode(base.Context, err), err.Error()}
+	}
+
+	err = output.Catch(func() {
+		res = renderResponse{
+			Image:       st.Bytes(),
+			ContentType: st.ContentType(),
+			Format:      st.FileExt(),
+			Frames:      st.Frames(),
+			Size:        len(st.Bytes()),
+		}
+		res.Width, res.Height = st.Dimensions()
+	})
+	if err != nil {
+		return res, &grpcError{codeInternal, err.Error()}
+	}
+	return res, nil
+}
+
+// Return the status code of a failed render. Failures that aren't caused by
+// the call's deadline, the queue, downloading or encoding are caused by the
+// fields of the request.
+func errorCode(ctx context.Context, err error) int {
+	switch {
+	case errors.Is(err, errBusy):
+		return codeResourceExhausted
+	case ctx.Err() == context.DeadlineExceeded:
+		return codeDeadlineExceeded
+	case ctx.Err() == context.Canceled:
+		return codeCanceled
+	case errors.Is(err, image.ErrFetch):
+		return codeUnavailable
+	case errors.Is(err, stream.ErrEncode):
+		return codeInternal
+	}
+	return codeInvalidArgument
+}
+
+// Read the single message of a call. Compressed messages aren't supported as
+// no compression is accepted.
+func readMessage(r io.Reader) ([]byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, &grpcError{codeInvalidArgument, "Could not read the request message"}
+	}
+
+	if header[0] != 0 {
+		return nil, &grpcError{codeUnimplemented, "Compressed messages aren't supported"}
+	}
+
+	size := binary.BigEndian.Uint32(header[1:])
+	if size > maxBodySize {
+		return nil, &grpcError{codeResourceExhausted, fmt.Sprintf("The request message is larger than %d bytes", maxBodySize)}
+	}
+
+	msg := make([]byte, size)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, &grpcError{codeInvalidArgument, "Could not read the request message"}
+	}
+	return msg, nil
+}
+
+// Write a message of the response and flush it to the client.
+func writeMessage(w http.ResponseWriter, msg []byte) error {
+	var header [5]byte
+	binary.BigEndian.PutUint32(header[1:], uint32(len(msg)))
+
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	return http.NewResponseController(w).Flush()
+}
+
+// Write the status of the call in the trailers.
+func writeStatus(w http.ResponseWriter, err error) {
+	code, msg := codeOK, ""
+
+	var e *grpcError
+	if errors.As(err, &e) {
+		code, msg = e.code, e.message
+	} else if err != nil {
+		code, msg = codeInternal, err.Error()
+	}
+
+	w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(code))
+	if msg != "" {
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", encodeStatus(msg))
+	}
+}
+
+// Percent encode a status message, as required by gRPC.
+func encodeStatus(msg string) string {
+	var b strings.Builder
+	for i := 0; i < len(msg); i++ {
+		c := msg[i]
+		if c < ' ' || c > '~' || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// Parse the timeout of a call, e.g. '500m' is 500 milliseconds. Timeouts too
+// long to hold are clamped to the longest duration.
+func parseTimeout(timeout string) (time.Duration, error) {
+	units := map[byte]time.Duration{
+		'H': time.Hour,
+		'M': time.Minute,
+		'S': time.Second,
+		'm': time.Millisecond,
+		'u': time.Microsecond,
+		'n': time.Nanosecond,
+	}
+
+	if len(timeout) < 2 || len(timeout) > 9 {
+		return 0, &grpcError{codeInvalidArgument, fmt.Sprintf("Invalid timeout: %s", timeout)}
+	}
+
+	unit, ok := units[timeout[len(timeout)-1]]
+	n, err := strconv.ParseInt(timeout[:len(timeout)-1], 10, 64)
+	if !ok || err != nil || n < 0 {
+		return 0, &grpcError{codeInvalidArgument, fmt.Sprintf("Invalid timeout: %s", timeout)}
+	}
+
+	// Hours with 8 digits can be longer than a duration can hold.
+	if n > int64(math.MaxInt64/unit) {
+		return math.MaxInt64, nil
+	}
+	return time.Duration(n) * unit, nil
+}
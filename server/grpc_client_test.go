@@ -0,0 +1,139 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bufbuild/protocompile"
+	"github.com/nomad-software/meme/cli"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// Return a message of the named type in meme.proto, decoded from json.
+func newMessage(t *testing.T, fd protoreflect.FileDescriptor, name string, fields string) *dynamicpb.Message {
+	t.Helper()
+	m := dynamicpb.NewMessage(fd.Messages().ByName(protoreflect.Name(name)))
+	if err := protojson.Unmarshal([]byte(fields), m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// Return the value of a field of a message.
+func field(m protoreflect.Message, name string) protoreflect.Value {
+	return m.Get(m.Descriptor().Fields().ByName(protoreflect.Name(name)))
+}
+
+// The API is called by grpc-go using messages encoded by the protobuf library
+// from meme.proto, to check the framing, encoding and status codes match.
+func TestGRPCClient(t *testing.T) {
+	compiler := protocompile.Compiler{Resolver: &protocompile.SourceResolver{}}
+	files, err := compiler.Compile(context.Background(), "meme.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	proto := files[0]
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	srv := httptest.NewUnstartedServer(serveHandler(cli.Options{BaseArgs: []string{"-allow-private"}}))
+	srv.Config.Protocols = new(http.Protocols)
+	srv.Config.Protocols.SetHTTP1(true)
+	srv.Config.Protocols.SetUnencryptedHTTP2(true)
+	srv.Start()
+	defer srv.Close()
+
+	conn, err := grpc.NewClient("passthrough:///"+srv.Listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	templates := newMessage(t, proto, "ListTemplatesResponse", "{}")
+	err = conn.Invoke(ctx, grpcService+"ListTemplates", newMessage(t, proto, "ListTemplatesRequest", "{}"), templates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := field(templates, "templates").List().Len(); got != len(cli.ImageIds) {
+		t.Errorf("got %d templates, want %d", got, len(cli.ImageIds))
+	}
+
+	req := newMessage(t, proto, "RenderRequest", `{"image":"doge","text":"such|grpc"}`)
+	res := newMessage(t, proto, "RenderResponse", "{}")
+	if err := conn.Invoke(ctx, grpcService+"Render", req, res); err != nil {
+		t.Fatal(err)
+	}
+	if got := field(res, "content_type").String(); got != "image/png" {
+		t.Errorf("got content type %q", got)
+	}
+	if w, h := field(res, "width").Int(), field(res, "height").Int(); w != 620 || h != 620 {
+		t.Errorf("got a %dx%d image", w, h)
+	}
+	if size := field(res, "size").Int(); size == 0 || int(size) != len(field(res, "image").Bytes()) {
+		t.Errorf("got %d bytes, want %d", len(field(res, "image").Bytes()), size)
+	}
+
+	events, err := conn.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true}, grpcService+"RenderStream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := events.SendMsg(req); err != nil {
+		t.Fatal(err)
+	}
+	events.CloseSend()
+
+	var result protoreflect.Message
+	var chunks []byte
+	for {
+		event := newMessage(t, proto, "RenderEvent", "{}")
+		err := events.RecvMsg(event)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch set := event.WhichOneof(event.Descriptor().Oneofs().ByName("event")); set.Name() {
+		case "result":
+			result = field(event, "result").Message()
+		case "chunk":
+			chunks = append(chunks, field(event, "chunk").Bytes()...)
+		}
+	}
+	if result == nil || int(field(result, "size").Int()) != len(chunks) {
+		t.Errorf("the streamed image doesn't match its result: %d bytes", len(chunks))
+	}
+
+	tests := []struct {
+		fields string
+		code   codes.Code
+	}{
+		{`{"image":"doge","options":{"max-pixels":"1"}}`, codes.InvalidArgument},
+		{`{"image":"doge","options":{"crop":"nope"}}`, codes.InvalidArgument},
+		{`{"image":"` + failing.URL + `/doge.png"}`, codes.Unavailable},
+	}
+
+	for _, test := range tests {
+		res := newMessage(t, proto, "RenderResponse", "{}")
+		err := conn.Invoke(ctx, grpcService+"Render", newMessage(t, proto, "RenderRequest", test.fields), res)
+		if got := status.Code(err); got != test.code {
+			t.Errorf("%s: got %s, want %s (%v)", test.fields, got, test.code, err)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseTimeout(t *testing.T) {
+	tests := []struct {
+		timeout string
+		want    time.Duration
+		ok      bool
+	}{
+		{"500m", 500 * time.Millisecond, true},
+		{"1S", time.Second, true},
+		{"2M", 2 * time.Minute, true},
+		{"3H", 3 * time.Hour, true},
+		{"10u", 10 * time.Microsecond, true},
+		{"99n", 99 * time.Nanosecond, true},
+		{"0S", 0, true},
+		{"99999999S", 99999999 * time.Second, true},
+		{"99999999M", 99999999 * time.Minute, true},
+		{"99999999H", math.MaxInt64, true},
+		{"2562047H", 2562047 * time.Hour, true},
+		{"2562048H", math.MaxInt64, true},
+		{"", 0, false},
+		{"S", 0, false},
+		{"100", 0, false},
+		{"10x", 0, false},
+		{"-1S", 0, false},
+		{"1.5S", 0, false},
+		{"123456789S", 0, false},
+	}
+
+	for _, test := range tests {
+		got, err := parseTimeout(test.timeout)
+		if (err == nil) != test.ok {
+			t.Errorf("parseTimeout(%q): got error %v", test.timeout, err)
+			continue
+		}
+		if test.ok && got != test.want {
+			t.Errorf("parseTimeout(%q) = %s, want %s", test.timeout, got, test.want)
+		}
+		if got < 0 {
+			t.Errorf("parseTimeout(%q) is negative", test.timeout)
+		}
+	}
+}
+
+func TestReadMessage(t *testing.T) {
+	big := []byte{0, 0xff, 0xff, 0xff, 0xff}
+
+	tests := []struct {
+		name string
+		in   []byte
+		msg  []byte
+		code int
+	}{
+		{"message", []byte{0, 0, 0, 0, 3, 'a', 'b', 'c'}, []byte("abc"), codeOK},
+		{"empty message", []byte{0, 0, 0, 0, 0}, []byte{}, codeOK},
+		{"compressed", []byte{1, 0, 0, 0, 3, 'a', 'b', 'c'}, nil, codeUnimplemented},
+		{"too large", big, nil, codeResourceExhausted},
+		{"short header", []byte{0, 0}, nil, codeInvalidArgument},
+		{"short message", []byte{0, 0, 0, 0, 5, 'a'}, nil, codeInvalidArgument},
+	}
+
+	for _, test := range tests {
+		msg, err := readMessage(bytes.NewReader(test.in))
+
+		code := codeOK
+		var e *grpcError
+		if errors.As(err, &e) {
+			code = e.code
+		}
+		if code != test.code {
+			t.Errorf("%s: got code %d, want %d (%v)", test.name, code, test.code, err)
+		}
+		if test.code == codeOK && !bytes.Equal(msg, test.msg) {
+			t.Errorf("%s: got %q, want %q", test.name, msg, test.msg)
+		}
+	}
+}
+
+func TestWriteMessage(t *testing.T) {
+	w := httptest.NewRecorder()
+	if err := writeMessage(w, []byte("abc")); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeMessage(w, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []byte{0, 0, 0, 0, 3, 'a', 'b', 'c', 0, 0, 0, 0, 0}
+	if !bytes.Equal(w.Body.Bytes(), want) {
+		t.Errorf("got %v, want %v", w.Body.Bytes(), want)
+	}
+	if !w.Flushed {
+		t.Errorf("the messages weren't flushed")
+	}
+}
+
+func TestWriteStatus(t *testing.T) {
+	tests := []struct {
+		err     error
+		status  string
+		message string
+	}{
+		{nil, "0", ""},
+		{&grpcError{codeInvalidArgument, "Bad 100% \"café\"\n"}, "3", "Bad 100%25 \"caf%C3%A9\"%0A"},
+		{errors.New("boom"), "13", "boom"},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		writeStatus(w, test.err)
+
+		h := w.Header()
+		if got := h.Get("Trailer:Grpc-Status"); got != test.status {
+			t.Errorf("%v: got status %q, want %q", test.err, got, test.status)
+		}
+		if got := h.Get("Trailer:Grpc-Message"); got != test.message {
+			t.Errorf("%v: got message %q, want %q", test.err, got, test.message)
+		}
+	}
+}
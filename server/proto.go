@@ -0,0 +1,316 @@
+package server
+
+import (
+	"errors"
+	"strconv"
+)
+
+// Protocol buffer wire types.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+var (
+	errTruncated = errors.New("The message is truncated")
+)
+
+// The messages of meme.proto. Only the messages received are decoded and only
+// those sent are encoded.
+
+// renderRequest is the RenderRequest message.
+type renderRequest struct {
+	Image   string
+	Text    string
+	Top     string
+	Bottom  string
+	Boxes   []string
+	Font    string
+	Color   string
+	Stroke  string
+	Shake   bool
+	Trigger bool
+	Gif     bool
+	MaxSize int
+	Options map[string]string
+}
+
+// renderResponse is the RenderResponse message.
+type renderResponse struct {
+	Image       []byte
+	ContentType string
+	Format      string
+	Width       int
+	Height      int
+	Frames      int
+	Size        int
+}
+
+// Decode a RenderRequest message.
+func (req *renderRequest) unmarshal(b []byte) error {
+	p := protoReader{buf: b}
+
+	for f, ok := p.next(); ok; f, ok = p.next() {
+		switch f.num {
+		case 1:
+			req.Image = string(f.bytes)
+		case 2:
+			req.Text = string(f.bytes)
+		case 3:
+			req.Top = string(f.bytes)
+		case 4:
+			req.Bottom = string(f.bytes)
+		case 5:
+			req.Boxes = append(req.Boxes, string(f.bytes))
+		case 6:
+			req.Font = string(f.bytes)
+		case 7:
+			req.Color = string(f.bytes)
+		case 8:
+			req.Stroke = string(f.bytes)
+		case 9:
+			req.Shake = f.value != 0
+		case 10:
+			req.Trigger = f.value != 0
+		case 11:
+			req.Gif = f.value != 0
+		case 12:
+			req.MaxSize = int(int32(f.value))
+		case 15:
+			key, value, err := mapEntry(f.bytes)
+			if err != nil {
+				return err
+			}
+			if req.Options == nil {
+				req.Options = make(map[string]string)
+			}
+			req.Options[key] = value
+		}
+	}
+
+	return p.err
+}
+
+// Return the render fields set by the request.
+func (req renderRequest) values() map[string][]string {
+	values := make(map[string][]string)
+
+	set := func(name string, value string) {
+		if value != "" {
+			values[name] = append(values[name], value)
+		}
+	}
+	flag := func(name string, value bool) {
+		if value {
+			values[name] = []string{"true"}
+		}
+	}
+
+	set("image", req.Image)
+	set("text", req.Text)
+	set("top", req.Top)
+	set("bottom", req.Bottom)
+	for _, box := range req.Boxes {
+		set("box", box)
+	}
+	set("font", req.Font)
+	set("color", req.Color)
+	set("stroke", req.Stroke)
+	flag("shake", req.Shake)
+	flag("trigger", req.Trigger)
+	flag("gif", req.Gif)
+	if req.MaxSize != 0 {
+		set("max-size", strconv.Itoa(req.MaxSize))
+	}
+
+	for key, value := range req.Options {
+		values[key] = append(values[key], value)
+	}
+
+	return values
+}
+
+// Encode a RenderResponse message.
+func (res renderResponse) marshal() []byte {
+	var p protoWriter
+	p.bytes(1, res.Image)
+	p.string(2, res.ContentType)
+	p.string(3, res.Format)
+	p.int(4, res.Width)
+	p.int(5, res.Height)
+	p.int(6, res.Frames)
+	p.int(7, res.Size)
+	return p.buf
+}
+
+// Encode a ListTemplatesResponse message.
+func marshalTemplates(templates []string) []byte {
+	var p protoWriter
+	for _, id := range templates {
+		p.string(1, id)
+	}
+	return p.buf
+}
+
+// Encode a RenderEvent message containing progress.
+func progressEvent(stage string, done int, total int) []byte {
+	var progress protoWriter
+	progress.string(1, stage)
+	progress.int(2, done)
+	progress.int(3, total)
+
+	var p protoWriter
+	p.message(1, progress.buf)
+	return p.buf
+}
+
+// Encode a RenderEvent message containing the result.
+func resultEvent(res renderResponse) []byte {
+	var p protoWriter
+	p.message(2, res.marshal())
+	return p.buf
+}
+
+// Encode a RenderEvent message containing a chunk of the image.
+func chunkEvent(chunk []byte) []byte {
+	var p protoWriter
+	p.message(3, chunk)
+	return p.buf
+}
+
+// Decode an entry of a map<string, string> field.
+func mapEntry(b []byte) (key string, value string, err error) {
+	p := protoReader{buf: b}
+	for f, ok := p.next(); ok; f, ok = p.next() {
+		switch f.num {
+		case 1:
+			key = string(f.bytes)
+		case 2:
+			value = string(f.bytes)
+		}
+	}
+	return key, value, p.err
+}
+
+// protoWriter encodes the fields of a protocol buffer message. Fields with
+// their default value are left out, as in proto3.
+type protoWriter struct {
+	buf []byte
+}
+
+// Write a varint.
+func (p *protoWriter) varint(v uint64) {
+	for v >= 0x80 {
+		p.buf = append(p.buf, byte(v)|0x80)
+		v >>= 7
+	}
+	p.buf = append(p.buf, byte(v))
+}
+
+// Write the tag of a field.
+func (p *protoWriter) tag(num int, wire int) {
+	p.varint(uint64(num)<<3 | uint64(wire))
+}
+
+// Write an integer field.
+func (p *protoWriter) int(num int, v int) {
+	if v != 0 {
+		p.tag(num, wireVarint)
+		p.varint(uint64(int64(v)))
+	}
+}
+
+// Write a bytes field.
+func (p *protoWriter) bytes(num int, b []byte) {
+	if len(b) > 0 {
+		p.message(num, b)
+	}
+}
+
+// Write a string field.
+func (p *protoWriter) string(num int, s string) {
+	p.bytes(num, []byte(s))
+}
+
+// Write a length delimited field even if it's empty, such as an embedded
+// message or a member of a oneof.
+func (p *protoWriter) message(num int, b []byte) {
+	p.tag(num, wireBytes)
+	p.varint(uint64(len(b)))
+	p.buf = append(p.buf, b...)
+}
+
+// protoField is a decoded field. Varints are held in the value and length
+// delimited fields in the bytes.
+type protoField struct {
+	num   int
+	value uint64
+	bytes []byte
+}
+
+// protoReader decodes the fields of a protocol buffer message.
+type protoReader struct {
+	buf []byte
+	err error
+}
+
+// Return the next field, or false at the end of the message or on error.
+func (p *protoReader) next() (protoField, bool) {
+	if p.err != nil || len(p.buf) == 0 {
+		return protoField{}, false
+	}
+
+	key := p.varint()
+	f := protoField{num: int(key >> 3)}
+
+	switch key & 7 {
+	case wireVarint:
+		f.value = p.varint()
+	case wireFixed64:
+		p.skip(8)
+	case wireBytes:
+		n := p.varint()
+		if n > uint64(len(p.buf)) {
+			p.err = errTruncated
+			break
+		}
+		f.bytes = p.buf[:n]
+		p.buf = p.buf[n:]
+	case wireFixed32:
+		p.skip(4)
+	default:
+		p.err = errors.New("The message has an unsupported wire type")
+	}
+
+	return f, p.err == nil
+}
+
+// Read a varint.
+func (p *protoReader) varint() uint64 {
+	var v uint64
+	for shift := 0; shift < 64; shift += 7 {
+		if len(p.buf) == 0 {
+			p.err = errTruncated
+			return 0
+		}
+		b := p.buf[0]
+		p.buf = p.buf[1:]
+		v |= uint64(b&0x7f) << shift
+		if b < 0x80 {
+			return v
+		}
+	}
+	p.err = errors.New("The message has an invalid varint")
+	return 0
+}
+
+// Skip a fixed number of bytes.
+func (p *protoReader) skip(n int) {
+	if n > len(p.buf) {
+		p.err = errTruncated
+		return
+	}
+	p.buf = p.buf[n:]
+}
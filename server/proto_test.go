@@ -0,0 +1,148 @@
+package server
+
+import (
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+// The expected bytes are encoded from meme.proto by the protobuf library, with
+// deterministic map ordering.
+
+// Decode a hex string.
+func unhex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestRenderRequestUnmarshal(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  string
+		req  renderRequest
+		ok   bool
+	}{
+		{
+			name: "every field",
+			msg: "0a04646f676512127375636820776f777c76657279206d656d651a03746f702206626f74746f6d2a0d31302c34302c38302c3230" +
+				"3a612a0b302c302c35302c35303a623206496d706163743a042366663042042330303048015001580160ac027a130a0463726f70" +
+				"120b31302c31302c35302c35307a0a0a057370656564120132",
+			req: renderRequest{
+				Image:   "doge",
+				Text:    "such wow|very meme",
+				Top:     "top",
+				Bottom:  "bottom",
+				Boxes:   []string{"10,40,80,20:a", "0,0,50,50:b"},
+				Font:    "Impact",
+				Color:   "#ff0",
+				Stroke:  "#000",
+				Shake:   true,
+				Trigger: true,
+				Gif:     true,
+				MaxSize: 300,
+				Options: map[string]string{"crop": "10,10,50,50", "speed": "2"},
+			},
+			ok: true,
+		},
+		{
+			name: "negative int32",
+			msg:  "0a04646f676560ffffffffffffffffff01",
+			req:  renderRequest{Image: "doge", MaxSize: -1},
+			ok:   true,
+		},
+		{
+			name: "unknown fields are skipped",
+			msg:  "0a04646f6765" + "a80607" + "b1060102030405060708" + "b50601020304" + "ba0603616263",
+			req:  renderRequest{Image: "doge"},
+			ok:   true,
+		},
+		{name: "empty", msg: "", req: renderRequest{}, ok: true},
+		{name: "truncated string", msg: "0a05646f6765", ok: false},
+		{name: "truncated varint", msg: "60ff", ok: false},
+		{name: "truncated fixed64", msg: "b10601", ok: false},
+		{name: "unsupported wire type", msg: "0b", ok: false},
+		{name: "truncated map entry", msg: "7a020a05", ok: false},
+	}
+
+	for _, test := range tests {
+		var req renderRequest
+		err := req.unmarshal(unhex(t, test.msg))
+		if (err == nil) != test.ok {
+			t.Errorf("%s: got error %v", test.name, err)
+			continue
+		}
+		if test.ok && !reflect.DeepEqual(req, test.req) {
+			t.Errorf("%s: got %+v, want %+v", test.name, req, test.req)
+		}
+	}
+}
+
+func TestRenderResponseMarshal(t *testing.T) {
+	res := renderResponse{
+		Image:       []byte{0x89, 'P', 'N', 'G'},
+		ContentType: "image/png",
+		Format:      "png",
+		Width:       620,
+		Height:      400,
+		Frames:      1,
+		Size:        4,
+	}
+	want := "0a0489504e471209696d6167652f706e671a03706e6720ec0428900330013804"
+
+	if got := hex.EncodeToString(res.marshal()); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if got := hex.EncodeToString(renderResponse{}.marshal()); got != "" {
+		t.Errorf("an empty response got %s", got)
+	}
+}
+
+func TestEvents(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  []byte
+		want string
+	}{
+		{"progress", progressEvent("drawing", 12, 40), "0a0d0a0764726177696e67100c1828"},
+		{"progress with zeros", progressEvent("loading", 0, 0), "0a090a076c6f6164696e67"},
+		{"chunk", chunkEvent([]byte("abc")), "1a03616263"},
+		{"empty chunk", chunkEvent(nil), "1a00"},
+		{"result", resultEvent(renderResponse{Format: "gif", Frames: 10}), "12071a03676966300a"},
+		{"templates", marshalTemplates([]string{"doge", "kirk-khan"}), "0a04646f67650a096b69726b2d6b68616e"},
+	}
+
+	for _, test := range tests {
+		if got := hex.EncodeToString(test.msg); got != test.want {
+			t.Errorf("%s: got %s, want %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestMapEntry(t *testing.T) {
+	tests := []struct {
+		entry string
+		key   string
+		value string
+		ok    bool
+	}{
+		{"0a0463726f70120b31302c31302c35302c3530", "crop", "10,10,50,50", true},
+		{"0a057370656564", "speed", "", true},
+		{"120132", "", "2", true},
+		{"", "", "", true},
+		{"0a0563726f70", "", "", false},
+	}
+
+	for _, test := range tests {
+		key, value, err := mapEntry(unhex(t, test.entry))
+		if (err == nil) != test.ok {
+			t.Errorf("mapEntry(%s): got error %v", test.entry, err)
+			continue
+		}
+		if test.ok && (key != test.key || value != test.value) {
+			t.Errorf("mapEntry(%s) = %q, %q, want %q, %q", test.entry, key, value, test.key, test.value)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/nomad-software/meme/cli"
+	"github.com/nomad-software/meme/image"
+	"github.com/nomad-software/meme/image/stream"
+)
+
+const (
+	renderTimeout = 2 * time.Minute  // The time allowed to render a meme.
+	queuePerCPU   = 4                // The memes waiting to be rendered per CPU.
+	readTimeout   = 30 * time.Second // The time allowed to read a request.
+	writeTimeout  = 30 * time.Second // The time allowed to write a response.
+	idleTimeout   = 2 * time.Minute  // The time an idle connection is kept open.
+	busyMessage   = "Too many memes are being made, try again in a minute"
+)
+
+var (
+	// Returned when a meme can't be rendered because the queue is full.
+	errBusy = errors.New(busyMessage)
+)
+
+// renderQueue limits the memes rendered by a server. Memes are rendered a few
+// at a time, and new ones are turned away once too many are waiting.
+type renderQueue struct {
+	running chan struct{} // The memes being rendered.
+	waiting chan struct{} // The memes being rendered or waiting to be.
+}
+
+// Create a queue rendering the passed number of memes at once.
+func newRenderQueue(workers int) *renderQueue {
+	return &renderQueue{
+		running: make(chan struct{}, workers),
+		waiting: make(chan struct{}, workers*queuePerCPU),
+	}
+}
+
+// Add a meme to the queue, returning false if the queue is full. Each meme
+// added must be rendered using generate.
+func (q *renderQueue) add() bool {
+	select {
+	case q.waiting <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// Render a meme once it's its turn, then remove it from the queue. Waiting
+// stops when the context of the base options is done, and rendering is
+// stopped if it takes too long.
+func (q *renderQueue) generate(base cli.Options, values map[string][]string) (cli.Options, stream.Stream, error) {
+	defer func() { <-q.waiting }()
+
+	ctx := base.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	select {
+	case q.running <- struct{}{}:
+	case <-ctx.Done():
+		return base, stream.Stream{}, ctx.Err()
+	}
+	defer func() { <-q.running }()
+
+	ctx, cancel := context.WithTimeout(ctx, renderTimeout)
+	defer cancel()
+
+	base.Context = ctx
+	return generate(base, values)
+}
+
+// Render the meme of a request if there's room in the queue, returning
+// errBusy if there isn't. The time spent waiting counts towards the render
+// timeout, so the response is written in time.
+func (q *renderQueue) tryGenerate(base cli.Options, values map[string][]string) (cli.Options, stream.Stream, error) {
+	if !q.add() {
+		return base, stream.Stream{}, errBusy
+	}
+
+	ctx, cancel := context.WithTimeout(base.Context, renderTimeout)
+	defer cancel()
+
+	base.Context = ctx
+	return q.generate(base, values)
+}
+
+// Return the http status of a failed render.
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, errBusy):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, image.ErrFetch):
+		return http.StatusBadGateway
+	case errors.Is(err, stream.ErrEncode):
+		return http.StatusInternalServerError
+	}
+	return http.StatusBadRequest
+}
+
+// Create a server with timeouts, so slow or idle clients can't hold on to
+// connections. The write timeout starts once the request has been read.
+func newServer(addr string, handler http.Handler, write time.Duration) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: readTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      write,
+		IdleTimeout:       idleTimeout,
+	}
+}
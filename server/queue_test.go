@@ -0,0 +1,54 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/nomad-software/meme/cli"
+)
+
+func TestQueueFull(t *testing.T) {
+	queue := newRenderQueue(1)
+	for queue.add() {
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/render?i=doge&t=wow", nil)
+	res := httptest.NewRecorder()
+	render(cli.Options{}, queue, res, req)
+	if res.Code != http.StatusServiceUnavailable {
+		t.Errorf("render got %d", res.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/render", strings.NewReader(`{"i":"doge","t":"wow"}`))
+	res = httptest.NewRecorder()
+	webRender(cli.Options{}, queue, res, req)
+	if res.Code != http.StatusServiceUnavailable || !strings.Contains(res.Body.String(), busyMessage) {
+		t.Errorf("web render got %d %s", res.Code, res.Body)
+	}
+
+	_, err := grpcGenerate(cli.Options{}, queue, nil)
+	var e *grpcError
+	if !errors.As(err, &e) || e.code != codeResourceExhausted {
+		t.Errorf("grpc got %v", err)
+	}
+}
+
+func TestQueueWaiting(t *testing.T) {
+	queue := newRenderQueue(1)
+	queue.running <- struct{}{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, _, err := queue.tryGenerate(cli.Options{Context: ctx}, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("a cancelled request got %v", err)
+	}
+	if len(queue.waiting) != 0 {
+		t.Errorf("the request wasn't removed from the queue")
+	}
+}
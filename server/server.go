@@ -0,0 +1,172 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"strings"
+
+	"github.com/nomad-software/meme/cli"
+	"github.com/nomad-software/meme/image"
+	"github.com/nomad-software/meme/image/stream"
+	"github.com/nomad-software/meme/output"
+)
+
+const (
+	maxBodySize = 1 << 20 // bytes
+)
+
+// Fields that can be passed to the render endpoint. Anything that reads or
+// writes local files or uploads is left out.
+var renderFields = []string{
+	"i", "image", "t", "text", "top", "bottom", "box", "f", "font", "preset",
+	"gif", "shake", "trigger", "color", "stroke", "max-size",
+	"crop", "rotate", "flip", "pad", "pad-color", "round",
+	"trim", "speed", "drop", "reverse", "pingpong", "loop",
+	"start", "duration", "frame", "frames", "delay",
+}
+
+// Serve starts the http API and blocks until it fails. The options passed to
+// the serve command are used as defaults for every request.
+//
+//	GET  /templates         A json list of the built-in templates.
+//	GET  /render?i=doge&... Render a meme, the fields are the same as the flags.
+//	POST /render            The same, with the fields as a form or json object.
+//
+// The gRPC API defined in meme.proto is served on the same address, using
+// HTTP/2 without TLS. Only a few memes are rendered at once and requests are
+// turned away with a 503 once too many are waiting.
+func Serve(opt cli.Options) {
+	// Responses are written once the meme is rendered.
+	srv := newServer(opt.Addr, serveHandler(opt), renderTimeout+writeTimeout)
+	srv.Protocols = new(http.Protocols)
+	srv.Protocols.SetHTTP1(true)
+	srv.Protocols.SetUnencryptedHTTP2(true)
+
+	output.Info("Listening on http://%s", opt.Addr)
+	err := srv.ListenAndServe()
+	output.OnError(err, "Could not start the server")
+}
+
+// Return the handler of the http and gRPC APIs.
+func serveHandler(opt cli.Options) http.Handler {
+	queue := newRenderQueue(runtime.NumCPU())
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/templates", templates)
+	mux.HandleFunc("/render", func(w http.ResponseWriter, r *http.Request) {
+		render(opt, queue, w, r)
+	})
+	mux.HandleFunc(grpcService, func(w http.ResponseWriter, r *http.Request) {
+		serveGRPC(opt, queue, w, r)
+	})
+	return mux
+}
+
+// List the built-in templates.
+func templates(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cli.ImageIds)
+}
+
+// Render a meme and write the image.
+func render(base cli.Options, queue *renderQueue, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	values, err := requestValues(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	base.Context = r.Context()
+	_, st, err := queue.tryGenerate(base, values)
+	if err != nil {
+		http.Error(w, err.Error(), errorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", st.ContentType())
+	w.Write(st.Bytes())
+}
+
+// Render a meme from the fields of a request, applied on top of the options
+// passed to the command. Fields that aren't allowed, fonts that are files and
+// images that aren't templates or URLs are rejected. The parsed options are
+// returned along with the meme. The context and progress of the base options
+// are used for rendering.
+func generate(base cli.Options, values map[string][]string) (opt cli.Options, st stream.Stream, err error) {
+	err = output.Catch(func() {
+		for key, value := range values {
+			if !allowed(key) {
+				output.Error(fmt.Sprintf("Field not allowed: %s", key))
+			}
+			if name := normalize(key); (name == "f" || name == "font") && strings.ContainsAny(strings.Join(value, ""), `/\`) {
+				output.Error("Font must be the name of an installed font")
+			}
+		}
+
+		opt = cli.ParseJob(base.BaseArgs, values)
+		opt.Context = base.Context
+		opt.Progress = base.Progress
+		opt.Valid()
+
+		for _, source := range opt.Images {
+			if !isServable(source) {
+				output.Error(fmt.Sprintf("Image must be a template, URL or data URI: %s", source))
+			}
+		}
+
+		st = image.Generate(opt)
+	})
+	return opt, st, err
+}
+
+// Read the fields of the request from the query string, a form or a json
+// object.
+func requestValues(r *http.Request) (map[string][]string, error) {
+	r.Body = http.MaxBytesReader(nil, r.Body, maxBodySize)
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		var fields map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&fields); err != nil {
+			return nil, fmt.Errorf("Could not decode json: %s", err)
+		}
+		values := cli.FlagValues(fields)
+		for key, value := range r.URL.Query() {
+			values[key] = value
+		}
+		return values, nil
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return nil, fmt.Errorf("Could not parse form: %s", err)
+	}
+	return r.Form, nil
+}
+
+// Return true if the field can be passed to the render endpoint.
+func allowed(key string) bool {
+	for _, field := range renderFields {
+		if normalize(key) == field {
+			return true
+		}
+	}
+	return false
+}
+
+// Normalize a field name.
+func normalize(key string) string {
+	return strings.ToLower(strings.TrimSpace(key))
+}
+
+// Return true if the image is a built-in template, a URL or a data URI, which
+// are the only sources the server will read.
+func isServable(source string) bool {
+	return isTemplate(source) || strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") ||
+		strings.HasPrefix(strings.ToLower(source), "data:")
+}
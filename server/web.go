@@ -0,0 +1,218 @@
+package server
+
+import (
+	"embed"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/nomad-software/meme/cli"
+	"github.com/nomad-software/meme/font"
+	"github.com/nomad-software/meme/image"
+	"github.com/nomad-software/meme/image/stream"
+	"github.com/nomad-software/meme/output"
+	"github.com/nomad-software/meme/upload"
+)
+
+const (
+	webPath       = "web"           // The directory of the embedded web editor.
+	uploadTimeout = 2 * time.Minute // The time allowed to upload a meme.
+)
+
+//go:embed web/*
+var webFiles embed.FS
+
+// rendered is the json response of the web render API.
+type rendered struct {
+	Image  string `json:"image"` // A data URL.
+	Format string `json:"format"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+	Frames int    `json:"frames"`
+	Bytes  int    `json:"bytes"`
+}
+
+// uploaded is the json response of the web upload API.
+type uploaded struct {
+	URL        string `json:"url"`
+	DeleteHash string `json:"deletehash,omitempty"`
+}
+
+// Web serves the browser editor and its json API, blocking until it fails. The
+// options passed to the web command are used as defaults for every meme,
+// including the upload provider.
+//
+//	GET  /                   The editor.
+//	GET  /api/config         The features enabled by the options.
+//	GET  /api/templates      A json list of the built-in templates.
+//	GET  /api/templates/doge The image of a built-in template.
+//	GET  /api/fonts          A json list of the installed fonts.
+//	POST /api/render         Render a meme from a json object of fields.
+//	POST /api/upload         Render a meme and upload it.
+//
+// Only a few memes are rendered at once and requests are turned away with a
+// 503 once too many are waiting.
+func Web(opt cli.Options) {
+	assets, err := fs.Sub(webFiles, webPath)
+	output.OnError(err, "Could not read embedded web editor")
+
+	// The upload provider is only known once the options are fully parsed.
+	opt.Upload = cli.ParseJob(opt.BaseArgs, nil).Upload
+
+	queue := newRenderQueue(runtime.NumCPU())
+
+	mux := http.NewServeMux()
+	mux.Handle("/", http.FileServer(http.FS(assets)))
+	mux.HandleFunc("/api/config", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"upload": opt.Upload})
+	})
+	mux.HandleFunc("/api/templates", templates)
+	mux.HandleFunc("/api/templates/", func(w http.ResponseWriter, r *http.Request) {
+		template(opt, w, r)
+	})
+	mux.HandleFunc("/api/fonts", fonts)
+	mux.HandleFunc("/api/render", func(w http.ResponseWriter, r *http.Request) {
+		webRender(opt, queue, w, r)
+	})
+	mux.HandleFunc("/api/upload", func(w http.ResponseWriter, r *http.Request) {
+		webUpload(opt, queue, w, r)
+	})
+
+	// Responses are written once the meme is rendered, and uploaded.
+	srv := newServer(opt.Addr, mux, renderTimeout+uploadTimeout)
+
+	output.Info("Listening on http://%s", opt.Addr)
+	err = srv.ListenAndServe()
+	output.OnError(err, "Could not start the server")
+}
+
+// Write the image of a built-in template.
+func template(opt cli.Options, w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, "/api/templates/")
+	if !isTemplate(id) {
+		http.NotFound(w, r)
+		return
+	}
+
+	var st stream.Stream
+	err := output.Catch(func() {
+		opt.Image = id
+		st = image.Load(opt)
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", st.ContentType())
+	w.Header().Set("Cache-Control", "max-age=86400")
+	w.Write(st.Bytes())
+}
+
+// List the installed fonts.
+func fonts(w http.ResponseWriter, r *http.Request) {
+	var names []string
+	err := output.Catch(func() {
+		names = font.List()
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, names)
+}
+
+// Render a meme, writing it as a data URL along with its details.
+func webRender(base cli.Options, queue *renderQueue, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	values, err := requestValues(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	base.Context = r.Context()
+	_, st, err := queue.tryGenerate(base, values)
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+
+	width, height := st.Dimensions()
+	writeJSON(w, http.StatusOK, rendered{
+		Image:  "data:" + st.ContentType() + ";base64," + base64.StdEncoding.EncodeToString(st.Bytes()),
+		Format: st.FileExt(),
+		Width:  width,
+		Height: height,
+		Frames: st.Frames(),
+		Bytes:  len(st.Bytes()),
+	})
+}
+
+// Render a meme and upload it using the provider passed to the command.
+func webUpload(base cli.Options, queue *renderQueue, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if base.Upload == "" {
+		writeError(w, http.StatusNotFound, errors.New("Uploading isn't enabled, pass -upload to the web command"))
+		return
+	}
+
+	values, err := requestValues(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	base.Context = r.Context()
+	opt, st, err := queue.tryGenerate(base, values)
+	if err != nil {
+		writeError(w, errorStatus(err), err)
+		return
+	}
+
+	var res upload.Result
+	err = output.Catch(func() {
+		res = upload.New(opt).Upload(st)
+		upload.Record(opt, res)
+	})
+	if err != nil {
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, uploaded{URL: res.URL, DeleteHash: res.DeleteHash})
+}
+
+// Write a value as json.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// Write an error as json.
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+// Return true if the id is a built-in template.
+func isTemplate(id string) bool {
+	for _, t := range cli.ImageIds {
+		if id == t {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,329 @@
+"use strict";
+
+// The meme being edited. Box positions and sizes are percentages of the image.
+const state = {
+	image: "",
+	top: "",
+	bottom: "",
+	boxes: [],
+	font: "",
+	color: "#ffffff",
+	stroke: "#000000",
+	shake: false,
+	trigger: false,
+	gif: false,
+};
+
+const renderDelay = 300; // ms
+const minBoxSize = 5; // percent
+
+let selected = -1; // The selected box.
+let renders = 0; // Used to ignore renders which finish out of order.
+let timer = 0;
+
+const $ = (id) => document.getElementById(id);
+
+// Call the API, returning the decoded json or throwing its error.
+async function api(path, fields) {
+	const init = fields === undefined ? {} : {
+		method: "POST",
+		headers: {"Content-Type": "application/json"},
+		body: JSON.stringify(fields),
+	};
+
+	const res = await fetch(path, init);
+	const data = await res.json().catch(() => ({error: res.statusText}));
+	if (!res.ok) {
+		throw new Error(data.error || res.statusText);
+	}
+	return data;
+}
+
+// Show a message next to the title.
+function status(text, error = false) {
+	$("status").textContent = text;
+	$("status").classList.toggle("error", error);
+}
+
+// Return the fields of the render API for the meme.
+function fields() {
+	const round = (v) => Math.round(v * 10) / 10;
+	const f = {
+		image: state.image,
+		top: state.top,
+		bottom: state.bottom,
+		color: state.color,
+		stroke: state.stroke,
+		shake: state.shake,
+		trigger: state.trigger,
+		gif: state.gif,
+		box: state.boxes
+			.filter((b) => b.text !== "")
+			.map((b) => {
+				// Rounding mustn't push a box past the edge of the image.
+				const x = round(b.x);
+				const y = round(b.y);
+				const w = Math.min(round(b.w), round(100 - x));
+				const h = Math.min(round(b.h), round(100 - y));
+				return [x, y, w, h].join(",") + ":" + b.text;
+			}),
+	};
+	if (state.font !== "") {
+		f.font = state.font;
+	}
+	return f;
+}
+
+// Render the meme once the changes pause.
+function changed() {
+	clearTimeout(timer);
+	timer = setTimeout(render, renderDelay);
+}
+
+// Render the meme and show it.
+async function render() {
+	if (state.image === "") {
+		return;
+	}
+
+	const n = ++renders;
+	status("Rendering...");
+
+	try {
+		const meme = await api("/api/render", fields());
+		if (n !== renders) {
+			return;
+		}
+
+		$("meme").src = meme.image;
+		$("download").href = meme.image;
+		$("download").download = "meme." + meme.format;
+		$("download").hidden = false;
+
+		const frames = meme.frames > 1 ? `, ${meme.frames} frames` : "";
+		status(`${meme.width}x${meme.height} ${meme.format}${frames}, ${Math.ceil(meme.bytes / 1024)} KB`);
+	} catch (err) {
+		if (n === renders) {
+			status(err.message, true);
+		}
+	}
+}
+
+// Upload the meme and show the link.
+async function upload() {
+	status("Uploading...");
+	$("upload").disabled = true;
+
+	try {
+		const res = await api("/api/upload", fields());
+		const link = $("link").firstElementChild;
+		link.href = res.url;
+		link.textContent = res.url;
+		$("link").hidden = false;
+		status("Uploaded");
+	} catch (err) {
+		status(err.message, true);
+	} finally {
+		$("upload").disabled = false;
+	}
+}
+
+// Choose the image to edit.
+function choose(image) {
+	state.image = image;
+
+	for (const li of $("templates").children) {
+		li.classList.toggle("selected", li.dataset.id === image);
+	}
+
+	$("stage").hidden = false;
+	$("hint").hidden = true;
+	$("link").hidden = true;
+	render();
+}
+
+// Show the template gallery.
+async function loadTemplates() {
+	const ids = await api("/api/templates");
+
+	for (const id of ids) {
+		const li = document.createElement("li");
+		li.dataset.id = id;
+		li.title = id;
+		li.addEventListener("click", () => {
+			$("url").value = "";
+			choose(id);
+		});
+
+		const img = document.createElement("img");
+		img.src = "/api/templates/" + encodeURIComponent(id);
+		img.alt = id;
+		img.loading = "lazy";
+
+		li.append(img);
+		$("templates").append(li);
+	}
+}
+
+// Fill the list of fonts.
+async function loadFonts() {
+	for (const name of await api("/api/fonts")) {
+		const option = document.createElement("option");
+		option.value = name;
+		option.textContent = name;
+		$("font").append(option);
+	}
+}
+
+// Show the upload button if the server has an upload provider.
+async function loadConfig() {
+	const config = await api("/api/config");
+	$("upload").hidden = !config.upload;
+	$("upload").title = "Upload using " + config.upload;
+}
+
+// Select a box, highlighting it on the image and in the list.
+function select(n) {
+	selected = n;
+	$("boxes").querySelectorAll(".box").forEach((el, x) => el.classList.toggle("selected", x === n));
+	$("box-list").querySelectorAll("li").forEach((el, x) => el.classList.toggle("selected", x === n));
+}
+
+// Draw the box outlines and the list of box text.
+function drawBoxes() {
+	$("boxes").replaceChildren();
+	$("box-list").replaceChildren();
+
+	state.boxes.forEach((box, n) => {
+		const el = document.createElement("div");
+		el.className = "box";
+		place(el, box);
+
+		const handle = document.createElement("div");
+		handle.className = "handle";
+		el.append(handle);
+
+		el.addEventListener("pointerdown", (e) => drag(e, n, e.target === handle));
+		el.addEventListener("dblclick", () => $("box-list").children[n].querySelector("input").focus());
+		$("boxes").append(el);
+
+		const li = document.createElement("li");
+		const input = document.createElement("input");
+		input.type = "text";
+		input.value = box.text;
+		input.placeholder = "Text";
+		input.addEventListener("focus", () => select(n));
+		input.addEventListener("input", () => {
+			box.text = input.value;
+			changed();
+		});
+
+		const remove = document.createElement("button");
+		remove.type = "button";
+		remove.textContent = "✕";
+		remove.title = "Remove the box";
+		remove.addEventListener("click", () => {
+			state.boxes.splice(n, 1);
+			selected = -1;
+			drawBoxes();
+			changed();
+		});
+
+		li.append(input, remove);
+		$("box-list").append(li);
+	});
+
+	select(selected);
+}
+
+// Position a box outline over the image.
+function place(el, box) {
+	el.style.left = box.x + "%";
+	el.style.top = box.y + "%";
+	el.style.width = box.w + "%";
+	el.style.height = box.h + "%";
+}
+
+// Move or resize a box with the pointer.
+function drag(e, n, resize) {
+	e.preventDefault();
+	select(n);
+
+	const box = state.boxes[n];
+	const el = e.currentTarget;
+	const stage = $("stage").getBoundingClientRect();
+	const start = {x: e.clientX, y: e.clientY, box: {...box}};
+	const clamp = (v, min, max) => Math.min(Math.max(v, min), max);
+
+	el.setPointerCapture(e.pointerId);
+
+	const move = (e) => {
+		const dx = (e.clientX - start.x) / stage.width * 100;
+		const dy = (e.clientY - start.y) / stage.height * 100;
+
+		if (resize) {
+			box.w = clamp(start.box.w + dx, minBoxSize, 100 - box.x);
+			box.h = clamp(start.box.h + dy, minBoxSize, 100 - box.y);
+		} else {
+			box.x = clamp(start.box.x + dx, 0, 100 - box.w);
+			box.y = clamp(start.box.y + dy, 0, 100 - box.h);
+		}
+		place(el, box);
+	};
+
+	const up = () => {
+		el.removeEventListener("pointermove", move);
+		el.removeEventListener("pointerup", up);
+		el.removeEventListener("pointercancel", up);
+		changed();
+	};
+
+	el.addEventListener("pointermove", move);
+	el.addEventListener("pointerup", up);
+	el.addEventListener("pointercancel", up);
+}
+
+// Add a new box in the middle of the image.
+function addBox() {
+	state.boxes.push({x: 25, y: 40, w: 50, h: 20, text: ""});
+	selected = state.boxes.length - 1;
+	drawBoxes();
+	$("box-list").lastElementChild.querySelector("input").focus();
+}
+
+// Connect an input to a field of the meme.
+function bind(id, field, property = "value") {
+	$(id).addEventListener("input", () => {
+		state[field] = $(id)[property];
+		changed();
+	});
+}
+
+// Show only the templates matching the filter.
+function filter() {
+	const text = $("filter").value.toLowerCase();
+	for (const li of $("templates").children) {
+		li.hidden = !li.dataset.id.includes(text);
+	}
+}
+
+bind("top", "top");
+bind("bottom", "bottom");
+bind("font", "font");
+bind("color", "color");
+bind("stroke", "stroke");
+bind("shake", "shake", "checked");
+bind("trigger", "trigger", "checked");
+bind("gif", "gif", "checked");
+
+$("filter").addEventListener("input", filter);
+$("url").addEventListener("change", () => {
+	if ($("url").value !== "") {
+		choose($("url").value);
+	}
+});
+$("add-box").addEventListener("click", addBox);
+$("upload").addEventListener("click", upload);
+
+Promise.all([loadTemplates(), loadFonts(), loadConfig()])
+	.catch((err) => status(err.message, true));
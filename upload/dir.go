@@ -0,0 +1,38 @@
+package upload
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mitchellh/go-homedir"
+	"github.com/nomad-software/meme/image/stream"
+	"github.com/nomad-software/meme/output"
+)
+
+// Dir copies memes into a local directory, such as one served by a web server
+// or synced to a shared drive.
+type Dir struct {
+	Path    string
+	BaseURL string
+}
+
+// Upload the image.
+func (d Dir) Upload(st stream.Stream) Result {
+	dir, err := homedir.Expand(d.Path)
+	output.OnError(err, "Could not expand path")
+
+	err = os.MkdirAll(dir, 0755)
+	output.OnError(err, "Could not create upload directory")
+
+	name := ObjectName(st)
+	file := filepath.Join(dir, name)
+
+	err = os.WriteFile(file, st.Bytes(), 0644)
+	output.OnError(err, "Could not write image to upload directory")
+
+	if d.BaseURL != "" {
+		return Result{URL: strings.TrimSuffix(d.BaseURL, "/") + "/" + name}
+	}
+	return Result{URL: file}
+}
@@ -0,0 +1,86 @@
+package upload
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nomad-software/meme/cli"
+	"github.com/nomad-software/meme/output"
+)
+
+const (
+	historyFile = "history.jsonl"
+)
+
+// Entry is a record of an upload in the local history.
+type Entry struct {
+	Time       time.Time `json:"time"`
+	Provider   string    `json:"provider"`
+	URL        string    `json:"url"`
+	DeleteHash string    `json:"deletehash,omitempty"`
+	Source     string    `json:"source"`
+	Title      string    `json:"title,omitempty"`
+}
+
+// Return the location of the history file.
+func historyPath() string {
+	dir, err := os.UserConfigDir()
+	output.OnError(err, "Could not find the user config directory")
+	return filepath.Join(dir, "meme", historyFile)
+}
+
+// Record an upload in the local history.
+func Record(opt cli.Options, res Result) {
+	entry := Entry{
+		Time:       time.Now(),
+		Provider:   opt.Upload,
+		URL:        res.URL,
+		DeleteHash: res.DeleteHash,
+		Source:     opt.Image,
+		Title:      opt.Title,
+	}
+
+	b, err := json.Marshal(entry)
+	output.OnError(err, "Could not encode upload history")
+
+	path := historyPath()
+	err = os.MkdirAll(filepath.Dir(path), 0700)
+	output.OnError(err, "Could not create upload history directory")
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	output.OnError(err, "Could not open upload history")
+	defer file.Close()
+
+	_, err = file.Write(append(b, '\n'))
+	output.OnError(err, "Could not write upload history")
+}
+
+// Find the most recent history entry with the passed URL or delete hash.
+func findEntry(ref string) (Entry, bool) {
+	var found Entry
+	var ok bool
+
+	file, err := os.Open(historyPath())
+	if os.IsNotExist(err) {
+		return found, false
+	}
+	output.OnError(err, "Could not open upload history")
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry Entry
+		if json.Unmarshal(scanner.Bytes(), &entry) != nil {
+			continue
+		}
+		if entry.URL == ref || (entry.DeleteHash != "" && entry.DeleteHash == ref) {
+			found, ok = entry, true
+		}
+	}
+
+	output.OnError(scanner.Err(), "Could not read upload history")
+	return found, ok
+}
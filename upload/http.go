@@ -0,0 +1,129 @@
+package upload
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"strings"
+
+	"github.com/nomad-software/meme/image/stream"
+	"github.com/nomad-software/meme/output"
+)
+
+// HTTP uploads memes to a generic HTTP endpoint, either as the raw body of a
+// PUT request or as a file in a multipart POST request.
+type HTTP struct {
+	URL           string
+	Method        string
+	Field         string
+	Headers       []string
+	ResponseField string
+}
+
+// Upload the image.
+func (h HTTP) Upload(st stream.Stream) Result {
+	name := ObjectName(st)
+	method := strings.ToUpper(h.Method)
+	if method == "" {
+		method = "PUT"
+	}
+
+	var body io.Reader
+	contentType := st.ContentType()
+	target := h.URL
+
+	if method == "PUT" {
+		body = bytes.NewReader(st.Bytes())
+		if strings.HasSuffix(target, "/") {
+			target += name
+		}
+	} else {
+		field := h.Field
+		if field == "" {
+			field = "file"
+		}
+		body, contentType = multipartBody(field, name, st)
+	}
+
+	req, err := http.NewRequest(method, target, body)
+	output.OnError(err, "Could not create upload request")
+	req.Header.Set("Content-Type", contentType)
+
+	for _, header := range h.Headers {
+		key, value, ok := strings.Cut(header, ":")
+		if !ok {
+			output.Error(fmt.Sprintf("Invalid header, expected 'Key: Value': %s", header))
+		}
+		req.Header.Set(strings.TrimSpace(key), strings.TrimSpace(value))
+	}
+
+	resp, err := uploadClient.Do(req)
+	output.OnError(err, "Could not upload image")
+	defer resp.Body.Close()
+	checkResponse(resp)
+
+	if h.ResponseField != "" {
+		data, err := ioutil.ReadAll(resp.Body)
+		output.OnError(err, "Could not read response body")
+		return Result{URL: jsonField(data, h.ResponseField)}
+	}
+
+	if location := resp.Header.Get("Location"); location != "" {
+		u, err := resp.Request.URL.Parse(location)
+		output.OnError(err, "Invalid location header")
+		return Result{URL: u.String()}
+	}
+
+	return Result{URL: target}
+}
+
+// Create a multipart body containing the image as a file.
+func multipartBody(field string, name string, st stream.Stream) (io.Reader, string) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+
+	part, err := w.CreateFormFile(field, name)
+	output.OnError(err, "Could not create multipart body")
+
+	_, err = part.Write(st.Bytes())
+	output.OnError(err, "Could not create multipart body")
+
+	err = w.Close()
+	output.OnError(err, "Could not create multipart body")
+
+	return &buf, w.FormDataContentType()
+}
+
+// Read a string from json data using a dotted path, e.g. 'data.url'.
+func jsonField(data []byte, path string) string {
+	var v interface{}
+	err := json.Unmarshal(data, &v)
+	output.OnError(err, "Could not decode json response")
+
+	for _, key := range strings.Split(path, ".") {
+		switch node := v.(type) {
+		case map[string]interface{}:
+			v = node[key]
+		case []interface{}:
+			var i int
+			if _, err := fmt.Sscanf(key, "%d", &i); err != nil || i < 0 || i >= len(node) {
+				v = nil
+			} else {
+				v = node[i]
+			}
+		default:
+			v = nil
+		}
+	}
+
+	s, ok := v.(string)
+	if !ok || s == "" {
+		output.Error(fmt.Sprintf("The response doesn't contain the field: %s", path))
+	}
+
+	return s
+}
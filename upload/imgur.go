@@ -0,0 +1,207 @@
+package upload
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nomad-software/meme/image/stream"
+	"github.com/nomad-software/meme/output"
+)
+
+const (
+	imgurURL       = "https://api.imgur.com/3/image"
+	imgurRetries   = 4                // Attempts before giving up.
+	imgurBackoff   = time.Second      // Initial wait between attempts.
+	imgurMaxWait   = 60 * time.Second // Longest wait before giving up.
+	imgurUserAgent = "meme (https://github.com/nomad-software/meme)"
+)
+
+// Imgur uploads memes to imgur.com. Uploads are anonymous when using a client
+// id, or added to a user's account when using an OAuth access token.
+type Imgur struct {
+	ClientID    string
+	Token       string
+	Album       string
+	Title       string
+	Description string
+}
+
+// Upload the image.
+func (i Imgur) Upload(st stream.Stream) Result {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+
+	part, err := w.CreateFormFile("image", ObjectName(st))
+	output.OnError(err, "Could not create multipart body")
+	_, err = part.Write(st.Bytes())
+	output.OnError(err, "Could not create multipart body")
+
+	fields := map[string]string{
+		"type":        "file",
+		"album":       i.Album,
+		"title":       i.Title,
+		"description": i.Description,
+	}
+	for name, value := range fields {
+		if value != "" {
+			err = w.WriteField(name, value)
+			output.OnError(err, "Could not create multipart body")
+		}
+	}
+
+	err = w.Close()
+	output.OnError(err, "Could not create multipart body")
+
+	body := i.send(func() *http.Request {
+		req, err := http.NewRequest("POST", imgurURL, bytes.NewReader(buf.Bytes()))
+		output.OnError(err, "Could not create upload request")
+		req.Header.Set("Content-Type", w.FormDataContentType())
+		return req
+	})
+
+	var imgur imgurResponse
+	err = json.Unmarshal(body, &imgur)
+	output.OnError(err, "Could not decode json response")
+
+	return Result{
+		URL:        imgur.Data.Link,
+		DeleteHash: imgur.Data.DeleteHash,
+	}
+}
+
+// Delete an image using its delete hash.
+// Images uploaded to an account can also be deleted using their id.
+func (i Imgur) Delete(hash string) {
+	i.send(func() *http.Request {
+		req, err := http.NewRequest("DELETE", imgurURL+"/"+hash, nil)
+		output.OnError(err, "Could not create delete request")
+		return req
+	})
+}
+
+// Send a request to the imgur api and return the response body.
+// Requests are retried with an increasing backoff when rate limited or when
+// imgur has a server error.
+func (i Imgur) send(newRequest func() *http.Request) []byte {
+	wait := imgurBackoff
+
+	for attempt := 1; ; attempt++ {
+		req := newRequest()
+		req.Header.Set("User-Agent", imgurUserAgent)
+		if i.Token != "" {
+			req.Header.Set("Authorization", "Bearer "+i.Token)
+		} else {
+			req.Header.Set("Authorization", "Client-ID "+i.ClientID)
+		}
+
+		resp, err := uploadClient.Do(req)
+		output.OnError(err, "Could not connect to imgur")
+
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		output.OnError(err, "Could not read response body")
+
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return body
+		}
+
+		retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		if !retry || attempt == imgurRetries {
+			output.Error(fmt.Sprintf("Imgur request failed: %s%s", imgurError(resp, body), rateLimitInfo(resp)))
+		}
+
+		if after := retryAfter(resp); after > 0 {
+			if after > imgurMaxWait {
+				output.Error(fmt.Sprintf("Imgur rate limit reached%s", rateLimitInfo(resp)))
+			}
+			wait = after
+		}
+
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
+
+// Return how long imgur has asked us to wait before retrying.
+func retryAfter(resp *http.Response) time.Duration {
+	if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		return time.Duration(s) * time.Second
+	}
+
+	if remaining := resp.Header.Get("X-Post-Rate-Limit-Remaining"); remaining == "0" {
+		if s, err := strconv.Atoi(resp.Header.Get("X-Post-Rate-Limit-Reset")); err == nil {
+			return time.Duration(s) * time.Second
+		}
+	}
+
+	// Each limit has its own reset time.
+	limits := []struct{ remaining, reset string }{
+		{"X-RateLimit-UserRemaining", "X-RateLimit-UserReset"},
+		{"X-RateLimit-ClientRemaining", "X-RateLimit-ClientReset"},
+	}
+	for _, limit := range limits {
+		if resp.Header.Get(limit.remaining) == "0" {
+			if reset, err := strconv.ParseInt(resp.Header.Get(limit.reset), 10, 64); err == nil {
+				return time.Until(time.Unix(reset, 0))
+			}
+			return imgurMaxWait + 1 // Exhausted for the day.
+		}
+	}
+
+	return 0
+}
+
+// Describe the imgur rate limits from the response headers.
+func rateLimitInfo(resp *http.Response) string {
+	info := ""
+	if v := resp.Header.Get("X-RateLimit-ClientRemaining"); v != "" {
+		info += fmt.Sprintf(", client credits remaining: %s", v)
+	}
+	if v, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-ClientReset"), 10, 64); err == nil {
+		info += fmt.Sprintf(", client credits reset at %s", time.Unix(v, 0).Format(time.Kitchen))
+	}
+	if v := resp.Header.Get("X-RateLimit-UserRemaining"); v != "" {
+		info += fmt.Sprintf(", user credits remaining: %s", v)
+	}
+	if v, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-UserReset"), 10, 64); err == nil {
+		info += fmt.Sprintf(", user credits reset at %s", time.Unix(v, 0).Format(time.Kitchen))
+	}
+	return info
+}
+
+// Extract the error message from an imgur error response.
+func imgurError(resp *http.Response, body []byte) string {
+	var e struct {
+		Data struct {
+			Error interface{} `json:"error"`
+		} `json:"data"`
+	}
+
+	if json.Unmarshal(body, &e) == nil {
+		switch err := e.Data.Error.(type) {
+		case string:
+			return fmt.Sprintf("%s (%s)", err, resp.Status)
+		case map[string]interface{}:
+			if msg, ok := err["message"].(string); ok {
+				return fmt.Sprintf("%s (%s)", msg, resp.Status)
+			}
+		}
+	}
+
+	return resp.Status
+}
+
+type imgurResponse struct {
+	Data imgurData `json:"data"`
+}
+
+type imgurData struct {
+	Link       string `json:"link"`
+	DeleteHash string `json:"deletehash"`
+}
@@ -0,0 +1,41 @@
+package upload
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRetryAfter(t *testing.T) {
+	soon := strconv.FormatInt(time.Now().Add(30*time.Second).Unix(), 10)
+	later := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+
+	tests := []struct {
+		name   string
+		header map[string]string
+		min    time.Duration
+		max    time.Duration
+	}{
+		{"no limits", nil, 0, 0},
+		{"retry after", map[string]string{"Retry-After": "5"}, 5 * time.Second, 5 * time.Second},
+		{"post limit", map[string]string{"X-Post-Rate-Limit-Remaining": "0", "X-Post-Rate-Limit-Reset": "20"}, 20 * time.Second, 20 * time.Second},
+		{"credits left", map[string]string{"X-RateLimit-ClientRemaining": "10", "X-RateLimit-UserRemaining": "10", "X-RateLimit-UserReset": later}, 0, 0},
+		{"user exhausted", map[string]string{"X-RateLimit-UserRemaining": "0", "X-RateLimit-UserReset": soon, "X-RateLimit-ClientReset": later}, 25 * time.Second, 30 * time.Second},
+		{"client exhausted", map[string]string{"X-RateLimit-ClientRemaining": "0", "X-RateLimit-ClientReset": soon, "X-RateLimit-UserReset": later}, 25 * time.Second, 30 * time.Second},
+		{"client exhausted for longer", map[string]string{"X-RateLimit-ClientRemaining": "0", "X-RateLimit-ClientReset": later, "X-RateLimit-UserReset": soon}, 59 * time.Minute, time.Hour},
+		{"no reset", map[string]string{"X-RateLimit-ClientRemaining": "0"}, imgurMaxWait + 1, imgurMaxWait + 1},
+	}
+
+	for _, test := range tests {
+		resp := &http.Response{Header: make(http.Header)}
+		for k, v := range test.header {
+			resp.Header.Set(k, v)
+		}
+
+		after := retryAfter(resp)
+		if after < test.min || after > test.max {
+			t.Errorf("%s: got %s, want between %s and %s", test.name, after, test.min, test.max)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package upload
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/nomad-software/meme/cli"
+	"github.com/nomad-software/meme/image/stream"
+	"github.com/nomad-software/meme/output"
+)
+
+// S3 uploads memes to Amazon S3 or any S3 compatible object storage, such as
+// MinIO. Requests are signed using AWS signature version 4 and buckets are
+// addressed using path style URLs.
+type S3 struct {
+	Endpoint  string
+	Bucket    string
+	Region    string
+	AccessKey string
+	SecretKey string
+	Prefix    string
+	PublicURL string
+}
+
+// Create an S3 uploader, reading missing credentials from the environment.
+func newS3(opt cli.Options) S3 {
+	s := S3{
+		Endpoint:  strings.TrimSuffix(opt.S3Endpoint, "/"),
+		Bucket:    opt.S3Bucket,
+		Region:    opt.S3Region,
+		AccessKey: opt.S3AccessKey,
+		SecretKey: opt.S3SecretKey,
+		Prefix:    opt.S3Prefix,
+		PublicURL: strings.TrimSuffix(opt.S3PublicURL, "/"),
+	}
+
+	if s.AccessKey == "" {
+		s.AccessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+	}
+	if s.SecretKey == "" {
+		s.SecretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+
+	if s.Bucket == "" {
+		output.Error("The s3 provider requires a bucket (-s3-bucket)")
+	}
+	if s.AccessKey == "" || s.SecretKey == "" {
+		output.Error("The s3 provider requires an access key and secret key (-s3-access-key, -s3-secret-key)")
+	}
+
+	return s
+}
+
+// Upload the image.
+func (s S3) Upload(st stream.Stream) Result {
+	key := path.Join(s.Prefix, ObjectName(st))
+	objectURL := fmt.Sprintf("%s/%s/%s", s.Endpoint, s.Bucket, key)
+
+	req, err := http.NewRequest("PUT", objectURL, bytes.NewReader(st.Bytes()))
+	output.OnError(err, "Could not create upload request")
+	req.Header.Set("Content-Type", st.ContentType())
+	s.sign(req, st.Bytes(), time.Now().UTC())
+
+	resp, err := uploadClient.Do(req)
+	output.OnError(err, "Could not upload image")
+	defer resp.Body.Close()
+	checkResponse(resp)
+
+	if s.PublicURL != "" {
+		return Result{URL: fmt.Sprintf("%s/%s", s.PublicURL, key)}
+	}
+	return Result{URL: objectURL}
+}
+
+// Sign the request using AWS signature version 4.
+func (s S3) sign(req *http.Request, payload []byte, now time.Time) {
+	date := now.Format("20060102")
+	stamp := now.Format("20060102T150405Z")
+	payloadHash := sha256Hex(payload)
+
+	req.Header.Set("Host", req.URL.Host)
+	req.Header.Set("X-Amz-Date", stamp)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	var names []string
+	for name := range req.Header {
+		names = append(names, strings.ToLower(name))
+	}
+	sort.Strings(names)
+
+	var headers strings.Builder
+	for _, name := range names {
+		headers.WriteString(name + ":" + strings.TrimSpace(req.Header.Get(name)) + "\n")
+	}
+	signed := strings.Join(names, ";")
+
+	canonical := strings.Join([]string{
+		req.Method,
+		(&url.URL{Path: req.URL.Path}).EscapedPath(),
+		req.URL.RawQuery,
+		headers.String(),
+		signed,
+		payloadHash,
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", date, s.Region)
+	toSign := strings.Join([]string{"AWS4-HMAC-SHA256", stamp, scope, sha256Hex([]byte(canonical))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), date)
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, scope, signed, signature,
+	))
+}
+
+// Return the hex encoded sha256 hash of the data.
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Return the hmac sha256 of the data using the key.
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
@@ -0,0 +1,149 @@
+package upload
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/nomad-software/meme/cli"
+	"github.com/nomad-software/meme/image/stream"
+	"github.com/nomad-software/meme/output"
+)
+
+const (
+	uploadTimeout = 2 * time.Minute // The time allowed for each request to a provider.
+)
+
+var (
+	// Providers lists the names of all upload providers.
+	Providers = []string{"dir", "discord", "http", "imgur", "mattermost", "s3", "slack"}
+
+	// Requests to providers fail rather than hang if a provider stops
+	// responding.
+	uploadClient = &http.Client{Timeout: uploadTimeout}
+)
+
+// Uploader is implemented by all upload providers.
+type Uploader interface {
+	// Upload the image and return where it can be found.
+	Upload(st stream.Stream) Result
+}
+
+// Result describes an uploaded image.
+type Result struct {
+	URL        string
+	DeleteHash string
+}
+
+// New returns the uploader selected by the passed options.
+func New(opt cli.Options) Uploader {
+	return newProvider(opt, opt.Upload)
+}
+
+// Create the named upload provider.
+func newProvider(opt cli.Options, name string) Uploader {
+	switch name {
+	case "imgur":
+		return newImgur(opt)
+
+	case "s3":
+		return newS3(opt)
+
+	case "http":
+		if opt.HTTPURL == "" {
+			output.Error("The http provider requires a URL (-http-url)")
+		}
+		return HTTP{
+			URL:           opt.HTTPURL,
+			Method:        opt.HTTPMethod,
+			Field:         opt.HTTPField,
+			Headers:       opt.HTTPHeaders,
+			ResponseField: opt.HTTPResponseField,
+		}
+
+	case "discord":
+		if opt.WebhookURL == "" {
+			output.Error("The discord provider requires a webhook URL (-webhook-url)")
+		}
+		return Discord{WebhookURL: opt.WebhookURL}
+
+	case "slack", "mattermost":
+		if opt.WebhookURL == "" {
+			output.Error(fmt.Sprintf("The %s provider requires a webhook URL (-webhook-url)", name))
+		}
+		if opt.WebhookHost == "" || opt.WebhookHost == "slack" || opt.WebhookHost == "mattermost" {
+			output.Error(fmt.Sprintf("The %s provider requires another provider to host the image (-webhook-host)", name))
+		}
+		return Webhook{
+			WebhookURL: opt.WebhookURL,
+			Mattermost: name == "mattermost",
+			Host:       newProvider(opt, opt.WebhookHost),
+		}
+
+	case "dir":
+		if opt.UploadDir == "" {
+			output.Error("The dir provider requires a directory (-upload-dir)")
+		}
+		return Dir{Path: opt.UploadDir, BaseURL: opt.UploadDirURL}
+	}
+
+	output.Error(fmt.Sprintf("Unknown upload provider: %s (expected one of %s)", name, strings.Join(Providers, ", ")))
+	panic("Never reached")
+}
+
+// Create an imgur uploader.
+func newImgur(opt cli.Options) Imgur {
+	if opt.ClientID == "" && opt.ImgurToken == "" {
+		output.Error("The imgur provider requires a client id (-cid) or an access token (-imgur-token)")
+	}
+
+	return Imgur{
+		ClientID:    opt.ClientID,
+		Token:       opt.ImgurToken,
+		Album:       opt.Album,
+		Title:       opt.Title,
+		Description: opt.Description,
+	}
+}
+
+// Delete removes an image from imgur. The passed reference is either a delete
+// hash or the URL of an image recorded in the upload history.
+func Delete(opt cli.Options, ref string) {
+	hash := ref
+
+	if entry, ok := findEntry(ref); ok {
+		if entry.DeleteHash == "" {
+			output.Error(fmt.Sprintf("No delete hash was recorded for: %s", ref))
+		}
+		hash = entry.DeleteHash
+	} else if strings.Contains(ref, "/") {
+		output.Error(fmt.Sprintf("The URL was not found in the upload history: %s", ref))
+	}
+
+	newImgur(opt).Delete(hash)
+}
+
+// ObjectName generates a unique name for an uploaded image from its content.
+func ObjectName(st stream.Stream) string {
+	sum := sha256.Sum256(st.Bytes())
+	return fmt.Sprintf("meme-%s.%s", hex.EncodeToString(sum[:8]), st.FileExt())
+}
+
+// Exit with an error if the response isn't successful.
+func checkResponse(resp *http.Response) {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return
+	}
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	msg := strings.TrimSpace(string(body))
+	if len(msg) > 200 {
+		msg = msg[:200] + "..."
+	}
+
+	output.Error(fmt.Sprintf("Could not upload image: %s %s", resp.Status, msg))
+}
@@ -0,0 +1,89 @@
+package upload
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"mime/multipart"
+	"net/url"
+
+	"github.com/nomad-software/meme/image/stream"
+	"github.com/nomad-software/meme/output"
+)
+
+// Discord posts memes to a Discord channel using a webhook. The image is
+// attached to the message so no other hosting is required.
+type Discord struct {
+	WebhookURL string
+}
+
+// Upload the image.
+func (d Discord) Upload(st stream.Stream) Result {
+	u, err := url.Parse(d.WebhookURL)
+	output.OnError(err, "Invalid webhook URL")
+
+	// Wait for the message to be created so the attachment URL is returned.
+	query := u.Query()
+	query.Set("wait", "true")
+	u.RawQuery = query.Encode()
+
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+
+	part, err := w.CreateFormFile("files[0]", ObjectName(st))
+	output.OnError(err, "Could not create multipart body")
+	_, err = part.Write(st.Bytes())
+	output.OnError(err, "Could not create multipart body")
+	err = w.Close()
+	output.OnError(err, "Could not create multipart body")
+
+	resp, err := uploadClient.Post(u.String(), w.FormDataContentType(), &buf)
+	output.OnError(err, "Could not upload image")
+	defer resp.Body.Close()
+	checkResponse(resp)
+
+	body, err := ioutil.ReadAll(resp.Body)
+	output.OnError(err, "Could not read response body")
+
+	return Result{URL: jsonField(body, "attachments.0.url")}
+}
+
+// Webhook posts memes to a Slack or Mattermost channel using an incoming
+// webhook. Incoming webhooks can't receive files, so the image is first
+// uploaded using another provider and then linked in the message.
+type Webhook struct {
+	WebhookURL string
+	Mattermost bool
+	Host       Uploader
+}
+
+// Upload the image.
+func (w Webhook) Upload(st stream.Stream) Result {
+	res := w.Host.Upload(st)
+
+	var msg interface{}
+	if w.Mattermost {
+		msg = map[string]interface{}{
+			"attachments": []map[string]string{
+				{"fallback": res.URL, "image_url": res.URL},
+			},
+		}
+	} else {
+		msg = map[string]interface{}{
+			"text": res.URL,
+			"blocks": []map[string]string{
+				{"type": "image", "image_url": res.URL, "alt_text": "meme"},
+			},
+		}
+	}
+
+	body, err := json.Marshal(msg)
+	output.OnError(err, "Could not encode webhook message")
+
+	resp, err := uploadClient.Post(w.WebhookURL, "application/json", bytes.NewReader(body))
+	output.OnError(err, "Could not post webhook message")
+	defer resp.Body.Close()
+	checkResponse(resp)
+
+	return res
+}